@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// where the respondent of a submission came from, as given by the submission
+type Acquisition struct {
+	UTMSource   string `json:"utm_source,omitempty" bson:"utm_source,omitempty"`
+	UTMMedium   string `json:"utm_medium,omitempty" bson:"utm_medium,omitempty"`
+	UTMCampaign string `json:"utm_campaign,omitempty" bson:"utm_campaign,omitempty"`
+	Referrer    string `json:"referrer,omitempty" bson:"referrer,omitempty"` // host of the page linking to the survey, the rest of its URL is dropped
+}
+
+// longest utm value accepted
+const maxUTMLength = 200
+
+// the acquisition as stored: trimmed, with the referrer reduced to its host. nil when nothing is given
+func (a Acquisition) normalized() (*Acquisition, error) {
+	fields := []struct {
+		name  string
+		value *string
+	}{
+		{"utm_source", &a.UTMSource},
+		{"utm_medium", &a.UTMMedium},
+		{"utm_campaign", &a.UTMCampaign},
+	}
+	for _, f := range fields {
+		*f.value = strings.TrimSpace(*f.value)
+		if len(*f.value) > maxUTMLength {
+			return nil, fmt.Errorf("%s should be at most %d characters", f.name, maxUTMLength)
+		}
+	}
+	if referrer := strings.TrimSpace(a.Referrer); referrer != "" {
+		u, err := url.Parse(referrer)
+		if err != nil || u.Hostname() == "" {
+			return nil, fmt.Errorf("referrer should be the URL of the page linking to the survey")
+		}
+		a.Referrer = strings.ToLower(u.Hostname())
+	}
+	if a == (Acquisition{}) {
+		return nil, nil
+	}
+	return &a, nil
+}
+
+// fields of Acquisition submissions can be grouped by
+var acquisitionFields = map[string]string{
+	"source":   "utm_source",
+	"medium":   "utm_medium",
+	"campaign": "utm_campaign",
+	"referrer": "referrer",
+}
+
+// submissions of a survey with one value of an acquisition field, "" for submissions without it
+type SourceCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// get the number of submissions of a survey per utm source, medium, campaign or referrer
+func getSourceBreakdown(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get source breakdown")
+	id, _ := bson.ObjectIDFromHex(mux.Vars(r)["survey_id"])
+	by := r.URL.Query().Get("by")
+	if by == "" {
+		by = "source"
+	}
+	field, ok := acquisitionFields[by]
+	if !ok {
+		http.Error(w, "Invalid by, expected source, medium, campaign or referrer", http.StatusBadRequest)
+		return
+	}
+	filter, err := exportFilter(r, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), streamTimeout)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   "$user_id",
+			"value": bson.M{"$first": bson.M{"$ifNull": bson.A{"$acquisition." + field, ""}}},
+		}}},
+		{{Key: "$group", Value: bson.M{"_id": "$value", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+	}
+	cursor, err := responsesCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		panic(err)
+	}
+	defer cursor.Close(ctx)
+	var groups []struct {
+		Value string `bson:"_id"`
+		Count int    `bson:"count"`
+	}
+	if err = cursor.All(ctx, &groups); err != nil {
+		panic(err)
+	}
+
+	sources := make([]SourceCount, 0, len(groups))
+	for _, g := range groups {
+		sources = append(sources, SourceCount{g.Value, g.Count})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sources)
+}
@@ -0,0 +1,1009 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// chart-ready answer distribution of one choice question
+type ChartData struct {
+	QuestionId    bson.ObjectID `json:"question_id"`
+	QuestionTitle string        `json:"question_title"`
+	QuestionType  string        `json:"question_type"`
+	Options       []ChartOption `json:"options"`
+	Mean          *float64      `json:"mean,omitempty"` // Likert Scale and Rating only, from the question's scores
+}
+
+type ChartOption struct {
+	Label string `json:"label"`
+	Count int    `json:"count"`
+}
+
+// stages turning every response into one document per chosen answer, held in answer and numbered by position.
+// Checkbox responses hold their options in value, other responses have a single answer, their response_text
+var unwindAnswers = mongo.Pipeline{
+	{{Key: "$addFields", Value: bson.M{"answer": bson.M{"$cond": bson.A{bson.M{"$isArray": "$value"}, "$value", bson.A{"$response_text"}}}}}},
+	{{Key: "$unwind", Value: bson.M{"path": "$answer", "includeArrayIndex": "position"}}},
+}
+
+// count responses matching filter grouped by question, Matrix row and answer text
+func answerCounts(ctx context.Context, filter bson.M) (map[answerKey]map[string]int, error) {
+	pipeline := append(mongo.Pipeline{{{Key: "$match", Value: filter}}}, unwindAnswers...)
+	pipeline = append(pipeline, bson.D{{Key: "$group", Value: bson.M{
+		"_id":   bson.M{"question_id": "$question_id", "row_id": "$row_id", "response_text": "$answer"},
+		"count": bson.M{"$sum": 1},
+	}}})
+	cursor, err := responsesCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var groups []struct {
+		Id struct {
+			QuestionId   bson.ObjectID `bson:"question_id"`
+			RowId        bson.ObjectID `bson:"row_id"`
+			ResponseText string        `bson:"response_text"`
+		} `bson:"_id"`
+		Count int `bson:"count"`
+	}
+	if err = cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[answerKey]map[string]int)
+	for _, g := range groups {
+		key := answerKey{g.Id.QuestionId, g.Id.RowId}
+		if counts[key] == nil {
+			counts[key] = make(map[string]int)
+		}
+		counts[key][g.Id.ResponseText] += g.Count
+	}
+	return counts, nil
+}
+
+// answer distribution of every choice question of survey from answerCounts
+func surveyCharts(survey Survey, counts map[answerKey]map[string]int) []ChartData {
+	charts := []ChartData{}
+	for _, q := range survey.Questions {
+		// free text answers can not be charted
+		options := q.options()
+		if options == nil {
+			continue
+		}
+		chart := ChartData{
+			QuestionId:    q.Id,
+			QuestionTitle: q.QuestionTitle,
+			QuestionType:  q.QuestionType,
+			Options:       []ChartOption{},
+		}
+		scores := q.scores()
+		total, score := 0, 0.0
+		for i, answer := range options {
+			count := counts[answerKey{QuestionId: q.Id}][answer]
+			chart.Options = append(chart.Options, ChartOption{Label: answer, Count: count})
+			total += count
+			score += scores[i] * float64(count)
+		}
+		if q.isScored() && total > 0 {
+			mean := score / float64(total)
+			chart.Mean = &mean
+		}
+		charts = append(charts, chart)
+	}
+	return charts
+}
+
+// get answer distributions of every choice question of a survey
+func getResponsesChart(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get responses chart")
+	queries := mux.Vars(r)
+	id, err := bson.ObjectIDFromHex(queries["survey_id"])
+	if err != nil {
+		http.Error(w, "Invalid Survey Id", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var survey Survey
+	err = surveysCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&survey)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "No survey found", http.StatusNotFound)
+			return
+		}
+		panic(err)
+	}
+
+	// held and rejected answers stay out of the chart like out of the exports
+	filter, err := exportFilter(r, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	counts, err := answerCounts(ctx, filter)
+	if err != nil {
+		panic(err)
+	}
+
+	charts := surveyCharts(survey, counts)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(charts)
+}
+
+// counts and percentages of the answers to one question
+type QuestionResult struct {
+	QuestionId    bson.ObjectID  `json:"question_id"`
+	QuestionTitle string         `json:"question_title"`
+	QuestionType  string         `json:"question_type"`
+	Total         int            `json:"total"`
+	Options       []OptionResult `json:"options"`
+	Mean          *float64       `json:"mean,omitempty"`          // Likert Scale, Rating and Number only
+	Rows          []RowResult    `json:"rows,omitempty"`          // Matrix only, the question's total and options are left empty
+	OtherAnswers  []OptionResult `json:"other_answers,omitempty"` // Multiple Choice with an other_option only, what respondents specified
+}
+
+// counts and percentages of the answers to one row of a Matrix question
+type RowResult struct {
+	RowId    bson.ObjectID  `json:"row_id"`
+	RowTitle string         `json:"row_title"`
+	Total    int            `json:"total"`
+	Options  []OptionResult `json:"options"`
+}
+
+// add the options nobody picked to the counted ones
+func withUnpicked(counted []OptionResult, options []string) []OptionResult {
+	for _, answer := range options {
+		if !slices.ContainsFunc(counted, func(o OptionResult) bool { return o.Answer == answer }) {
+			counted = append(counted, OptionResult{Answer: answer})
+		}
+	}
+	return counted
+}
+
+type OptionResult struct {
+	Answer     string  `json:"answer" bson:"answer"`
+	Count      int     `json:"count" bson:"count"`
+	Percentage float64 `json:"percentage" bson:"percentage"` // share of the question's answers, 0 to 100
+}
+
+// get counts and percentages per answer of every question of a survey
+func getSurveyResults(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get survey results")
+	id, _ := bson.ObjectIDFromHex(mux.Vars(r)["survey_id"])
+	survey, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+	filter, err := exportFilter(r, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), streamTimeout)
+	defer cancel()
+
+	results, err := surveyResults(ctx, survey.Questions, filter)
+	if err != nil {
+		panic(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// counts and percentages per answer of questions, counting the responses matching filter
+func surveyResults(ctx context.Context, questions []Question, filter bson.M) ([]QuestionResult, error) {
+	// count every answer, then total the responses per question, or Matrix row, to get the percentages.
+	// a Checkbox response counts towards every option it picked, but only once towards the total
+	pipeline := append(mongo.Pipeline{{{Key: "$match", Value: filter}}}, unwindAnswers...)
+	pipeline = append(pipeline,
+		bson.D{{Key: "$group", Value: bson.M{
+			"_id":       bson.M{"question_id": "$question_id", "row_id": "$row_id", "response_text": "$answer"},
+			"count":     bson.M{"$sum": 1},
+			"responses": bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$position", 0}}, 1, 0}}},
+		}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id.response_text", Value: 1}}}},
+		bson.D{{Key: "$group", Value: bson.M{
+			"_id":     bson.M{"question_id": "$_id.question_id", "row_id": "$_id.row_id"},
+			"total":   bson.M{"$sum": "$responses"},
+			"options": bson.M{"$push": bson.M{"answer": "$_id.response_text", "count": "$count"}},
+		}}},
+		bson.D{{Key: "$project", Value: bson.M{
+			"total": 1,
+			"options": bson.M{"$map": bson.M{
+				"input": "$options",
+				"as":    "o",
+				"in": bson.M{
+					"answer": "$$o.answer",
+					"count":  "$$o.count",
+					"percentage": bson.M{"$round": bson.A{
+						bson.M{"$multiply": bson.A{100, bson.M{"$divide": bson.A{"$$o.count", "$total"}}}}, 2,
+					}},
+				},
+			}},
+		}}},
+	)
+	cursor, err := responsesCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var groups []struct {
+		Id struct {
+			QuestionId bson.ObjectID `bson:"question_id"`
+			RowId      bson.ObjectID `bson:"row_id"`
+		} `bson:"_id"`
+		Total   int            `bson:"total"`
+		Options []OptionResult `bson:"options"`
+	}
+	if err = cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+	byQuestion := make(map[answerKey]int, len(groups))
+	for i, g := range groups {
+		byQuestion[answerKey{g.Id.QuestionId, g.Id.RowId}] = i
+	}
+	otherAnswers, err := otherAnswerCounts(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []QuestionResult{}
+	for _, q := range questions {
+		result := QuestionResult{
+			QuestionId:    q.Id,
+			QuestionTitle: q.QuestionTitle,
+			QuestionType:  q.QuestionType,
+			Options:       []OptionResult{},
+		}
+		if q.QuestionType == "Matrix" {
+			result.Rows = []RowResult{}
+			for _, row := range q.Rows {
+				rowResult := RowResult{RowId: row.Id, RowTitle: row.Title, Options: []OptionResult{}}
+				if i, ok := byQuestion[answerKey{q.Id, row.Id}]; ok {
+					rowResult.Total = groups[i].Total
+					rowResult.Options = groups[i].Options
+				}
+				rowResult.Options = withUnpicked(rowResult.Options, q.Answers)
+				result.Rows = append(result.Rows, rowResult)
+			}
+			results = append(results, result)
+			continue
+		}
+		if i, ok := byQuestion[answerKey{QuestionId: q.Id}]; ok {
+			result.Total = groups[i].Total
+			result.Options = groups[i].Options
+		}
+		// options nobody picked are listed too
+		options := q.options()
+		result.Options = withUnpicked(result.Options, options)
+		if q.OtherOption != "" {
+			result.OtherAnswers = []OptionResult{}
+			for _, o := range otherAnswers[q.Id] {
+				o.Percentage = math.Round(10000*float64(o.Count)/float64(max(result.Total, 1))) / 100
+				result.OtherAnswers = append(result.OtherAnswers, o)
+			}
+		}
+		if q.isScored() && result.Total > 0 {
+			scores, sum := q.scores(), 0.0
+			for _, o := range result.Options {
+				if i := slices.Index(options, o.Answer); i >= 0 {
+					sum += scores[i] * float64(o.Count)
+				}
+			}
+			mean := sum / float64(result.Total)
+			result.Mean = &mean
+		}
+		// Number answers are their own score
+		if q.QuestionType == "Number" {
+			sum, count := 0.0, 0
+			for _, o := range result.Options {
+				if v, err := strconv.ParseFloat(o.Answer, 64); err == nil {
+					sum += v * float64(o.Count)
+					count += o.Count
+				}
+			}
+			if count > 0 {
+				mean := sum / float64(count)
+				result.Mean = &mean
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// count the texts specified for other options by question, most frequent first
+func otherAnswerCounts(ctx context.Context, filter bson.M) (map[bson.ObjectID][]OptionResult, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$match", Value: bson.M{"other_text": bson.M{"$exists": true, "$ne": ""}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"question_id": "$question_id", "other_text": "$other_text"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id.other_text", Value: 1}}}},
+	}
+	cursor, err := responsesCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var groups []struct {
+		Id struct {
+			QuestionId bson.ObjectID `bson:"question_id"`
+			OtherText  string        `bson:"other_text"`
+		} `bson:"_id"`
+		Count int `bson:"count"`
+	}
+	if err = cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+	counts := make(map[bson.ObjectID][]OptionResult)
+	for _, g := range groups {
+		counts[g.Id.QuestionId] = append(counts[g.Id.QuestionId], OptionResult{Answer: g.Id.OtherText, Count: g.Count})
+	}
+	return counts, nil
+}
+
+// net promoter score of a 0 to 10 question
+type NPSResult struct {
+	QuestionId bson.ObjectID `json:"question_id"`
+	Promoters  int           `json:"promoters"`  // 9 or 10
+	Passives   int           `json:"passives"`   // 7 or 8
+	Detractors int           `json:"detractors"` // 0 to 6
+	Total      int           `json:"total"`
+	Score      *float64      `json:"score"` // % promoters - % detractors, from -100 to 100, null without answers
+}
+
+// scores 0 to 10 of an NPS question, nil for other questions. a question is an NPS question when it
+// has 11 answers scored 0 to 10 in order, either through its scores or with the answers "0" to "10"
+func (q Question) npsScores() []float64 {
+	switch q.QuestionType {
+	case "NPS":
+		return q.scores()
+	case "Rating":
+		// a 0 to 10 rating is an NPS question as it is
+		if low, high := q.ratingScale(); low != 0 || high != 10 {
+			return nil
+		}
+		return q.scores()
+	case "Likert Scale", "Multiple Choice":
+	default:
+		return nil
+	}
+	if len(q.Answers) != 11 {
+		return nil
+	}
+	scores := make([]float64, 11)
+	for i := range scores {
+		scores[i] = float64(i)
+		if len(q.Scores) == len(q.Answers) {
+			if q.Scores[i] != scores[i] {
+				return nil
+			}
+		} else if q.Answers[i] != strconv.Itoa(i) {
+			return nil
+		}
+	}
+	return scores
+}
+
+// get the net promoter score of an NPS question, the first one of the survey unless question_id is given
+func getSurveyNPS(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get survey nps")
+	id, _ := bson.ObjectIDFromHex(mux.Vars(r)["survey_id"])
+	survey, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+	filter, err := exportFilter(r, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var question *Question
+	questionId := r.URL.Query().Get("question_id")
+	for i, q := range survey.Questions {
+		if (questionId == "" && q.npsScores() != nil) || q.Id.Hex() == questionId {
+			question = &survey.Questions[i]
+			break
+		}
+	}
+	if question == nil {
+		http.Error(w, "No NPS question found, an NPS question has the NPS type or 11 answers scored 0 to 10", http.StatusNotFound)
+		return
+	}
+	scores := question.npsScores()
+	if scores == nil {
+		http.Error(w, "the question is not an NPS question, an NPS question has the NPS type or 11 answers scored 0 to 10", http.StatusBadRequest)
+		return
+	}
+	filter["question_id"] = question.Id
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// answers are mapped to their score through the question's answer list
+	options := question.options()
+	score := bson.M{"$arrayElemAt": bson.A{scores, bson.M{"$indexOfArray": bson.A{options, "$response_text"}}}}
+	count := func(cond bson.M) bson.M {
+		return bson.M{"$sum": bson.M{"$cond": bson.A{cond, 1, 0}}}
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$match", Value: bson.M{"response_text": bson.M{"$in": options}}}},
+		{{Key: "$project", Value: bson.M{"score": score}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":        nil,
+			"promoters":  count(bson.M{"$gte": bson.A{"$score", 9}}),
+			"passives":   count(bson.M{"$and": bson.A{bson.M{"$gte": bson.A{"$score", 7}}, bson.M{"$lt": bson.A{"$score", 9}}}}),
+			"detractors": count(bson.M{"$lt": bson.A{"$score", 7}}),
+			"total":      bson.M{"$sum": 1},
+		}}},
+	}
+	cursor, err := responsesCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		panic(err)
+	}
+	defer cursor.Close(ctx)
+	var groups []struct {
+		Promoters  int `bson:"promoters"`
+		Passives   int `bson:"passives"`
+		Detractors int `bson:"detractors"`
+		Total      int `bson:"total"`
+	}
+	if err = cursor.All(ctx, &groups); err != nil {
+		panic(err)
+	}
+
+	result := NPSResult{QuestionId: question.Id}
+	if len(groups) > 0 {
+		g := groups[0]
+		result.Promoters, result.Passives, result.Detractors, result.Total = g.Promoters, g.Passives, g.Detractors, g.Total
+		nps := 100 * float64(g.Promoters-g.Detractors) / float64(g.Total)
+		result.Score = &nps
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// descriptive statistics of a Likert Scale or Rating question, answers are mapped to their scores
+type LikertStats struct {
+	QuestionId    bson.ObjectID  `json:"question_id"`
+	QuestionTitle string         `json:"question_title"`
+	Total         int            `json:"total"`
+	Mean          *float64       `json:"mean"` // null without answers, like the other statistics
+	Median        *float64       `json:"median"`
+	Mode          []string       `json:"mode"` // every answer sharing the highest count
+	StdDev        *float64       `json:"std_dev"`
+	Distribution  []LikertOption `json:"distribution"`
+}
+
+type LikertOption struct {
+	Label    string  `json:"label"`
+	Position int     `json:"position"` // 1 to n in the order of the answers
+	Score    float64 `json:"score"`
+	Count    int     `json:"count"`
+}
+
+func likertStats(q Question, counts map[string]int) LikertStats {
+	stats := LikertStats{
+		QuestionId:    q.Id,
+		QuestionTitle: q.QuestionTitle,
+		Mode:          []string{},
+		Distribution:  []LikertOption{},
+	}
+	scores := q.scores()
+	most, sum := 0, 0.0
+	for i, answer := range q.options() {
+		count := counts[answer]
+		stats.Distribution = append(stats.Distribution, LikertOption{Label: answer, Position: i + 1, Score: scores[i], Count: count})
+		stats.Total += count
+		sum += scores[i] * float64(count)
+		if count > most {
+			most = count
+			stats.Mode = []string{answer}
+		} else if count == most && count > 0 {
+			stats.Mode = append(stats.Mode, answer)
+		}
+	}
+	if stats.Total == 0 {
+		return stats
+	}
+
+	mean := sum / float64(stats.Total)
+	variance := 0.0
+	for _, o := range stats.Distribution {
+		variance += float64(o.Count) * (o.Score - mean) * (o.Score - mean)
+	}
+	stdDev := math.Sqrt(variance / float64(stats.Total))
+
+	// scores of the middle answer(s) when every answer is sorted by score
+	sorted := slices.Clone(stats.Distribution)
+	slices.SortStableFunc(sorted, func(a, b LikertOption) int { return cmp.Compare(a.Score, b.Score) })
+	nth := func(n int) float64 {
+		for _, o := range sorted {
+			if n < o.Count {
+				return o.Score
+			}
+			n -= o.Count
+		}
+		return sorted[len(sorted)-1].Score
+	}
+	median := nth((stats.Total - 1) / 2)
+	if stats.Total%2 == 0 {
+		median = (median + nth(stats.Total/2)) / 2
+	}
+
+	stats.Mean, stats.Median, stats.StdDev = &mean, &median, &stdDev
+	return stats
+}
+
+// descriptive statistics of the answers to a Number question
+type NumberStats struct {
+	QuestionId    bson.ObjectID       `json:"question_id"`
+	QuestionTitle string              `json:"question_title"`
+	Total         int                 `json:"total"`
+	Mean          *float64            `json:"mean"` // null without answers, like the other statistics
+	Median        *float64            `json:"median"`
+	StdDev        *float64            `json:"std_dev"`
+	Min           *float64            `json:"min"`
+	Max           *float64            `json:"max"`
+	Percentiles   map[string]*float64 `json:"percentiles"` // p10, p25, p50, p75 and p90
+}
+
+var numberPercentiles = []int{10, 25, 50, 75, 90}
+
+// numeric values of the responses matching filter, in ascending order
+func numberValues(ctx context.Context, filter bson.M) ([]float64, error) {
+	fOpt := options.Find().SetProjection(bson.M{"value": 1}).SetSort(bson.M{"value": 1})
+	cursor, err := responsesCollection.Find(ctx, filter, fOpt)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	values := []float64{}
+	for cursor.Next(ctx) {
+		var response struct {
+			Value any `bson:"value"`
+		}
+		if err := cursor.Decode(&response); err != nil {
+			return nil, err
+		}
+		// responses stored before the question was a Number have no numeric value
+		if v, ok := response.Value.(float64); ok {
+			values = append(values, v)
+		}
+	}
+	return values, cursor.Err()
+}
+
+// percentile p (0 to 100) of sorted values, interpolating between the closest ranks
+func percentile(sorted []float64, p int) float64 {
+	pos := float64(p) / 100 * float64(len(sorted)-1)
+	i := int(pos)
+	if i+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[i] + (pos-float64(i))*(sorted[i+1]-sorted[i])
+}
+
+func numberStats(q Question, sorted []float64) NumberStats {
+	stats := NumberStats{
+		QuestionId:    q.Id,
+		QuestionTitle: q.QuestionTitle,
+		Total:         len(sorted),
+		Percentiles:   make(map[string]*float64, len(numberPercentiles)),
+	}
+	for _, p := range numberPercentiles {
+		stats.Percentiles[fmt.Sprintf("p%d", p)] = nil
+	}
+	if len(sorted) == 0 {
+		return stats
+	}
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+	mean := sum / float64(len(sorted))
+	variance := 0.0
+	for _, v := range sorted {
+		variance += (v - mean) * (v - mean)
+	}
+	stdDev := math.Sqrt(variance / float64(len(sorted)))
+	median := percentile(sorted, 50)
+	low, high := sorted[0], sorted[len(sorted)-1]
+	for _, p := range numberPercentiles {
+		v := percentile(sorted, p)
+		stats.Percentiles[fmt.Sprintf("p%d", p)] = &v
+	}
+	stats.Mean, stats.Median, stats.StdDev, stats.Min, stats.Max = &mean, &median, &stdDev, &low, &high
+	return stats
+}
+
+// get mean, median, mode, standard deviation and distribution of a Likert Scale or Rating question,
+// or mean, median, standard deviation, range and percentiles of a Number question
+func getQuestionStats(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get question stats")
+	queries := mux.Vars(r)
+	id, _ := bson.ObjectIDFromHex(queries["survey_id"])
+	questionId, err := bson.ObjectIDFromHex(queries["question_id"])
+	if err != nil {
+		http.Error(w, "Invalid Question Id", http.StatusBadRequest)
+		return
+	}
+	survey, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+	i := slices.IndexFunc(survey.Questions, func(q Question) bool { return q.Id == questionId })
+	if i < 0 {
+		http.Error(w, "No question found", http.StatusNotFound)
+		return
+	}
+	q := survey.Questions[i]
+	if !q.isScored() && q.QuestionType != "Number" {
+		http.Error(w, "statistics are only available for Likert Scale, Rating, NPS and Number questions", http.StatusBadRequest)
+		return
+	}
+	filter, err := exportFilter(r, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter["question_id"] = questionId
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if q.QuestionType == "Number" {
+		values, err := numberValues(ctx, filter)
+		if err != nil {
+			panic(err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(numberStats(q, values))
+		return
+	}
+
+	counts, err := answerCounts(ctx, filter)
+	if err != nil {
+		panic(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(likertStats(q, counts[answerKey{QuestionId: questionId}]))
+}
+
+// average position given to every option of a Ranking question
+type RankingResult struct {
+	QuestionId    bson.ObjectID   `json:"question_id"`
+	QuestionTitle string          `json:"question_title"`
+	Total         int             `json:"total"`   // number of responses
+	Options       []RankingOption `json:"options"` // by average rank, best first
+}
+
+type RankingOption struct {
+	Answer      string   `json:"answer" bson:"_id"`
+	AverageRank *float64 `json:"average_rank" bson:"average_rank"` // 1 is first, null when nobody ranked the option
+	FirstPlace  int      `json:"first_place" bson:"first_place"`   // number of responses ranking the option first
+}
+
+// get the average rank of every option of a Ranking question
+func getRankingResults(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get ranking results")
+	queries := mux.Vars(r)
+	id, _ := bson.ObjectIDFromHex(queries["survey_id"])
+	questionId, err := bson.ObjectIDFromHex(queries["question_id"])
+	if err != nil {
+		http.Error(w, "Invalid Question Id", http.StatusBadRequest)
+		return
+	}
+	survey, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+	i := slices.IndexFunc(survey.Questions, func(q Question) bool { return q.Id == questionId })
+	if i < 0 {
+		http.Error(w, "No question found", http.StatusNotFound)
+		return
+	}
+	q := survey.Questions[i]
+	if q.QuestionType != "Ranking" {
+		http.Error(w, "rankings are only available for Ranking questions", http.StatusBadRequest)
+		return
+	}
+	filter, err := exportFilter(r, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter["question_id"] = questionId
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	total, err := responsesCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		panic(err)
+	}
+	result := RankingResult{QuestionId: q.Id, QuestionTitle: q.QuestionTitle, Total: int(total), Options: []RankingOption{}}
+	// the position of an option in value is its rank, counted from 0
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$unwind", Value: bson.M{"path": "$value", "includeArrayIndex": "rank"}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":          "$value",
+			"average_rank": bson.M{"$avg": bson.M{"$add": bson.A{"$rank", 1}}},
+			"first_place":  bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$rank", 0}}, 1, 0}}},
+		}}},
+	}
+	cursor, err := responsesCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		panic(err)
+	}
+	defer cursor.Close(ctx)
+	if err = cursor.All(ctx, &result.Options); err != nil {
+		panic(err)
+	}
+	// options added after the last response are listed too
+	for _, answer := range q.Answers {
+		if !slices.ContainsFunc(result.Options, func(o RankingOption) bool { return o.Answer == answer }) {
+			result.Options = append(result.Options, RankingOption{Answer: answer})
+		}
+	}
+	// unranked options last
+	rank := func(o RankingOption) float64 {
+		if o.AverageRank == nil {
+			return math.Inf(1)
+		}
+		return *o.AverageRank
+	}
+	slices.SortFunc(result.Options, func(a, b RankingOption) int {
+		if c := cmp.Compare(rank(a), rank(b)); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Answer, b.Answer)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// contingency table of two questions over the respondents who answered both
+type Crosstab struct {
+	X            CrosstabAxis `json:"x"` // rows
+	Y            CrosstabAxis `json:"y"` // columns
+	Counts       [][]int      `json:"counts"`
+	RowTotals    []int        `json:"row_totals"`
+	ColumnTotals []int        `json:"column_totals"`
+	Total        int          `json:"total"`
+}
+
+type CrosstabAxis struct {
+	QuestionId    bson.ObjectID `json:"question_id"`
+	QuestionTitle string        `json:"question_title"`
+	Values        []string      `json:"values"`
+}
+
+// answer options in order for choice questions, followed by any other answer given
+func crosstabValues(q Question, given map[string]bool) []string {
+	values := slices.Clone(q.options())
+	extra := []string{}
+	for v := range given {
+		if !slices.Contains(values, v) {
+			extra = append(extra, v)
+		}
+	}
+	slices.Sort(extra)
+	return append(values, extra...)
+}
+
+// cross-tabulate the answers of two questions of a survey, respondents are matched by user_id
+func getCrosstab(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get crosstab")
+	id, _ := bson.ObjectIDFromHex(mux.Vars(r)["survey_id"])
+	survey, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+	axes := make([]Question, 2)
+	for i, param := range []string{"x", "y"} {
+		questionId, err := bson.ObjectIDFromHex(r.URL.Query().Get(param))
+		if err != nil {
+			http.Error(w, "Invalid "+param+" Question Id", http.StatusBadRequest)
+			return
+		}
+		j := slices.IndexFunc(survey.Questions, func(q Question) bool { return q.Id == questionId })
+		if j < 0 {
+			http.Error(w, "No question found for "+param, http.StatusNotFound)
+			return
+		}
+		axes[i] = survey.Questions[j]
+	}
+	if axes[0].Id == axes[1].Id {
+		http.Error(w, "x and y should be different questions", http.StatusBadRequest)
+		return
+	}
+	for _, q := range axes {
+		if q.QuestionType == "Matrix" || q.QuestionType == "Ranking" {
+			http.Error(w, q.QuestionType+" questions can not be cross-tabulated", http.StatusBadRequest)
+			return
+		}
+	}
+	filter, err := exportFilter(r, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter["question_id"] = bson.M{"$in": bson.A{axes[0].Id, axes[1].Id}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), streamTimeout)
+	defer cancel()
+
+	// the answers of a response as an array, several for Checkbox questions
+	answers := bson.M{"$cond": bson.A{bson.M{"$isArray": "$value"}, "$value", bson.A{"$response_text"}}}
+	answerTo := func(q Question) bson.M {
+		return bson.M{"$max": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$question_id", q.Id}}, answers, nil}}}
+	}
+	// one document per respondent with both answers, then count every pair of answers
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{"_id": "$user_id", "x": answerTo(axes[0]), "y": answerTo(axes[1])}}},
+		{{Key: "$match", Value: bson.M{"x": bson.M{"$ne": nil}, "y": bson.M{"$ne": nil}}}},
+		{{Key: "$unwind", Value: "$x"}},
+		{{Key: "$unwind", Value: "$y"}},
+		{{Key: "$group", Value: bson.M{"_id": bson.M{"x": "$x", "y": "$y"}, "count": bson.M{"$sum": 1}}}},
+	}
+	cursor, err := responsesCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		panic(err)
+	}
+	defer cursor.Close(ctx)
+	var pairs []struct {
+		Id struct {
+			X string `bson:"x"`
+			Y string `bson:"y"`
+		} `bson:"_id"`
+		Count int `bson:"count"`
+	}
+	if err = cursor.All(ctx, &pairs); err != nil {
+		panic(err)
+	}
+
+	givenX, givenY := make(map[string]bool), make(map[string]bool)
+	for _, p := range pairs {
+		givenX[p.Id.X], givenY[p.Id.Y] = true, true
+	}
+	table := Crosstab{
+		X: CrosstabAxis{axes[0].Id, axes[0].QuestionTitle, crosstabValues(axes[0], givenX)},
+		Y: CrosstabAxis{axes[1].Id, axes[1].QuestionTitle, crosstabValues(axes[1], givenY)},
+	}
+	table.Counts = make([][]int, len(table.X.Values))
+	for i := range table.Counts {
+		table.Counts[i] = make([]int, len(table.Y.Values))
+	}
+	table.RowTotals = make([]int, len(table.X.Values))
+	table.ColumnTotals = make([]int, len(table.Y.Values))
+	for _, p := range pairs {
+		i, j := slices.Index(table.X.Values, p.Id.X), slices.Index(table.Y.Values, p.Id.Y)
+		table.Counts[i][j] += p.Count
+		table.RowTotals[i] += p.Count
+		table.ColumnTotals[j] += p.Count
+		table.Total += p.Count
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(table)
+}
+
+// submissions started in one interval of a time series
+type VolumeBucket struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+}
+
+// next bucket start of a time series in loc
+func nextBucket(t time.Time, interval string, loc *time.Location) time.Time {
+	t = t.In(loc)
+	switch interval {
+	case "hour":
+		return t.Add(time.Hour)
+	case "week":
+		return t.AddDate(0, 0, 7)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+// get the number of submissions per hour, day or week of a survey, a submission counts at its respondent's first response
+func getResponseVolume(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get response volume")
+	id, _ := bson.ObjectIDFromHex(mux.Vars(r)["survey_id"])
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "day"
+	}
+	if interval != "hour" && interval != "day" && interval != "week" {
+		http.Error(w, "Invalid interval, expected hour, day or week", http.StatusBadRequest)
+		return
+	}
+	tz := r.URL.Query().Get("tz")
+	if tz == "" {
+		tz = "UTC"
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		http.Error(w, "Invalid tz, expected an IANA time zone like Asia/Hong_Kong", http.StatusBadRequest)
+		return
+	}
+	filter, err := exportFilter(r, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), streamTimeout)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{"_id": "$user_id", "submitted_at": bson.M{"$min": "$created_at"}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{"$dateTrunc": bson.M{
+				"date":        "$submitted_at",
+				"unit":        interval,
+				"timezone":    loc.String(),
+				"startOfWeek": "monday",
+			}},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	}
+	cursor, err := responsesCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		panic(err)
+	}
+	defer cursor.Close(ctx)
+	var groups []struct {
+		Start time.Time `bson:"_id"`
+		Count int       `bson:"count"`
+	}
+	if err = cursor.All(ctx, &groups); err != nil {
+		panic(err)
+	}
+
+	// intervals without submissions are listed with a count of 0, so charts have no gaps
+	buckets := []VolumeBucket{}
+	for _, g := range groups {
+		if len(buckets) > 0 {
+			for next := nextBucket(buckets[len(buckets)-1].Start, interval, loc); next.Before(g.Start); next = nextBucket(next, interval, loc) {
+				buckets = append(buckets, VolumeBucket{Start: next.UTC()})
+			}
+		}
+		buckets = append(buckets, VolumeBucket{Start: g.Start.UTC(), Count: g.Count})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buckets)
+}
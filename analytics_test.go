@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestChartIncludesUnpickedOptions(t *testing.T) {
+	ctx := testDB(t)
+	survey := insertSurvey(t, ctx, Survey{Title: "Chart", Questions: []Question{
+		{QuestionTitle: "Role", QuestionType: "Multiple Choice", Answers: []string{"Dev", "Ops", "QA"}},
+		{QuestionTitle: "Comments", QuestionType: "Textbox"},
+	}})
+	role, comments := survey.Questions[0].Id, survey.Questions[1].Id
+	insertResponses(t, ctx,
+		answer(survey.Id, bson.NewObjectID(), role, "Dev"),
+		answer(survey.Id, bson.NewObjectID(), role, "Dev"),
+		answer(survey.Id, bson.NewObjectID(), role, "QA"),
+		answer(survey.Id, bson.NewObjectID(), comments, "Nice"),
+	)
+	rejected := answer(survey.Id, bson.NewObjectID(), role, "Ops")
+	rejected.Moderation = ModerationRejected
+	insertResponses(t, ctx, rejected)
+
+	w := serve(getResponsesChart, "GET", "/responses/"+survey.Id.Hex()+"/chart", nil, map[string]string{"survey_id": survey.Id.Hex()})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	charts := decodeBody[[]ChartData](t, w)
+	if len(charts) != 1 || charts[0].QuestionId != role {
+		t.Fatalf("got %d charts, want only the one of the choice question", len(charts))
+	}
+	want := []ChartOption{{"Dev", 2}, {"Ops", 0}, {"QA", 1}}
+	if !slices.Equal(charts[0].Options, want) {
+		t.Errorf("options = %v, want %v", charts[0].Options, want)
+	}
+
+	w = serve(getResponsesChart, "GET", "/responses/"+survey.Id.Hex()+"/chart?from=yesterday", nil, map[string]string{"survey_id": survey.Id.Hex()})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid time range: status %d, want 400", w.Code)
+	}
+}
+
+func TestChartLikertMean(t *testing.T) {
+	likert := Question{Id: bson.NewObjectID(), QuestionTitle: "Agree", QuestionType: "Likert Scale",
+		Answers: []string{"Disagree", "Neutral", "Agree"}}
+	scored := Question{Id: bson.NewObjectID(), QuestionTitle: "Weighted", QuestionType: "Likert Scale",
+		Answers: []string{"Low", "Mid", "High"}, Scores: []float64{-2, 0, 2}}
+	survey := Survey{Questions: []Question{likert, scored}}
+	counts := map[answerKey]map[string]int{
+		{QuestionId: likert.Id}: {"Disagree": 1, "Neutral": 1, "Agree": 2},
+		{QuestionId: scored.Id}: {"Low": 3, "High": 1},
+	}
+
+	charts := surveyCharts(survey, counts)
+	if len(charts) != 2 {
+		t.Fatalf("got %d charts, want 2", len(charts))
+	}
+	// 1 + 2 + 3*2 over 4 answers, without scores the answers are scored 1 to n
+	if mean := charts[0].Mean; mean == nil || *mean != 2.25 {
+		t.Errorf("mean = %v, want 2.25", mean)
+	}
+	// -2*3 + 2 over 4 answers
+	if mean := charts[1].Mean; mean == nil || *mean != -1 {
+		t.Errorf("mean with scores = %v, want -1", mean)
+	}
+
+	if charts := surveyCharts(Survey{Questions: []Question{likert}}, nil); charts[0].Mean != nil {
+		t.Errorf("mean without answers = %v, want none", *charts[0].Mean)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// only let requests carrying the admin API key through, as "Authorization: Bearer <key>" or "X-Admin-Key: <key>"
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if config.AdminAPIKey == "" {
+			http.Error(w, "admin endpoints are disabled, set ADMIN_API_KEY to enable them", http.StatusForbidden)
+			return
+		}
+		key := r.Header.Get("X-Admin-Key")
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			key = bearer
+		}
+		if subtle.ConstantTimeCompare([]byte(key), []byte(config.AdminAPIKey)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// claims of the JWTs issued by /auth/login and /auth/refresh
+type Claims struct {
+	Subject   string `json:"sub"`
+	TokenType string `json:"typ"` // "access" or "refresh"
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"` // seconds until the access token expires
+}
+
+const accessTokenTTL = 15 * time.Minute
+const refreshTokenTTL = 7 * 24 * time.Hour
+
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+type contextKey string
+
+const claimsContextKey contextKey = "claims"
+
+// sign claims as an HS256 JWT
+func signJWT(claims Claims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, config.JWTSecret)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// verify the signature and expiry of an HS256 JWT of the given type
+func parseJWT(token string, tokenType string) (Claims, error) {
+	var claims Claims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return claims, errors.New("malformed token")
+	}
+	mac := hmac.New(sha256.New, config.JWTSecret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, mac.Sum(nil)) {
+		return claims, errors.New("invalid token signature")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims, errors.New("malformed token")
+	}
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return claims, errors.New("malformed token")
+	}
+	if claims.TokenType != tokenType {
+		return claims, errors.New("wrong token type")
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return claims, errors.New("token expired")
+	}
+	return claims, nil
+}
+
+// issue a new access and refresh token for a subject
+func issueTokens(subject string) (TokenPair, error) {
+	now := time.Now()
+	access, err := signJWT(Claims{subject, "access", now.Unix(), now.Add(accessTokenTTL).Unix()})
+	if err != nil {
+		return TokenPair{}, err
+	}
+	refresh, err := signJWT(Claims{subject, "refresh", now.Unix(), now.Add(refreshTokenTTL).Unix()})
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return TokenPair{access, refresh, "Bearer", int64(accessTokenTTL.Seconds())}, nil
+}
+
+// only let requests with a valid access token through, its claims are stored in the request context
+func requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			http.Error(w, "Unauthorized, a bearer token is required", http.StatusUnauthorized)
+			return
+		}
+		claims, err := parseJWT(token, "access")
+		if err != nil {
+			http.Error(w, "Unauthorized, "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), claimsContextKey, claims)))
+	}
+}
+
+// claims of the authenticated request, set by requireAuth
+func authClaims(r *http.Request) Claims {
+	claims, _ := r.Context().Value(claimsContextKey).(Claims)
+	return claims
+}
+
+// log in as a registered user or with the configured admin credentials
+func login(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("login")
+	var input struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var subject string
+	if config.AdminPassword != "" &&
+		subtle.ConstantTimeCompare([]byte(input.Username), []byte(config.AdminUsername)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(input.Password), []byte(config.AdminPassword)) == 1 {
+		subject = config.AdminUsername
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		var user User
+		err := usersCollection.FindOne(ctx, bson.M{"username": strings.ToLower(strings.TrimSpace(input.Username))}).Decode(&user)
+		if err != nil && err != mongo.ErrNoDocuments {
+			panic(err)
+		}
+		if err != nil || !checkPassword(user.PasswordHash, input.Password) {
+			http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+			return
+		}
+		subject = user.Id.Hex()
+	}
+
+	tokens, err := issueTokens(subject)
+	if err != nil {
+		panic(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// exchange a refresh token for a new token pair
+func refreshToken(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("refresh token")
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	claims, err := parseJWT(input.RefreshToken, "refresh")
+	if err != nil {
+		http.Error(w, "Unauthorized, "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	tokens, err := issueTokens(claims.Subject)
+	if err != nil {
+		panic(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
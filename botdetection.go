@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// spam heuristics of a survey, submissions failing them are flagged or rejected
+type BotDetection struct {
+	Honeypot   bool   `json:"honeypot,omitempty" bson:"honeypot,omitempty"`       // frontends render a hidden honeypot field, only bots fill it in
+	MinSeconds int    `json:"min_seconds,omitempty" bson:"min_seconds,omitempty"` // quickest plausible completion, from the respondent view to the submission
+	Action     string `json:"action,omitempty" bson:"action,omitempty"`           // flag (default) or reject
+}
+
+// reasons a submission looks automated, stored in bot_flags of its responses
+const (
+	BotFlagHoneypot = "honeypot"
+	BotFlagTooFast  = "too_fast"
+)
+
+// longest minimum completion time a survey can set, an hour
+const maxBotMinSeconds = 3600
+
+// start tokens are accepted this long, respondents coming back later have to reload the survey
+const startTokenTTL = 7 * 24 * time.Hour
+
+func validateBotDetection(b *BotDetection) []ValidationError {
+	if b == nil {
+		return nil
+	}
+	var errs []ValidationError
+	if b.MinSeconds < 0 || b.MinSeconds > maxBotMinSeconds {
+		errs = append(errs, ValidationError{"bot_detection.min_seconds", fmt.Sprintf("min_seconds should be from 0 to %d", maxBotMinSeconds)})
+	}
+	if b.Action != "" && b.Action != "flag" && b.Action != "reject" {
+		errs = append(errs, ValidationError{"bot_detection.action", "action should be flag or reject"})
+	}
+	return errs
+}
+
+// token of the time the respondent view of a survey was served, submitted back as start_token so the
+// completion time can be told. a JWT of type "start" naming the survey
+func newStartToken(s Survey) string {
+	now := time.Now()
+	token, err := signJWT(Claims{s.Id.Hex(), "start", now.Unix(), now.Add(startTokenTTL).Unix()})
+	if err != nil {
+		panic(err)
+	}
+	return token
+}
+
+// time the respondent of a submission was served the survey, zero when the start token is missing or invalid
+func submissionStart(s Survey, submission SubmissionInput) time.Time {
+	claims, err := parseJWT(submission.StartToken, "start")
+	if err != nil || claims.Subject != s.Id.Hex() {
+		return time.Time{}
+	}
+	return time.Unix(claims.IssuedAt, 0)
+}
+
+// reasons a submission started at started looks automated. surveys rejecting them write a 403 instead
+func checkBotFlags(w http.ResponseWriter, s Survey, submission SubmissionInput, started time.Time) ([]string, bool) {
+	b := s.BotDetection
+	if b == nil {
+		return nil, true
+	}
+	var flags []string
+	if b.Honeypot && strings.TrimSpace(submission.Honeypot) != "" {
+		flags = append(flags, BotFlagHoneypot)
+	}
+	if b.MinSeconds > 0 && (started.IsZero() || time.Since(started) < time.Duration(b.MinSeconds)*time.Second) {
+		flags = append(flags, BotFlagTooFast)
+	}
+	if len(flags) > 0 && b.Action == "reject" {
+		http.Error(w, "the submission looks automated and was rejected", http.StatusForbidden)
+		return nil, false
+	}
+	return flags, true
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// verification endpoints of the supported captcha providers
+var captchaVerifyURLs = map[string]string{
+	"recaptcha": "https://www.google.com/recaptcha/api/siteverify",
+	"hcaptcha":  "https://api.hcaptcha.com/siteverify",
+}
+
+var captchaClient = &http.Client{Timeout: 5 * time.Second}
+
+func (s Survey) requiresCaptcha() bool {
+	return s.RequireCaptcha != nil && *s.RequireCaptcha
+}
+
+// a captcha provider and its secret are configured
+func captchaEnabled() bool {
+	_, ok := captchaVerifyURLs[config.CaptchaProvider]
+	return ok && config.CaptchaSecret != ""
+}
+
+// ask the captcha provider whether token was solved by the respondent at ip
+func verifyCaptcha(ctx context.Context, token, ip string) (bool, error) {
+	form := url.Values{
+		"secret":   {config.CaptchaSecret},
+		"response": {token},
+		"remoteip": {ip},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", captchaVerifyURLs[config.CaptchaProvider], strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := captchaClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("%s verification returned %s", config.CaptchaProvider, res.Status)
+	}
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return false, err
+	}
+	return result.Success, nil
+}
+
+// check the captcha of a submission to a survey requiring one, writing the problem found
+func checkCaptcha(ctx context.Context, w http.ResponseWriter, r *http.Request, survey Survey, submission SubmissionInput) bool {
+	if !survey.requiresCaptcha() {
+		return true
+	}
+	if !captchaEnabled() {
+		http.Error(w, "the survey requires a captcha but no captcha provider is configured", http.StatusServiceUnavailable)
+		return false
+	}
+	token := strings.TrimSpace(submission.CaptchaToken)
+	if token == "" {
+		http.Error(w, "the survey requires a captcha, captcha_token is missing", http.StatusBadRequest)
+		return false
+	}
+	ok, err := verifyCaptcha(ctx, token, clientIP(r))
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "the captcha could not be verified, please try again", http.StatusBadGateway)
+		return false
+	}
+	if !ok {
+		http.Error(w, "the captcha is invalid or has expired, please solve it again", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/rand"
+	"log"
+	"os"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
+	"go.mongodb.org/mongo-driver/v2/mongo/writeconcern"
+)
+
+// settings read from the environment (.env), unset values fall back to the defaults below
+type Config struct {
+	RequireQuestionsOnCreate bool   // reject surveys created without any question
+	WriteConcern             string // "majority", a number of nodes or a tag set name, empty keeps the driver default
+	ReadPreference           string // primary, primaryPreferred, secondary, secondaryPreferred or nearest
+	HashRespondentEmail      bool   // store sha256 hashes instead of plain respondent emails
+	MaxQuestions             int    // questions allowed per survey
+	MaxAnswers               int    // answer options allowed per question
+	TokenLength              int    // characters of a survey token
+	TokenAlphabet            string // characters a survey token is made of, single byte characters only
+	AdminAPIKey              string // key of the admin endpoints, empty disables them
+	JWTSecret                []byte // HS256 key of issued tokens, random per process when unset
+	AdminUsername            string // credentials accepted by /auth/login
+	AdminPassword            string // empty disables login
+	GoogleClientId           string // OAuth2 client of "Sign in with Google", empty disables it
+	GoogleClientSecret       string
+	GoogleRedirectURL        string // must point to /auth/google/callback and be registered with the client
+	PartialResponseDays      int    // days saved answers are kept after their last save
+	TrustProxyHeaders        bool   // take the client address from X-Forwarded-For, only behind a proxy setting it
+	TrustedProxyHops         int    // proxies in front of the server appending to X-Forwarded-For
+	RequireRespondentSession bool   // submissions need a respondent session token from POST /sessions
+	GeoIPDatabase            string // CSV of address ranges and their country, see loadGeoIP. empty leaves countries unknown
+	IPHashKey                []byte // HMAC key of respondent address hashes, derived from JWTSecret when unset
+	CaptchaProvider          string // recaptcha or hcaptcha
+	CaptchaSiteKey           string // public key the frontend renders the captcha with
+	CaptchaSecret            string // secret key submissions are verified with, empty disables captchas
+	RateLimit                bool   // limit submissions and survey creations per client address
+	SubmitRateLimit          int    // submissions a client can make per minute
+	CreateRateLimit          int    // surveys a client can create per minute
+	RateLimitBurst           int    // requests a client can make at once before being limited
+	WebhookWorkers           int    // goroutines delivering webhook events
+	WebhookMaxAttempts       int    // attempts at a webhook delivery before it fails
+	EventBus                 string // nats or kafka to publish survey and response events, empty disables publishing
+	EventBusURL              string // nats:// URL of the NATS server, or the Kafka brokers separated by commas
+	EventBusPrefix           string // prepended to the event names to form the subjects or topics
+	SMTPHost                 string // server notification emails are sent through, empty disables them
+	SMTPPort                 int
+	SMTPUsername             string // empty sends without authenticating
+	SMTPPassword             string
+	SMTPFrom                 string // sender of notification emails, like "Surveys <surveys@example.com>"
+}
+
+var config Config
+
+func loadConfig() Config {
+	return Config{
+		RequireQuestionsOnCreate: envBool("REQUIRE_QUESTIONS_ON_CREATE", false),
+		WriteConcern:             os.Getenv("MONGODB_WRITE_CONCERN"),
+		ReadPreference:           os.Getenv("MONGODB_READ_PREFERENCE"),
+		HashRespondentEmail:      envBool("HASH_RESPONDENT_EMAIL", false),
+		MaxQuestions:             envInt("MAX_QUESTIONS", 200),
+		MaxAnswers:               envInt("MAX_ANSWERS", 50),
+		TokenLength:              envInt("TOKEN_LENGTH", 5),
+		TokenAlphabet:            envString("TOKEN_ALPHABET", "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"),
+		AdminAPIKey:              os.Getenv("ADMIN_API_KEY"),
+		JWTSecret:                jwtSecret(),
+		AdminUsername:            envString("ADMIN_USERNAME", "admin"),
+		AdminPassword:            os.Getenv("ADMIN_PASSWORD"),
+		GoogleClientId:           os.Getenv("GOOGLE_CLIENT_ID"),
+		GoogleClientSecret:       os.Getenv("GOOGLE_CLIENT_SECRET"),
+		GoogleRedirectURL:        envString("GOOGLE_REDIRECT_URL", "http://localhost:5050/auth/google/callback"),
+		PartialResponseDays:      envInt("PARTIAL_RESPONSE_DAYS", 30),
+		TrustProxyHeaders:        envBool("TRUST_PROXY_HEADERS", false),
+		TrustedProxyHops:         envInt("TRUSTED_PROXY_HOPS", 1),
+		RequireRespondentSession: envBool("REQUIRE_RESPONDENT_SESSION", false),
+		GeoIPDatabase:            os.Getenv("GEOIP_DATABASE"),
+		IPHashKey:                []byte(os.Getenv("IP_HASH_KEY")),
+		CaptchaProvider:          envString("CAPTCHA_PROVIDER", "recaptcha"),
+		CaptchaSiteKey:           os.Getenv("CAPTCHA_SITE_KEY"),
+		CaptchaSecret:            os.Getenv("CAPTCHA_SECRET"),
+		RateLimit:                envBool("RATE_LIMIT", true),
+		SubmitRateLimit:          envInt("SUBMIT_RATE_LIMIT", 30),
+		CreateRateLimit:          envInt("CREATE_RATE_LIMIT", 10),
+		RateLimitBurst:           envInt("RATE_LIMIT_BURST", 10),
+		WebhookWorkers:           envInt("WEBHOOK_WORKERS", 4),
+		WebhookMaxAttempts:       envInt("WEBHOOK_MAX_ATTEMPTS", 8),
+		EventBus:                 os.Getenv("EVENT_BUS"),
+		EventBusURL:              os.Getenv("EVENT_BUS_URL"),
+		EventBusPrefix:           envString("EVENT_BUS_PREFIX", "osp"),
+		SMTPHost:                 os.Getenv("SMTP_HOST"),
+		SMTPPort:                 envInt("SMTP_PORT", 587),
+		SMTPUsername:             os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:             os.Getenv("SMTP_PASSWORD"),
+		SMTPFrom:                 os.Getenv("SMTP_FROM"),
+	}
+}
+
+// JWT_SECRET, or a random secret when unset so tokens do not survive a restart
+func jwtSecret() []byte {
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	log.Println("JWT_SECRET is not set, using a random secret, issued tokens become invalid on restart")
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return secret
+}
+
+func envBool(key string, fallback bool) bool {
+	v, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return v
+}
+
+func envString(key string, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func envInt(key string, fallback int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || v < 1 {
+		return fallback
+	}
+	return v
+}
+
+// client options for the configured write concern and read preference
+func (c Config) clientOptions(uri string) (*options.ClientOptions, error) {
+	opts := options.Client().ApplyURI(uri)
+	if c.WriteConcern != "" {
+		wc := &writeconcern.WriteConcern{W: c.WriteConcern}
+		if n, err := strconv.Atoi(c.WriteConcern); err == nil {
+			wc.W = n
+		}
+		opts.SetWriteConcern(wc)
+	}
+	if c.ReadPreference != "" {
+		mode, err := readpref.ModeFromString(c.ReadPreference)
+		if err != nil {
+			return nil, err
+		}
+		rp, err := readpref.New(mode)
+		if err != nil {
+			return nil, err
+		}
+		opts.SetReadPreference(rp)
+	}
+	return opts, nil
+}
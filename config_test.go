@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
+)
+
+func TestClientOptions(t *testing.T) {
+	opts, err := Config{WriteConcern: "majority", ReadPreference: "secondaryPreferred"}.clientOptions("mongodb://localhost:27017")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.WriteConcern == nil || opts.WriteConcern.W != "majority" {
+		t.Errorf("write concern = %+v, want majority", opts.WriteConcern)
+	}
+	if opts.ReadPreference == nil || opts.ReadPreference.Mode() != readpref.SecondaryPreferredMode {
+		t.Errorf("read preference = %v, want secondaryPreferred", opts.ReadPreference)
+	}
+
+	opts, err = Config{WriteConcern: "2"}.clientOptions("mongodb://localhost:27017")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.WriteConcern == nil || opts.WriteConcern.W != 2 {
+		t.Errorf("write concern = %+v, want 2 nodes", opts.WriteConcern)
+	}
+
+	opts, err = Config{}.clientOptions("mongodb://localhost:27017")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.WriteConcern != nil || opts.ReadPreference != nil {
+		t.Errorf("unset config changed the driver defaults: %+v, %v", opts.WriteConcern, opts.ReadPreference)
+	}
+
+	if _, err := (Config{ReadPreference: "fastest"}).clientOptions("mongodb://localhost:27017"); err == nil {
+		t.Error("an unknown read preference was accepted")
+	}
+}
+
+func TestIPHashKey(t *testing.T) {
+	keepConfig(t)
+	config.JWTSecret = []byte("signing secret")
+	config.IPHashKey = nil
+	derived := ipHashKey()
+	if bytes.Equal(derived, config.JWTSecret) {
+		t.Error("the address hash key is the token signing key")
+	}
+	if a, b := hashIP("203.0.113.7"), hashIP("203.0.113.7"); a != b {
+		t.Errorf("hashes of one address differ: %s and %s", a, b)
+	}
+
+	config.IPHashKey = []byte("hash key")
+	if key := ipHashKey(); !bytes.Equal(key, config.IPHashKey) {
+		t.Errorf("key = %q, want IP_HASH_KEY", key)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// longest edit window a survey can give its respondents, a week
+const maxEditWindowMinutes = 7 * 24 * 60
+
+// minutes respondents may change their submission for, 0 when they can not
+func (s Survey) editWindow() int {
+	if s.EditWindowMinutes == nil {
+		return 0
+	}
+	return *s.EditWindowMinutes
+}
+
+// give the respondent of a submission a token to change it during the edit window of the survey,
+// in the X-Edit-Token header. the token is a JWT of type "edit" naming the survey and the respondent
+func setEditToken(w http.ResponseWriter, survey Survey, userId bson.ObjectID) {
+	window := survey.editWindow()
+	if window == 0 {
+		return
+	}
+	now := time.Now()
+	token, err := signJWT(Claims{survey.Id.Hex() + "/" + userId.Hex(), "edit", now.Unix(), now.Add(time.Duration(window) * time.Minute).Unix()})
+	if err != nil {
+		panic(err)
+	}
+	w.Header().Set("X-Edit-Token", token)
+}
+
+// replace the responses of a submission with the edit token given when it was submitted
+func editOwnResponses(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("edit own responses")
+	id, err := bson.ObjectIDFromHex(mux.Vars(r)["survey_id"])
+	if err != nil {
+		http.Error(w, "Invalid Survey Id", http.StatusBadRequest)
+		return
+	}
+	token := r.Header.Get("X-Edit-Token")
+	if token == "" {
+		http.Error(w, "Unauthorized, the X-Edit-Token header is required", http.StatusUnauthorized)
+		return
+	}
+	claims, err := parseJWT(token, "edit")
+	if err != nil {
+		http.Error(w, "Unauthorized, "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+	surveyHex, userHex, _ := strings.Cut(claims.Subject, "/")
+	userId, err := bson.ObjectIDFromHex(userHex)
+	if err != nil || surveyHex != id.Hex() {
+		http.Error(w, "Unauthorized, the edit token is not for this survey", http.StatusUnauthorized)
+		return
+	}
+
+	survey, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+	// tokens issued before the window was closed no longer work
+	if survey.editWindow() == 0 {
+		http.Error(w, "the survey does not allow editing responses", http.StatusForbidden)
+		return
+	}
+	if !isAcceptingResponses(w, survey) {
+		return
+	}
+	var submission SubmissionInput
+	if err := json.NewDecoder(r.Body).Decode(&submission); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	replaceResponses(w, survey, userId, submission)
+}
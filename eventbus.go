@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// events published on the event bus, besides EventResponseSubmitted
+const (
+	EventSurveyCreated = "survey.created"
+	EventSurveyUpdated = "survey.updated"
+)
+
+// publishes an event body under a subject, the NATS subject or Kafka topic. key keeps the events of one
+// survey in order on buses partitioning by key
+type eventPublisher interface {
+	publish(subject, key string, body []byte) error
+}
+
+type busEvent struct {
+	subject string
+	key     string
+	body    []byte
+}
+
+// events waiting to be published. nil while no event bus is configured
+var eventQueue chan busEvent
+
+// events waiting to be published at most, and how long an event waits for room in a full queue
+const (
+	eventQueueSize = 1000
+	eventQueueWait = 2 * time.Second
+)
+
+// connect to the configured event bus and publish queued events, in order, until the process exits
+func startEventBus() {
+	var publisher eventPublisher
+	switch config.EventBus {
+	case "":
+		return
+	case "nats":
+		u, err := url.Parse(config.EventBusURL)
+		if err != nil || u.Scheme != "nats" || u.Host == "" {
+			log.Fatal("EVENT_BUS_URL should be a nats:// URL like nats://localhost:4222")
+		}
+		publisher, err = newNatsPublisher(config.EventBusURL)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "kafka":
+		brokers := strings.Split(config.EventBusURL, ",")
+		for i, broker := range brokers {
+			brokers[i] = strings.TrimSpace(broker)
+			if brokers[i] == "" || strings.Contains(brokers[i], "/") {
+				log.Fatal("EVENT_BUS_URL should list the Kafka brokers like localhost:9092,localhost:9093")
+			}
+		}
+		publisher = newKafkaPublisher(brokers)
+	default:
+		log.Fatalf("unknown EVENT_BUS %q, expected nats or kafka", config.EventBus)
+	}
+	eventQueue = make(chan busEvent, eventQueueSize)
+	go func() {
+		for e := range eventQueue {
+			if err := publisher.publish(e.subject, e.key, e.body); err != nil {
+				eventBusFailures.WithLabelValues("publish_failed").Inc()
+				log.Printf("publishing %s to %s failed: %v", e.subject, config.EventBus, err)
+			}
+		}
+	}()
+}
+
+// queue an event of a survey for the event bus. the body is the envelope webhooks get. while the queue
+// is full the request waits up to eventQueueWait for room, events still not fitting are reported in
+// the log and the event_bus_failures_total metric
+func publishEvent(surveyId bson.ObjectID, event string, data any) {
+	if eventQueue == nil {
+		return
+	}
+	body, err := json.Marshal(WebhookPayload{bson.NewObjectID(), event, surveyId, time.Now(), data})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	subject := event
+	if config.EventBusPrefix != "" {
+		subject = config.EventBusPrefix + "." + event
+	}
+	e := busEvent{subject, surveyId.Hex(), body}
+	select {
+	case eventQueue <- e:
+		return
+	default:
+	}
+	timer := time.NewTimer(eventQueueWait)
+	defer timer.Stop()
+	select {
+	case eventQueue <- e:
+	case <-timer.C:
+		eventBusFailures.WithLabelValues("queue_full").Inc()
+		log.Printf("event queue is full, %s of survey %s not published", subject, surveyId.Hex())
+	}
+}
+
+// publisher of NATS core messages, the client reconnects by itself and buffers the messages published
+// while it is disconnected
+type natsPublisher struct {
+	conn *nats.Conn
+}
+
+func newNatsPublisher(url string) (*natsPublisher, error) {
+	conn, err := nats.Connect(url,
+		nats.Name("OSP_backend"),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.Println("nats: disconnected:", err)
+			}
+		}),
+		nats.ReconnectHandler(func(*nats.Conn) { log.Println("nats: reconnected") }),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &natsPublisher{conn}, nil
+}
+
+// NATS has no keys, events are published in order on one connection
+func (p *natsPublisher) publish(subject, key string, body []byte) error {
+	return p.conn.Publish(subject, body)
+}
+
+// publisher producing to the Kafka brokers, keyed so the events of a survey stay on one partition
+type kafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+// longest wait for the brokers to acknowledge an event, retries included
+const kafkaTimeout = 10 * time.Second
+
+func newKafkaPublisher(brokers []string) *kafkaPublisher {
+	return &kafkaPublisher{&kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		// events are written one at a time, in order, so batches are not waited for
+		BatchTimeout: 10 * time.Millisecond,
+		WriteTimeout: kafkaTimeout,
+	}}
+}
+
+func (p *kafkaPublisher) publish(topic, key string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), kafkaTimeout)
+	defer cancel()
+	return p.writer.WriteMessages(ctx, kafka.Message{Topic: topic, Key: []byte(key), Value: body})
+}
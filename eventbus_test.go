@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestPublishEventWaitsForRoom(t *testing.T) {
+	keepConfig(t)
+	config.EventBusPrefix = "osp"
+	queue := eventQueue
+	eventQueue = make(chan busEvent, 1)
+	t.Cleanup(func() { eventQueue = queue })
+
+	surveyId := bson.NewObjectID()
+	publishEvent(surveyId, EventSurveyCreated, nil)
+	// the queue is full, the next event waits until the first one is taken
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		<-eventQueue
+	}()
+	publishEvent(surveyId, EventSurveyUpdated, nil)
+
+	select {
+	case e := <-eventQueue:
+		var payload WebhookPayload
+		if err := json.Unmarshal(e.body, &payload); err != nil {
+			t.Fatal(err)
+		}
+		if e.subject != "osp.survey.updated" || e.key != surveyId.Hex() || payload.Event != EventSurveyUpdated {
+			t.Errorf("queued %s keyed %s with event %s, want osp.survey.updated keyed by the survey", e.subject, e.key, payload.Event)
+		}
+	default:
+		t.Fatal("the event waiting for room was not queued")
+	}
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// question column of an export, Matrix questions get one column per row
+type exportColumn struct {
+	QuestionId bson.ObjectID
+	RowId      bson.ObjectID
+	Title      string
+}
+
+func (c exportColumn) key() answerKey {
+	return answerKey{c.QuestionId, c.RowId}
+}
+
+// column title of a question, or of one row of a Matrix question
+func columnTitle(questionTitle, rowTitle string) string {
+	if rowTitle == "" {
+		return questionTitle
+	}
+	return questionTitle + " - " + rowTitle
+}
+
+// answers of one respondent, pivoted by question
+type respondentRow struct {
+	UserId          bson.ObjectID
+	RespondentEmail string
+	SubmittedAt     time.Time // earliest created_at of the respondent's responses
+	Answers         map[answerKey]string
+}
+
+// one column per question of the survey, followed by questions that were removed from the survey
+// but still have responses, titled as the respondents saw them
+func exportColumns(ctx context.Context, survey Survey) ([]exportColumn, error) {
+	columns := make([]exportColumn, 0, len(survey.Questions))
+	current := make(map[answerKey]bool, len(survey.Questions))
+	for _, q := range survey.Questions {
+		if q.QuestionType != "Matrix" {
+			columns = append(columns, exportColumn{q.Id, bson.ObjectID{}, q.QuestionTitle})
+			current[answerKey{QuestionId: q.Id}] = true
+			continue
+		}
+		for _, row := range q.Rows {
+			columns = append(columns, exportColumn{q.Id, row.Id, columnTitle(q.QuestionTitle, row.Title)})
+			current[answerKey{q.Id, row.Id}] = true
+		}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"survey_id": survey.Id}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":       bson.M{"question_id": "$question_id", "row_id": "$row_id"},
+			"title":     bson.M{"$first": "$question_snapshot.question_title"},
+			"row_title": bson.M{"$first": "$question_snapshot.row_title"},
+			"first":     bson.M{"$min": "$created_at"},
+		}}},
+		{{Key: "$sort", Value: bson.M{"first": 1}}},
+	}
+	cursor, err := responsesCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var answered []struct {
+		Id struct {
+			QuestionId bson.ObjectID `bson:"question_id"`
+			RowId      bson.ObjectID `bson:"row_id"`
+		} `bson:"_id"`
+		Title    string `bson:"title"`
+		RowTitle string `bson:"row_title"`
+	}
+	if err = cursor.All(ctx, &answered); err != nil {
+		return nil, err
+	}
+	for _, q := range answered {
+		if current[answerKey{q.Id.QuestionId, q.Id.RowId}] {
+			continue
+		}
+		title := q.Title
+		if title == "" {
+			title = "question " + q.Id.QuestionId.Hex()
+		}
+		if !q.Id.RowId.IsZero() && q.RowTitle == "" {
+			q.RowTitle = "row " + q.Id.RowId.Hex()
+		}
+		columns = append(columns, exportColumn{q.Id.QuestionId, q.Id.RowId, columnTitle(title, q.RowTitle) + " (removed)"})
+	}
+	return columns, nil
+}
+
+// responses of a survey matching filter, pivoted into one row per respondent and passed to fn in user_id order.
+// stops early when fn returns false
+func forEachRespondent(ctx context.Context, filter bson.M, fn func(row respondentRow) bool) error {
+	fOpt := options.Find().SetSort(bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: 1}})
+	cursor, err := responsesCollection.Find(ctx, filter, fOpt)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var row *respondentRow
+	for cursor.Next(ctx) {
+		var response Response
+		if err := cursor.Decode(&response); err != nil {
+			return err
+		}
+		if row != nil && row.UserId != response.UserId {
+			if !fn(*row) {
+				return nil
+			}
+			row = nil
+		}
+		if row == nil {
+			row = &respondentRow{
+				UserId:      response.UserId,
+				SubmittedAt: response.CreatedAt,
+				Answers:     make(map[answerKey]string),
+			}
+		}
+		if response.RespondentEmail != "" {
+			row.RespondentEmail = response.RespondentEmail
+		}
+		text := response.ResponseText
+		if response.OtherText != "" {
+			text += ": " + response.OtherText
+		}
+		row.Answers[answerKey{response.QuestionId, response.RowId}] = text
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	if row != nil {
+		fn(*row)
+	}
+	return nil
+}
+
+// responses of a survey, limited by the optional from and to query parameters
+func exportFilter(r *http.Request, surveyId bson.ObjectID) (bson.M, error) {
+	// text answers held for review, or rejected by it, are kept out of results
+	filter := bson.M{"survey_id": surveyId, "moderation": bson.M{"$nin": bson.A{ModerationPending, ModerationRejected}}}
+	createdAt, err := parseTimeRange(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(createdAt) > 0 {
+		filter["created_at"] = createdAt
+	}
+	return filter, nil
+}
+
+// spreadsheets run cells starting with these characters as formulas
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// export responses of a survey as CSV, one row per respondent and one column per question
+func exportResponsesCSV(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("export responses csv")
+	id, _ := bson.ObjectIDFromHex(mux.Vars(r)["survey_id"])
+	survey, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+
+	filter, err := exportFilter(r, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), streamTimeout)
+	defer cancel()
+
+	columns, err := exportColumns(ctx, survey)
+	if err != nil {
+		panic(err)
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"survey-%s-responses.csv\"", survey.Token))
+	flusher, _ := w.(http.Flusher)
+	writer := csv.NewWriter(w)
+
+	header := []string{"user_id", "respondent_email", "submitted_at"}
+	for _, c := range columns {
+		header = append(header, csvSafe(c.Title))
+	}
+	writer.Write(header)
+
+	count := 0
+	err = forEachRespondent(ctx, filter, func(row respondentRow) bool {
+		record := []string{row.UserId.Hex(), csvSafe(row.RespondentEmail), row.SubmittedAt.UTC().Format(time.RFC3339)}
+		for _, c := range columns {
+			record = append(record, csvSafe(row.Answers[c.key()]))
+		}
+		if err := writer.Write(record); err != nil {
+			// the client has gone away, nothing more can be sent
+			log.Println(err)
+			return false
+		}
+		count++
+		if count%streamFlushSize == 0 {
+			writer.Flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return true
+	})
+	if err != nil {
+		log.Println(err)
+	}
+	writer.Flush()
+}
+
+// export responses of a survey as an Excel workbook with a raw data sheet and a per-question summary sheet
+func exportResponsesXLSX(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("export responses xlsx")
+	id, _ := bson.ObjectIDFromHex(mux.Vars(r)["survey_id"])
+	survey, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+
+	filter, err := exportFilter(r, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), streamTimeout)
+	defer cancel()
+
+	columns, err := exportColumns(ctx, survey)
+	if err != nil {
+		panic(err)
+	}
+	counts, err := answerCounts(ctx, filter)
+	if err != nil {
+		panic(err)
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"survey-%s-responses.xlsx\"", survey.Token))
+
+	err = writeXLSX(w, []string{"Responses", "Summary"}, func(i int, sheet *xlsxSheet) error {
+		if i == 0 {
+			return writeResponsesSheet(ctx, sheet, filter, columns)
+		}
+		return writeSummarySheet(sheet, survey, columns, counts)
+	})
+	if err != nil {
+		// headers are gone already, the client gets a broken file
+		log.Println(err)
+	}
+}
+
+// one row per respondent and one column per question, like the CSV export
+func writeResponsesSheet(ctx context.Context, sheet *xlsxSheet, filter bson.M, columns []exportColumn) error {
+	header := []string{"user_id", "respondent_email", "submitted_at"}
+	for _, c := range columns {
+		header = append(header, c.Title)
+	}
+	if err := sheet.writeHeader(header...); err != nil {
+		return err
+	}
+	err := forEachRespondent(ctx, filter, func(row respondentRow) bool {
+		cells := []xlsxCell{
+			{Value: row.UserId.Hex()},
+			{Value: row.RespondentEmail},
+			{Value: row.SubmittedAt.UTC().Format(time.RFC3339)},
+		}
+		for _, c := range columns {
+			cells = append(cells, xlsxCell{Value: row.Answers[c.key()]})
+		}
+		return sheet.writeRow(cells...) == nil
+	})
+	if err != nil {
+		return err
+	}
+	return sheet.err
+}
+
+// count and share of every answer option, text questions only get the number of answers
+func writeSummarySheet(sheet *xlsxSheet, survey Survey, columns []exportColumn, counts map[answerKey]map[string]int) error {
+	if err := sheet.writeHeader("Question", "Answer", "Count", "Percentage"); err != nil {
+		return err
+	}
+	questions := make(map[bson.ObjectID]Question, len(survey.Questions))
+	for _, q := range survey.Questions {
+		questions[q.Id] = q
+	}
+	for _, c := range columns {
+		answers := counts[c.key()]
+		total := 0
+		for _, n := range answers {
+			total += n
+		}
+		q, current := questions[c.QuestionId]
+		options := q.options()
+		// every row of a Matrix question shares the question's answers
+		if q.QuestionType == "Matrix" && q.rowTitle(c.RowId) != "" {
+			options = q.Answers
+		}
+		if !current || options == nil {
+			if err := sheet.writeRow(xlsxCell{Value: c.Title}, xlsxCell{Value: "(answers)"}, xlsxCell{Value: total}); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, option := range options {
+			share := 0.0
+			if total > 0 {
+				share = float64(answers[option]) / float64(total)
+			}
+			cells := []xlsxCell{{Value: c.Title}, {Value: option}, {Value: answers[option]}, {Value: share, Style: xlsxStylePercent}}
+			if err := sheet.writeRow(cells...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
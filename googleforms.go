@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// form as returned by the Google Forms API (forms.get), only the fields the importer reads
+type GoogleForm struct {
+	Info struct {
+		Title         string `json:"title"`
+		DocumentTitle string `json:"documentTitle"`
+		Description   string `json:"description"`
+	} `json:"info"`
+	Items []GoogleFormItem `json:"items"`
+}
+
+type GoogleFormItem struct {
+	Title        string `json:"title"`
+	QuestionItem *struct {
+		Question GoogleFormQuestion `json:"question"`
+	} `json:"questionItem"`
+	QuestionGroupItem *struct {
+		Questions []GoogleFormQuestion `json:"questions"`
+		Grid      *struct {
+			Columns GoogleFormChoice `json:"columns"`
+		} `json:"grid"`
+	} `json:"questionGroupItem"`
+}
+
+type GoogleFormQuestion struct {
+	Required       bool              `json:"required"`
+	ChoiceQuestion *GoogleFormChoice `json:"choiceQuestion"`
+	TextQuestion   *struct{}         `json:"textQuestion"`
+	ScaleQuestion  *struct {
+		Low       int    `json:"low"`
+		High      int    `json:"high"`
+		LowLabel  string `json:"lowLabel"`
+		HighLabel string `json:"highLabel"`
+	} `json:"scaleQuestion"`
+	RatingQuestion *struct {
+		RatingScaleLevel int `json:"ratingScaleLevel"`
+	} `json:"ratingQuestion"`
+	DateQuestion       *struct{} `json:"dateQuestion"`
+	TimeQuestion       *struct{} `json:"timeQuestion"`
+	FileUploadQuestion *struct{} `json:"fileUploadQuestion"`
+	RowQuestion        *struct {
+		Title string `json:"title"`
+	} `json:"rowQuestion"`
+}
+
+type GoogleFormChoice struct {
+	Type    string `json:"type"` // RADIO, CHECKBOX or DROP_DOWN
+	Options []struct {
+		Value   string `json:"value"`
+		IsOther bool   `json:"isOther"`
+	} `json:"options"`
+}
+
+// form item that has no equivalent question type and was left out
+type SkippedFormItem struct {
+	Title  string `json:"title"`
+	Reason string `json:"reason"`
+}
+
+// survey created by a form importer and the items it had to leave out
+type FormImportResult struct {
+	Survey  Survey            `json:"survey"`
+	Skipped []SkippedFormItem `json:"skipped"`
+}
+
+// map a Google form onto a survey, items without a matching question type are reported as skipped
+func (f GoogleForm) survey() (Survey, []SkippedFormItem) {
+	survey := Survey{Title: f.Info.Title, Questions: []Question{}}
+	if survey.Title == "" {
+		survey.Title = f.Info.DocumentTitle
+	}
+	if description := f.Info.Description; description != "" {
+		survey.WelcomeMessage = &description
+	}
+	skipped := []SkippedFormItem{}
+	for _, item := range f.Items {
+		switch {
+		case item.QuestionItem != nil:
+			q, reason := item.QuestionItem.Question.question(item.Title)
+			if reason != "" {
+				skipped = append(skipped, SkippedFormItem{item.Title, reason})
+				continue
+			}
+			survey.Questions = append(survey.Questions, q)
+		case item.QuestionGroupItem != nil && item.QuestionGroupItem.Grid != nil:
+			columns := item.QuestionGroupItem.Grid.Columns
+			// every row of a grid becomes a question of its own
+			for _, row := range item.QuestionGroupItem.Questions {
+				title := item.Title
+				if row.RowQuestion != nil {
+					title += " - " + row.RowQuestion.Title
+				}
+				q, reason := GoogleFormQuestion{Required: row.Required, ChoiceQuestion: &columns}.question(title)
+				if reason != "" {
+					skipped = append(skipped, SkippedFormItem{title, reason})
+					continue
+				}
+				survey.Questions = append(survey.Questions, q)
+			}
+		case item.QuestionGroupItem != nil:
+			skipped = append(skipped, SkippedFormItem{item.Title, "question groups without a grid are not supported"})
+		}
+		// page breaks, text, images and videos carry no question
+	}
+	return survey, skipped
+}
+
+// map a single Google Forms question, returns the reason when it cannot be mapped
+func (g GoogleFormQuestion) question(title string) (Question, string) {
+	q := Question{QuestionTitle: title}
+	switch {
+	case g.ChoiceQuestion != nil:
+		q.QuestionType = "Multiple Choice"
+		if g.ChoiceQuestion.Type == "CHECKBOX" {
+			q.QuestionType = "Checkbox"
+		}
+		for _, option := range g.ChoiceQuestion.Options {
+			if option.IsOther {
+				q.Answers = append(q.Answers, "Other")
+				if q.QuestionType == "Multiple Choice" {
+					q.OtherOption = "Other"
+				}
+				continue
+			}
+			q.Answers = append(q.Answers, option.Value)
+		}
+	case g.TextQuestion != nil:
+		q.QuestionType = "Textbox"
+	case g.TimeQuestion != nil:
+		q.QuestionType = "Time"
+	case g.DateQuestion != nil:
+		q.QuestionType = "Date"
+	case g.ScaleQuestion != nil:
+		scale := g.ScaleQuestion
+		q = scaleQuestion(title, scale.Low, scale.High, scale.LowLabel, scale.HighLabel)
+	case g.RatingQuestion != nil:
+		q.QuestionType = "Rating"
+		q.ScaleMin, q.ScaleMax = 1, g.RatingQuestion.RatingScaleLevel
+	case g.FileUploadQuestion != nil:
+		return q, "file upload questions are not supported"
+	default:
+		return q, "unknown question type"
+	}
+	q.Required = g.Required
+	return q, ""
+}
+
+// question with one answer per point from low to high, scored by the point's value.
+// Likert scales need an odd number of points, even scales are imported as multiple choice
+func scaleQuestion(title string, low, high int, lowLabel, highLabel string) Question {
+	q := Question{QuestionTitle: title, QuestionType: "Multiple Choice"}
+	for v := low; v <= high; v++ {
+		answer := strconv.Itoa(v)
+		if v == low && lowLabel != "" {
+			answer += " (" + lowLabel + ")"
+		}
+		if v == high && highLabel != "" {
+			answer += " (" + highLabel + ")"
+		}
+		q.Answers = append(q.Answers, answer)
+		q.Scores = append(q.Scores, float64(v))
+	}
+	if len(q.Answers)%2 == 1 {
+		q.QuestionType = "Likert Scale"
+	}
+	return q
+}
+
+// create a new draft from a Google Forms API export
+func importGoogleForm(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("import google form")
+	var form GoogleForm
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	survey, skipped := form.survey()
+	storeImportedForm(w, r, survey, skipped)
+}
+
+// validate and store a survey mapped by a form importer, the skipped items are reported back
+func storeImportedForm(w http.ResponseWriter, r *http.Request, survey Survey, skipped []SkippedFormItem) {
+	if msg := checkSurveyLimits(survey); msg != "" {
+		http.Error(w, "Failed to import survey, "+msg, http.StatusBadRequest)
+		return
+	}
+	if errs := validateSurvey(survey, false); len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := insertNewSurvey(ctx, r, &survey); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(FormImportResult{Survey: survey, Skipped: skipped})
+}
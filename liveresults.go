@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// message of the live results channel
+type LiveResults struct {
+	Type    string           `json:"type"` // snapshot with every question once connected, then update with the questions that got answers
+	Results []QuestionResult `json:"results"`
+}
+
+// updates are sent at most this often, answers coming in between are sent together
+const liveResultsInterval = time.Second
+
+// longest wait for a message to be written, and largest message accepted from clients, which only
+// send control frames
+const (
+	wsWriteTimeout = 10 * time.Second
+	wsMaxMessage   = 4096
+)
+
+// clients authenticate with their access token instead of cookies, so connections from any origin are
+// accepted like other requests
+var liveResultsUpgrader = websocket.Upgrader{
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// browsers can not set headers on WebSocket connections, so they pass their access token as access_token
+func tokenFromQuery(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token := r.URL.Query().Get("access_token"); token != "" && r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		next(w, r)
+	}
+}
+
+// send the results of a survey over a WebSocket, then the results of every question again as it gets
+// answers, for dashboards and live presentations
+func getLiveResults(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get live results")
+	id, _ := bson.ObjectIDFromHex(mux.Vars(r)["survey_id"])
+	survey, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+	filter, err := exportFilter(r, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the stream is opened before the first results are counted, so no answer falls in between
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"operationType":           "insert",
+			"fullDocument.survey_id":  id,
+			"fullDocument.moderation": bson.M{"$nin": bson.A{ModerationPending, ModerationRejected}},
+		}}},
+		{{Key: "$project", Value: bson.M{"fullDocument.question_id": 1}}},
+	}
+	stream, err := responsesCollection.Watch(ctx, pipeline)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "live results need MongoDB to run as a replica set", http.StatusServiceUnavailable)
+		return
+	}
+	// the upgrader writes the error response of requests that are not WebSocket handshakes
+	conn, err := liveResultsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		stream.Close(ctx)
+		return
+	}
+	defer conn.Close()
+
+	// the client closing the connection ends the channel. reading answers its pings and close frames,
+	// anything else it sends is ignored
+	conn.SetReadLimit(wsMaxMessage)
+	go func() {
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				break
+			}
+		}
+		cancel()
+	}()
+	answered := make(chan bson.ObjectID)
+	go func() {
+		defer close(answered)
+		defer stream.Close(context.Background())
+		for stream.Next(ctx) {
+			var change struct {
+				FullDocument struct {
+					QuestionId bson.ObjectID `bson:"question_id"`
+				} `bson:"fullDocument"`
+			}
+			if err := stream.Decode(&change); err != nil {
+				log.Println(err)
+				continue
+			}
+			select {
+			case answered <- change.FullDocument.QuestionId:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	send := func(kind string, questions []Question) bool {
+		ctx, cancel := context.WithTimeout(ctx, streamTimeout)
+		defer cancel()
+		questionFilter := maps.Clone(filter)
+		if kind == "update" {
+			ids := make(bson.A, 0, len(questions))
+			for _, q := range questions {
+				ids = append(ids, q.Id)
+			}
+			questionFilter["question_id"] = bson.M{"$in": ids}
+		}
+		results, err := surveyResults(ctx, questions, questionFilter)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Println(err)
+			}
+			return false
+		}
+		message, err := json.Marshal(LiveResults{kind, results})
+		if err != nil {
+			log.Println(err)
+			return false
+		}
+		conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		return conn.WriteMessage(websocket.TextMessage, message) == nil
+	}
+	if !send("snapshot", survey.Questions) {
+		return
+	}
+
+	ticker := time.NewTicker(liveResultsInterval)
+	defer ticker.Stop()
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	touched := make(map[bson.ObjectID]bool)
+	for {
+		select {
+		case questionId, ok := <-answered:
+			if !ok {
+				return
+			}
+			touched[questionId] = true
+		case <-ticker.C:
+			if len(touched) == 0 {
+				continue
+			}
+			// in the order of the survey, questions added since connecting are left out
+			var questions []Question
+			for _, q := range survey.Questions {
+				if touched[q.Id] {
+					questions = append(questions, q)
+				}
+			}
+			clear(touched)
+			if len(questions) > 0 && !send("update", questions) {
+				return
+			}
+		case <-heartbeat.C:
+			if conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)) != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
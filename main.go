@@ -1,14 +1,23 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"math/rand"
+	"math/big"
 	"net/http"
+	"net/mail"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -18,43 +27,392 @@ import (
 	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // types
 type Survey struct {
-	Id        bson.ObjectID `json:"id" bson:"_id"`
-	Token     string        `json:"token" bson:"token"`
-	CreatedAt time.Time     `json:"created_at" bson:"created_at"`
-	UpdatedAt time.Time     `json:"updated_at" bson:"updated_at"`
-	Title     string        `json:"title" bson:"title"`
-	Questions []Question    `json:"questions,omitempty" bson:"questions"`
+	Id                       bson.ObjectID          `json:"id" bson:"_id"`
+	OwnerId                  bson.ObjectID          `json:"owner_id,omitempty" bson:"owner_id,omitempty"` // author who created the survey, unset for surveys created by the admin
+	Token                    string                 `json:"token" bson:"token"`
+	CreatedAt                time.Time              `json:"created_at" bson:"created_at"`
+	UpdatedAt                time.Time              `json:"updated_at" bson:"updated_at"`
+	Title                    string                 `json:"title" bson:"title"`
+	Questions                []Question             `json:"questions,omitempty" bson:"questions"`
+	Sections                 []Section              `json:"sections,omitempty" bson:"sections,omitempty"`                                       // pages of the survey in order, see pages
+	Version                  int                    `json:"version" bson:"version"`                                                             // incremented on every update, surveys created before versioning are 0
+	Anonymous                *bool                  `json:"anonymous,omitempty" bson:"anonymous,omitempty"`                                     // identified surveys require a respondent email, unset means anonymous
+	AllowEdit                *bool                  `json:"allow_edit,omitempty" bson:"allow_edit,omitempty"`                                   // respondents may replace their submitted responses
+	EditWindowMinutes        *int                   `json:"edit_window_minutes,omitempty" bson:"edit_window_minutes,omitempty"`                 // respondents may change their submission this long after submitting it, with the edit token they got
+	OneResponsePerRespondent *bool                  `json:"one_response_per_respondent,omitempty" bson:"one_response_per_respondent,omitempty"` // repeated submissions of a respondent are rejected, see respondentKey
+	CollectMetadata          *bool                  `json:"collect_metadata,omitempty" bson:"collect_metadata,omitempty"`                       // store hashed address, country and time zone of respondents, see RespondentMetadata
+	RequireCaptcha           *bool                  `json:"require_captcha,omitempty" bson:"require_captcha,omitempty"`                         // submissions must pass the configured captcha, see checkCaptcha
+	BotDetection             *BotDetection          `json:"bot_detection,omitempty" bson:"bot_detection,omitempty"`                             // honeypot and completion time checks, see checkBotFlags
+	MaxSubmissionsPerMinute  *int                   `json:"max_submissions_per_minute,omitempty" bson:"max_submissions_per_minute,omitempty"`   // submissions accepted per minute, unset or 0 means no limit, see throttleSubmission
+	ModerateText             *bool                  `json:"moderate_text,omitempty" bson:"moderate_text,omitempty"`                             // text answers with profanity or personal data are held for review, see screenResponse
+	Notifications            *Notifications         `json:"notifications,omitempty" bson:"notifications,omitempty"`                             // the owner is emailed about responses, see notifySubmission
+	Status                   string                 `json:"status" bson:"status"`                                                               // draft, published or closed, changed through the publish and close endpoints
+	ExpiresAt                *time.Time             `json:"expires_at,omitempty" bson:"expires_at,omitempty"`                                   // published surveys are closed automatically after this time
+	MaxResponses             *int                   `json:"max_responses,omitempty" bson:"max_responses,omitempty"`                             // submissions accepted at most, unset or 0 means no limit
+	ResponseCount            int                    `json:"response_count" bson:"response_count"`                                               // submissions accepted so far, maintained by submitResponse
+	DeletedAt                *time.Time             `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`                                   // set while the survey is in the trash
+	SummarySentAt            *time.Time             `json:"-" bson:"summary_sent_at,omitempty"`                                                 // last daily summary emailed, see sendDailySummaries
+	RandomizeQuestions       *bool                  `json:"randomize_questions,omitempty" bson:"randomize_questions,omitempty"`                 // every respondent gets the questions in their own order, see questionOrder
+	WelcomeMessage           *string                `json:"welcome_message,omitempty" bson:"welcome_message,omitempty"`                         // shown before the first question
+	ThankYouMessage          *string                `json:"thank_you_message,omitempty" bson:"thank_you_message,omitempty"`                     // shown once the responses are submitted
+	CompletionRedirectURL    *string                `json:"completion_redirect_url,omitempty" bson:"completion_redirect_url,omitempty"`         // where respondents are sent after submitting, http or https
+	Theme                    *Theme                 `json:"theme,omitempty" bson:"theme,omitempty"`                                             // colors, logo and font, see Theme
+	Language                 string                 `json:"language,omitempty" bson:"language,omitempty"`                                       // language of the texts of the survey, like en
+	Translations             map[string]Translation `json:"translations,omitempty" bson:"translations,omitempty"`                               // texts in other languages by language code, managed through the translation endpoints
+}
+
+// survey lifecycle, only published surveys accept responses
+const (
+	StatusDraft     = "draft"
+	StatusPublished = "published"
+	StatusClosed    = "closed"
+)
+
+func (s Survey) isFull() bool {
+	return s.MaxResponses != nil && *s.MaxResponses > 0 && s.ResponseCount >= *s.MaxResponses
+}
+
+func (s Survey) isExpired() bool {
+	return s.ExpiresAt != nil && !time.Now().Before(*s.ExpiresAt)
+}
+
+// surveys created before the lifecycle existed have no status and stay published
+func (s Survey) status() string {
+	if s.Status == "" {
+		return StatusPublished
+	}
+	return s.Status
 }
 
 // extra: for displaying a list of surveys as a entry point to lookup existing survey on frontend
 type SurveysList struct {
-	Token string `json:"token" bson:"token"`
-	Title string `json:"title" bson:"title"`
+	Token          string     `json:"token" bson:"token"`
+	Title          string     `json:"title" bson:"title"`
+	ResponseCount  int        `json:"response_count" bson:"response_count"`                         // respondents who submitted
+	LastResponseAt *time.Time `json:"last_response_at,omitempty" bson:"last_response_at,omitempty"` // unset without responses
 }
 
 type Question struct {
-	Id            bson.ObjectID `json:"id" bson:"_id"`
-	QuestionTitle string        `json:"question_title" bson:"question_title"`
-	QuestionType  string        `json:"question_type" bson:"question_type"`
-	Answers       []string      `json:"answers,omitempty" bson:"answers"`
+	Id             bson.ObjectID      `json:"id" bson:"_id"`
+	QuestionTitle  string             `json:"question_title" bson:"question_title"`
+	QuestionType   string             `json:"question_type" bson:"question_type"`
+	Answers        []string           `json:"answers,omitempty" bson:"answers"`
+	Scores         []float64          `json:"scores,omitempty" bson:"scores,omitempty"`                   // Likert Scale only: numeric value of each answer, in the same order
+	Required       bool               `json:"required,omitempty" bson:"required,omitempty"`               // submissions must answer it
+	MinSelections  int                `json:"min_selections,omitempty" bson:"min_selections,omitempty"`   // Checkbox only: fewest options to pick, at least 1
+	MaxSelections  int                `json:"max_selections,omitempty" bson:"max_selections,omitempty"`   // Checkbox only: most options to pick, 0 means all
+	ScaleMin       int                `json:"scale_min,omitempty" bson:"scale_min,omitempty"`             // Rating only: lowest rating
+	ScaleMax       int                `json:"scale_max,omitempty" bson:"scale_max,omitempty"`             // Rating only: highest rating, 1 to 5 when unset
+	Rows           []MatrixRow        `json:"rows,omitempty" bson:"rows,omitempty"`                       // Matrix only: every row is answered with one of the answers
+	MinDate        string             `json:"min_date,omitempty" bson:"min_date,omitempty"`               // Date only: earliest date accepted, 2006-01-02
+	MaxDate        string             `json:"max_date,omitempty" bson:"max_date,omitempty"`               // Date only: latest date accepted, 2006-01-02
+	MinValue       *float64           `json:"min_value,omitempty" bson:"min_value,omitempty"`             // Number only: lowest number accepted
+	MaxValue       *float64           `json:"max_value,omitempty" bson:"max_value,omitempty"`             // Number only: highest number accepted
+	Step           float64            `json:"step,omitempty" bson:"step,omitempty"`                       // Number only: numbers are min_value, or 0, plus a multiple of step
+	MaxFileSize    int64              `json:"max_file_size,omitempty" bson:"max_file_size,omitempty"`     // File Upload only: largest file in bytes, 10 MiB when unset
+	AllowedTypes   []string           `json:"allowed_types,omitempty" bson:"allowed_types,omitempty"`     // File Upload only: accepted MIME types, any when empty
+	OtherOption    string             `json:"other_option,omitempty" bson:"other_option,omitempty"`       // Multiple Choice only: the answer asking respondents to specify, e.g. "Other"
+	ShowIf         []DisplayCondition `json:"show_if,omitempty" bson:"show_if,omitempty"`                 // shown only when every condition holds
+	ShuffleAnswers bool               `json:"shuffle_answers,omitempty" bson:"shuffle_answers,omitempty"` // Multiple Choice, Checkbox and Ranking only: answers are listed in a different order for every respondent
+	PinnedAnswers  []string           `json:"pinned_answers,omitempty" bson:"pinned_answers,omitempty"`   // answers kept at the end when shuffling, e.g. "None of the above"
+	SectionId      bson.ObjectID      `json:"section_id,omitzero" bson:"section_id,omitempty"`            // section the question is on, the first one when unset
+}
+
+// row of a Matrix question
+type MatrixRow struct {
+	Id    bson.ObjectID `json:"id" bson:"_id"`
+	Title string        `json:"title" bson:"title"`
+}
+
+// what a response answers: a question, or one row of a Matrix question
+type answerKey struct {
+	QuestionId bson.ObjectID
+	RowId      bson.ObjectID // zero outside Matrix questions
+}
+
+// title of the row with the given id, "" when the question has no such row
+func (q Question) rowTitle(rowId bson.ObjectID) string {
+	for _, row := range q.Rows {
+		if row.Id == rowId {
+			return row.Title
+		}
+	}
+	return ""
+}
+
+// the question as a respondent answering it sees it, rowId is the answered row of a Matrix question
+func (q Question) snapshot(rowId bson.ObjectID) *QuestionSnapshot {
+	return &QuestionSnapshot{
+		QuestionTitle: q.QuestionTitle,
+		QuestionType:  q.QuestionType,
+		Answers:       q.Answers,
+		RowTitle:      q.rowTitle(rowId),
+	}
+}
+
+// rating questions are answered with a whole number of their scale
+func (q Question) isRating() bool {
+	return q.QuestionType == "Rating" || q.QuestionType == "NPS"
+}
+
+// lowest and highest rating of a Rating or NPS question
+func (q Question) ratingScale() (int, int) {
+	if q.QuestionType == "NPS" {
+		return 0, 10
+	}
+	if q.ScaleMax == 0 {
+		return 1, 5
+	}
+	return q.ScaleMin, q.ScaleMax
+}
+
+// answers that can be counted: the options of choice questions and every rating of rating questions, nil for other questions
+func (q Question) options() []string {
+	if q.isRating() {
+		low, high := q.ratingScale()
+		options := make([]string, 0, high-low+1)
+		for v := low; v <= high; v++ {
+			options = append(options, strconv.Itoa(v))
+		}
+		return options
+	}
+	if q.isChoice() {
+		return q.Answers
+	}
+	return nil
+}
+
+// scored questions have a numeric value for every option, so means and other statistics apply
+func (q Question) isScored() bool {
+	return q.QuestionType == "Likert Scale" || q.isRating()
+}
+
+// numeric value of every option, in the order of options()
+func (q Question) scores() []float64 {
+	if q.isRating() {
+		low, high := q.ratingScale()
+		scores := make([]float64, 0, high-low+1)
+		for v := low; v <= high; v++ {
+			scores = append(scores, float64(v))
+		}
+		return scores
+	}
+	return q.likertScores()
+}
+
+// choice questions answer with their options, their answers can be counted and charted
+func (q Question) isChoice() bool {
+	return q.QuestionType == "Multiple Choice" || q.QuestionType == "Likert Scale" || q.QuestionType == "Checkbox"
+}
+
+// numeric value of every Likert answer, questions defined without scores are scored 1..n in order
+func (q Question) likertScores() []float64 {
+	if len(q.Scores) == len(q.Answers) {
+		return q.Scores
+	}
+	scores := make([]float64, len(q.Answers))
+	for i := range scores {
+		scores[i] = float64(i + 1)
+	}
+	return scores
 }
 
 type Response struct {
-	Id           bson.ObjectID `json:"id" bson:"_id"`
-	UserId       bson.ObjectID `json:"user_id" bson:"user_id"`
-	CreatedAt    time.Time     `json:"created_at" bson:"created_at"`
-	SurveyId     bson.ObjectID `json:"survey_id" bson:"survey_id"`
-	QuestionId   bson.ObjectID `json:"question_id" bson:"question_id"`
-	ResponseText string        `json:"response_text" bson:"response_text"`
+	Id                bson.ObjectID       `json:"id" bson:"_id"`
+	UserId            bson.ObjectID       `json:"user_id" bson:"user_id"`
+	CreatedAt         time.Time           `json:"created_at" bson:"created_at"`
+	SurveyId          bson.ObjectID       `json:"survey_id" bson:"survey_id"`
+	QuestionId        bson.ObjectID       `json:"question_id" bson:"question_id"`
+	RowId             bson.ObjectID       `json:"row_id,omitzero" bson:"row_id,omitempty"` // answered row of a Matrix question
+	ResponseText      string              `json:"response_text" bson:"response_text"`
+	Value             any                 `json:"value,omitempty" bson:"value,omitempty"`                       // typed answer, see responseValue. unset on responses stored before typed values
+	OtherText         string              `json:"other_text,omitempty" bson:"other_text,omitempty"`             // what the respondent specified for the question's other_option
+	RespondentEmail   string              `json:"respondent_email,omitempty" bson:"respondent_email,omitempty"` // identified surveys only
+	RespondentId      string              `json:"respondent_id,omitempty" bson:"respondent_id,omitempty"`       // submitted with a respondent session, see createSession
+	Metadata          *RespondentMetadata `json:"metadata,omitempty" bson:"metadata,omitempty"`                 // surveys collecting metadata only
+	Device            string              `json:"device,omitempty" bson:"device,omitempty"`                     // device class of the respondent, see parseUserAgent
+	Browser           string              `json:"browser,omitempty" bson:"browser,omitempty"`                   // browser family of the respondent
+	Acquisition       *Acquisition        `json:"acquisition,omitempty" bson:"acquisition,omitempty"`           // utm parameters and referrer given by the submission
+	BotFlags          []string            `json:"bot_flags,omitempty" bson:"bot_flags,omitempty"`               // why the submission looks automated, see checkBotFlags
+	Moderation        string              `json:"moderation,omitempty" bson:"moderation,omitempty"`             // review state of screened text answers, see screenResponse. pending and rejected answers are left out of results
+	ModerationReasons []string            `json:"moderation_reasons,omitempty" bson:"moderation_reasons,omitempty"`
+	ReviewedAt        *time.Time          `json:"reviewed_at,omitempty" bson:"reviewed_at,omitempty"`
+	ReviewedBy        bson.ObjectID       `json:"reviewed_by,omitzero" bson:"reviewed_by,omitempty"`
+	Position          int                 `json:"position,omitempty" bson:"position,omitempty"`         // randomized surveys: where the respondent was shown the question, from 1
+	AnswerOrder       []string            `json:"answer_order,omitempty" bson:"answer_order,omitempty"` // questions shuffling their answers: the answers in the order the respondent saw them
+	// the question as the respondent saw it, later edits of the survey do not change it
+	QuestionSnapshot *QuestionSnapshot `json:"question_snapshot,omitempty" bson:"question_snapshot,omitempty"`
+}
+
+type QuestionSnapshot struct {
+	QuestionTitle string   `json:"question_title" bson:"question_title"`
+	QuestionType  string   `json:"question_type" bson:"question_type"`
+	Answers       []string `json:"answers,omitempty" bson:"answers,omitempty"`
+	RowTitle      string   `json:"row_title,omitempty" bson:"row_title,omitempty"` // answered row of a Matrix question
+}
+
+// body of a submission, either a bare array of ResponseInput or an object carrying extra respondent details
+type SubmissionInput struct {
+	RespondentEmail string              `json:"respondent_email,omitempty"`
+	Session         string              `json:"session,omitempty"`       // randomized surveys: the session the questions were ordered for
+	Timezone        string              `json:"timezone,omitempty"`      // surveys collecting metadata: IANA time zone of the respondent
+	CaptchaToken    string              `json:"captcha_token,omitempty"` // surveys requiring a captcha: the token of the solved captcha
+	Honeypot        string              `json:"honeypot,omitempty"`      // value of the hidden honeypot field, empty for people
+	StartToken      string              `json:"start_token,omitempty"`   // start_token of the respondent view
+	Acquisition                         // optional utm_source, utm_medium, utm_campaign and referrer
+	RespondentId    string              `json:"-"` // from the respondent session of the request, not the body
+	Metadata        *RespondentMetadata `json:"-"`
+	Device, Browser string              `json:"-"` // from the user agent of the request
+	BotFlags        []string            `json:"-"`
+	Responses       []ResponseInput     `json:"responses"`
+}
+
+func (s *SubmissionInput) UnmarshalJSON(data []byte) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		return json.Unmarshal(trimmed, &s.Responses)
+	}
+	type submission SubmissionInput // avoid recursing into UnmarshalJSON
+	return json.Unmarshal(data, (*submission)(s))
 }
 
 type ResponseInput struct {
 	QuestionId   bson.ObjectID `json:"question_id" bson:"question_id"`
+	RowId        bson.ObjectID `json:"row_id,omitzero" bson:"row_id,omitempty"` // Matrix questions only
 	ResponseText string        `json:"response_text" bson:"response_text"`
+	Value        any           `json:"value,omitempty" bson:"value,omitempty"`           // typed answer, takes precedence over response_text
+	OtherText    string        `json:"other_text,omitempty" bson:"other_text,omitempty"` // required with the question's other_option
+}
+
+// extra: engagement summary of a survey
+type SurveyStats struct {
+	SurveyId       bson.ObjectID `json:"survey_id" bson:"survey_id"`
+	Respondents    int           `json:"respondents" bson:"respondents"`
+	AverageAnswers float64       `json:"average_answers" bson:"average_answers"`
+	CompletionRate float64       `json:"completion_rate" bson:"completion_rate"`
+}
+
+// respondent-facing view of a survey, without timestamps and admin fields
+type PublicSurvey struct {
+	Token                 string           `json:"token"`
+	Title                 string           `json:"title"`
+	Status                string           `json:"status"`
+	Anonymous             bool             `json:"anonymous"`
+	MaxResponses          int              `json:"max_responses,omitempty"`
+	EditWindowMinutes     int              `json:"edit_window_minutes,omitempty"`
+	CaptchaProvider       string           `json:"captcha_provider,omitempty"` // surveys requiring a captcha: recaptcha or hcaptcha
+	CaptchaSiteKey        string           `json:"captcha_site_key,omitempty"`
+	Honeypot              bool             `json:"honeypot,omitempty"`    // render a hidden honeypot field, submitted as honeypot
+	StartToken            string           `json:"start_token,omitempty"` // surveys with a minimum completion time: submitted back as start_token
+	Full                  bool             `json:"full"`
+	WelcomeMessage        string           `json:"welcome_message,omitempty"`
+	ThankYouMessage       string           `json:"thank_you_message,omitempty"`
+	CompletionRedirectURL string           `json:"completion_redirect_url,omitempty"`
+	Theme                 *Theme           `json:"theme,omitempty"`
+	Language              string           `json:"language,omitempty"` // language of the texts, the default language unless a translation was found
+	Session               string           `json:"session,omitempty"`  // randomized surveys: the session the questions are ordered for
+	Sections              []Section        `json:"sections,omitempty"`
+	Questions             []PublicQuestion `json:"questions"`
+}
+
+type PublicQuestion struct {
+	Id            bson.ObjectID      `json:"id"`
+	QuestionTitle string             `json:"question_title"`
+	QuestionType  string             `json:"question_type"`
+	Answers       []string           `json:"answers,omitempty"`
+	AnswerLabels  []string           `json:"answer_labels,omitempty"` // translated answers, in the order of answers
+	Required      bool               `json:"required"`
+	MinSelections int                `json:"min_selections,omitempty"`
+	MaxSelections int                `json:"max_selections,omitempty"`
+	ScaleMin      int                `json:"scale_min,omitempty"`
+	ScaleMax      int                `json:"scale_max,omitempty"`
+	Rows          []MatrixRow        `json:"rows,omitempty"`
+	MinDate       string             `json:"min_date,omitempty"`
+	MaxDate       string             `json:"max_date,omitempty"`
+	MinValue      *float64           `json:"min_value,omitempty"`
+	MaxValue      *float64           `json:"max_value,omitempty"`
+	Step          float64            `json:"step,omitempty"`
+	MaxFileSize   int64              `json:"max_file_size,omitempty"`
+	AllowedTypes  []string           `json:"allowed_types,omitempty"`
+	OtherOption   string             `json:"other_option,omitempty"`
+	ShowIf        []DisplayCondition `json:"show_if,omitempty"`
+	SectionId     bson.ObjectID      `json:"section_id,omitzero"`
+}
+
+func (s Survey) public() PublicSurvey {
+	p := PublicSurvey{
+		Token:     s.Token,
+		Title:     s.Title,
+		Status:    s.status(),
+		Anonymous: s.isAnonymous(),
+		Full:      s.isFull(),
+		Sections:  s.Sections,
+		Theme:     s.Theme,
+		Questions: make([]PublicQuestion, 0, len(s.Questions)),
+	}
+	if s.MaxResponses != nil {
+		p.MaxResponses = *s.MaxResponses
+	}
+	p.EditWindowMinutes = s.editWindow()
+	if s.requiresCaptcha() {
+		p.CaptchaProvider, p.CaptchaSiteKey = config.CaptchaProvider, config.CaptchaSiteKey
+	}
+	if b := s.BotDetection; b != nil {
+		p.Honeypot = b.Honeypot
+		if b.MinSeconds > 0 {
+			p.StartToken = newStartToken(s)
+		}
+	}
+	if s.WelcomeMessage != nil {
+		p.WelcomeMessage = *s.WelcomeMessage
+	}
+	if s.ThankYouMessage != nil {
+		p.ThankYouMessage = *s.ThankYouMessage
+	}
+	if s.CompletionRedirectURL != nil {
+		p.CompletionRedirectURL = *s.CompletionRedirectURL
+	}
+	for _, q := range s.Questions {
+		pq := PublicQuestion{
+			Id:            q.Id,
+			QuestionTitle: q.QuestionTitle,
+			QuestionType:  q.QuestionType,
+			Answers:       q.Answers,
+			Required:      q.Required,
+			MinSelections: q.MinSelections,
+			MaxSelections: q.MaxSelections,
+			Rows:          q.Rows,
+			MinDate:       q.MinDate,
+			MaxDate:       q.MaxDate,
+			MinValue:      q.MinValue,
+			MaxValue:      q.MaxValue,
+			Step:          q.Step,
+			AllowedTypes:  q.AllowedTypes,
+			OtherOption:   q.OtherOption,
+			ShowIf:        q.ShowIf,
+			SectionId:     q.SectionId,
+		}
+		// the scale is spelled out, respondents do not need to know the defaults
+		if q.isRating() {
+			pq.ScaleMin, pq.ScaleMax = q.ratingScale()
+		}
+		if q.QuestionType == "NPS" {
+			pq.Answers = q.options()
+		}
+		if q.QuestionType == "File Upload" {
+			pq.MaxFileSize = q.fileSizeLimit()
+		}
+		p.Questions = append(p.Questions, pq)
+	}
+	return p
+}
+
+func (s Survey) isAnonymous() bool {
+	return s.Anonymous == nil || *s.Anonymous
 }
 
 // global variable
@@ -62,12 +420,16 @@ var client *mongo.Client
 var surveysCollection *mongo.Collection
 var responsesCollection *mongo.Collection
 
+// tokens are matched case-insensitively, so "AbCdE" and "abcde" refer to the same survey
+var tokenCollation = &options.Collation{Locale: "en", Strength: 2}
+
 // initial database
 func initDB() {
 	err := godotenv.Load() // load .env
 	if err != nil {
 		log.Fatal("Error loading .env file")
 	}
+	config = loadConfig()
 	uri := os.Getenv("MONGODB_URI") // get env from .env
 	docs := "www.mongodb.com/docs/drivers/go/current/"
 	if uri == "" { // check if mongodb uri is missing...
@@ -79,331 +441,1950 @@ func initDB() {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	client, err := mongo.Connect(options.Client().
-		ApplyURI(uri))
+	clientOpts, err := config.clientOptions(uri)
+	if err != nil {
+		log.Fatal(err)
+	}
+	client, err = mongo.Connect(clientOpts.SetMonitor(mongoMonitor()))
 	_ = client.Ping(ctx, readpref.Primary())
 
 	if err != nil {
 		panic(err)
 	}
-
-	db := client.Database("OSP_backend")
-
-	surveysCollection = db.Collection("surveys")
-	responsesCollection = db.Collection("responses")
-
-	indexModel := mongo.IndexModel{
-		Keys:    bson.D{{Key: "token", Value: 1}},
-		Options: options.Index().SetUnique(true),
+
+	if config.GeoIPDatabase != "" {
+		if geoIPRanges, err = loadGeoIP(config.GeoIPDatabase); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	openDatabase(ctx, client.Database("OSP_backend"))
+}
+
+// use the collections of db, creating their indexes
+func openDatabase(ctx context.Context, db *mongo.Database) {
+	surveysCollection = db.Collection("surveys")
+	responsesCollection = db.Collection("responses")
+	usersCollection = db.Collection("users")
+	membershipsCollection = db.Collection("memberships")
+	surveyVersionsCollection = db.Collection("survey_versions")
+	partialResponsesCollection = db.Collection("partial_responses")
+	respondentKeysCollection = db.Collection("respondent_keys")
+	submissionWindowsCollection = db.Collection("submission_windows")
+	webhooksCollection = db.Collection("webhooks")
+	webhookDeliveriesCollection = db.Collection("webhook_deliveries")
+	uploadsBucket = db.GridFSBucket(options.GridFSBucket().SetName("uploads"))
+
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "token", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("token_ci").SetCollation(tokenCollation),
+	}
+
+	_, err := surveysCollection.Indexes().CreateOne(ctx, indexModel)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = usersCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "username", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = usersCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "google_id", Value: 1}},
+		Options: options.Index().SetUnique(true).SetSparse(true),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = membershipsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "survey_id", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// responses are looked up by survey, and grouped by respondent for listings and exports
+	_, err = responsesCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "survey_id", Value: 1}, {Key: "user_id", Value: 1}},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = surveyVersionsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "survey_id", Value: 1}, {Key: "version", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// saved answers are resumed by their token, and removed once they have not been saved for a while
+	_, err = partialResponsesCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "resume_token", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = partialResponsesCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "updated_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(config.PartialResponseDays * 24 * 60 * 60)),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// a respondent can only submit once to surveys accepting one response per respondent
+	_, err = respondentKeysCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "survey_id", Value: 1}, {Key: "respondent_key", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// one submission counter per survey and minute, removed once the minute has passed
+	_, err = submissionWindowsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "survey_id", Value: 1}, {Key: "window", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = submissionWindowsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "window", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(submissionWindowTTL.Seconds())),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = webhooksCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "survey_id", Value: 1}},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// deliveries are retried once due, listed per webhook and removed after a while
+	_, err = webhookDeliveriesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		{Keys: bson.D{{Key: "webhook_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "created_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32(webhookDeliveryTTL.Seconds()))},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// full-text search, a match in the title counts more than one in a question
+	_, err = surveysCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "title", Value: "text"}, {Key: "questions.question_title", Value: "text"}},
+		Options: options.Index().SetName("survey_text").SetWeights(bson.M{"title": 5, "questions.question_title": 1}),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run fn in a transaction, deployments without transaction support (standalone servers) run it without one
+func withTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(ctx context.Context) (any, error) {
+		return nil, fn(ctx)
+	})
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.HasErrorCodeWithMessage(20, "Transaction numbers") {
+		log.Println("transactions are not supported by this MongoDB deployment, running without one")
+		return fn(ctx)
+	}
+	return err
+}
+
+// generate token of config.TokenLength characters drawn uniformly from config.TokenAlphabet
+func genToken() string {
+	letters := config.TokenAlphabet
+	max := big.NewInt(int64(len(letters)))
+	b := make([]byte, config.TokenLength)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		b[i] = letters[n.Int64()]
+	}
+	return string(b)
+}
+
+// find a survey by its public token, writing a 404 when it does not exist
+func findSurveyByToken(w http.ResponseWriter, token string) (Survey, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var survey Survey
+	err := surveysCollection.FindOne(ctx, bson.M{"token": token, "deleted_at": nil}, options.FindOne().SetCollation(tokenCollation)).Decode(&survey)
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "No survey found", http.StatusNotFound)
+		return survey, false
+	}
+	if err != nil {
+		panic(err)
+	}
+	return survey, true
+}
+
+// load a survey by id, writing a 400 when it does not exist
+func findSurveyById(w http.ResponseWriter, id bson.ObjectID) (Survey, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var survey Survey
+	err := surveysCollection.FindOne(ctx, bson.M{"_id": id, "deleted_at": nil}).Decode(&survey)
+
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "the survey does not exist, please provide correct survey id", http.StatusBadRequest)
+		return survey, false
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	return survey, true
+}
+
+// extra: get all existing surveys token for displaying a list of surveys
+func getAllSurveysList(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get surveys list")
+	// page is the older offset pagination, kept for existing clients
+	if !r.URL.Query().Has("page") {
+		getSurveysListAfter(w, r)
+		return
+	}
+	p, err := strconv.ParseInt(r.URL.Query().Get("page"), 10, 64)
+	if err != nil || p < 1 {
+		p = 1
+	}
+	l := pageLimit(r)
+	query, err := parseSurveyListQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pipeline := mongo.Pipeline{
+		query.sortStage(),
+		{{Key: "$skip", Value: (p - 1) * l}},
+		{{Key: "$limit", Value: l}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	scope, err := surveyAccessScope(ctx, r)
+	if err != nil {
+		panic(err)
+	}
+	scope["deleted_at"] = nil
+	// the access scope has an $or of its own
+	scope = bson.M{"$and": bson.A{scope, query.filter}}
+	total, err := surveysCollection.CountDocuments(ctx, scope)
+	if err != nil {
+		panic(err)
+	}
+	rows, err := listSurveys(ctx, scope, pipeline)
+	if err != nil {
+		panic(err)
+	}
+	page := SurveysListPage{
+		Data:       []SurveysList{},
+		Page:       p,
+		Limit:      l,
+		Total:      total,
+		TotalPages: (total + l - 1) / l,
+	}
+	for _, row := range rows {
+		page.Data = append(page.Data, row.SurveysList)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// survey of a listing with the id keyset pagination needs
+type surveysListRow struct {
+	SurveysList `bson:",inline"`
+	Id          bson.ObjectID `bson:"_id"`
+	Score       float64       `bson:"score"` // text search relevance, only set by searches
+}
+
+// survey matching a search, most relevant first
+type SurveySearchResult struct {
+	SurveysList
+	Id    bson.ObjectID `json:"id"`
+	Score float64       `json:"score"`
+}
+
+// fields the survey list can be sorted by
+var surveySortFields = []string{"created_at", "updated_at", "title"}
+
+// sort order and filters of the survey list
+type surveyListQuery struct {
+	filter bson.M
+	field  string // sort field, _id when none is given
+	order  int    // 1 for ascending, -1 for descending
+}
+
+// read the sort, order, status, created_after and created_before query parameters
+func parseSurveyListQuery(r *http.Request) (surveyListQuery, error) {
+	params := r.URL.Query()
+	query := surveyListQuery{filter: bson.M{}, field: "_id", order: 1}
+	if field := params.Get("sort"); field != "" {
+		if !slices.Contains(surveySortFields, field) {
+			return query, fmt.Errorf("Invalid sort, expected one of %s", strings.Join(surveySortFields, ", "))
+		}
+		query.field = field
+	}
+	switch params.Get("order") {
+	case "", "asc":
+	case "desc":
+		query.order = -1
+	default:
+		return query, fmt.Errorf("Invalid order, expected asc or desc")
+	}
+
+	switch status := params.Get("status"); status {
+	case "":
+	case StatusPublished:
+		// surveys created before statuses existed count as published
+		query.filter["status"] = bson.M{"$in": bson.A{StatusPublished, "", nil}}
+	case StatusDraft, StatusClosed:
+		query.filter["status"] = status
+	default:
+		return query, fmt.Errorf("Invalid status, expected %s, %s or %s", StatusDraft, StatusPublished, StatusClosed)
+	}
+	createdAt, err := parseTimeBounds(r, "created_after", "created_before")
+	if err != nil {
+		return query, err
+	}
+	if len(createdAt) > 0 {
+		query.filter["created_at"] = createdAt
+	}
+	return query, nil
+}
+
+// $sort stage of the query, _id breaks ties so pages never overlap
+func (q surveyListQuery) sortStage() bson.D {
+	sort := bson.D{{Key: q.field, Value: q.order}}
+	if q.field != "_id" {
+		sort = append(sort, bson.E{Key: "_id", Value: q.order})
+	}
+	return bson.D{{Key: "$sort", Value: sort}}
+}
+
+// filter for the surveys sorted after the survey with the given id.
+// cursors only hold the id, the value of the sort field is read back from the survey
+func (q surveyListQuery) after(ctx context.Context, id bson.ObjectID) (bson.M, error) {
+	op := "$gt"
+	if q.order < 0 {
+		op = "$lt"
+	}
+	if q.field == "_id" {
+		return bson.M{"_id": bson.M{op: id}}, nil
+	}
+	var last bson.M
+	err := surveysCollection.FindOne(ctx, bson.M{"_id": id}, options.FindOne().SetProjection(bson.M{q.field: 1})).Decode(&last)
+	if err != nil {
+		return nil, err
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{q.field: bson.M{op: last[q.field]}},
+		bson.M{q.field: last[q.field], "_id": bson.M{op: id}},
+	}}, nil
+}
+
+// surveys matching filter, paged by the stages in page, with their response count and latest response
+func listSurveys(ctx context.Context, filter bson.M, page mongo.Pipeline) ([]surveysListRow, error) {
+	pipeline := append(mongo.Pipeline{{{Key: "$match", Value: filter}}}, page...)
+	pipeline = append(pipeline,
+		bson.D{{Key: "$lookup", Value: bson.M{
+			"from": "responses",
+			"let":  bson.M{"survey_id": "$_id"},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$survey_id", "$$survey_id"}}}},
+				bson.M{"$group": bson.M{"_id": "$user_id", "last": bson.M{"$max": "$created_at"}}},
+				bson.M{"$group": bson.M{"_id": nil, "count": bson.M{"$sum": 1}, "last": bson.M{"$max": "$last"}}},
+			},
+			"as": "activity",
+		}}},
+		bson.D{{Key: "$project", Value: bson.M{
+			"token":            1,
+			"title":            1,
+			"score":            1,
+			"response_count":   bson.M{"$ifNull": bson.A{bson.M{"$arrayElemAt": bson.A{"$activity.count", 0}}, 0}},
+			"last_response_at": bson.M{"$arrayElemAt": bson.A{"$activity.last", 0}},
+		}}},
+	)
+	cursor, err := surveysCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var rows []surveysListRow
+	err = cursor.All(ctx, &rows)
+	return rows, err
+}
+
+// page of surveys returned by keyset pagination
+type SurveysPage struct {
+	Data       []SurveysList `json:"data"`
+	NextCursor string        `json:"next_cursor,omitempty"` // empty on the last page
+}
+
+// page of surveys returned by offset pagination, with the totals pagers need
+type SurveysListPage struct {
+	Data       []SurveysList `json:"data"`
+	Page       int64         `json:"page"`
+	Limit      int64         `json:"limit"`
+	Total      int64         `json:"total"`
+	TotalPages int64         `json:"total_pages"`
+}
+
+// page of responses returned by keyset pagination
+type ResponsesPage struct {
+	Data       []Response `json:"data"`
+	NextCursor string     `json:"next_cursor,omitempty"` // empty on the last page
+}
+
+// page size of keyset pagination when limit is missing, and its maximum
+const (
+	defaultPageLimit = 10
+	maxPageLimit     = 1000
+)
+
+// opaque cursor pointing at the last document of a page, pages are ordered by _id
+func encodeCursor(id bson.ObjectID) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id.Hex()))
+}
+
+func decodeCursor(cursor string) (bson.ObjectID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return bson.ObjectID{}, err
+	}
+	return bson.ObjectIDFromHex(string(raw))
+}
+
+// limit query parameter of keyset pagination
+func pageLimit(r *http.Request) int64 {
+	l, err := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64)
+	if err != nil || l < 1 {
+		return defaultPageLimit
+	}
+	return min(l, maxPageLimit)
+}
+
+// extra: keyset pagination, stable while new surveys are being created, a missing or empty after starts from the first survey
+func getSurveysListAfter(w http.ResponseWriter, r *http.Request) {
+	after := r.URL.Query().Get("after")
+	l := pageLimit(r)
+	query, err := parseSurveyListQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	scope, err := surveyAccessScope(ctx, r)
+	if err != nil {
+		panic(err)
+	}
+	scope["deleted_at"] = nil
+	// the access scope has an $or of its own, and so has the cursor of a sorted list
+	conditions := bson.A{scope, query.filter}
+	if after != "" {
+		id, err := decodeCursor(after)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		next, err := query.after(ctx, id)
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			panic(err)
+		}
+		conditions = append(conditions, next)
+	}
+	filter := bson.M{"$and": conditions}
+	sorted := mongo.Pipeline{
+		query.sortStage(),
+		{{Key: "$limit", Value: l + 1}}, // one extra row tells whether there is a next page
+	}
+
+	surveys, err := listSurveys(ctx, filter, sorted)
+	if err != nil {
+		panic(err)
+	}
+
+	page := SurveysPage{Data: []SurveysList{}}
+	if int64(len(surveys)) > l {
+		surveys = surveys[:l]
+		last := surveys[len(surveys)-1]
+		page.NextCursor = encodeCursor(last.Id)
+	}
+	for _, survey := range surveys {
+		page.Data = append(page.Data, survey.SurveysList)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// search the titles and question titles of the surveys you can access, most relevant first
+func searchSurveys(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("search surveys")
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		http.Error(w, "Missing search query q", http.StatusBadRequest)
+		return
+	}
+	l := pageLimit(r)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	scope, err := surveyAccessScope(ctx, r)
+	if err != nil {
+		panic(err)
+	}
+	scope["deleted_at"] = nil
+	filter := bson.M{"$and": bson.A{scope, bson.M{"$text": bson.M{"$search": q}}}}
+	ranked := mongo.Pipeline{
+		{{Key: "$addFields", Value: bson.M{"score": bson.M{"$meta": "textScore"}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "score", Value: -1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$limit", Value: l}},
+	}
+	rows, err := listSurveys(ctx, filter, ranked)
+	if err != nil {
+		panic(err)
+	}
+	results := []SurveySearchResult{}
+	for _, row := range rows {
+		results = append(results, SurveySearchResult{row.SurveysList, row.Id, row.Score})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// create survey
+func createSurvey(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("create survey")
+	var survey Survey
+	_ = json.NewDecoder(r.Body).Decode(&survey)
+	if msg := checkSurveyLimits(survey); msg != "" {
+		http.Error(w, "Failed to create survey, "+msg, http.StatusBadRequest)
+		return
+	}
+	if errs := validateSurvey(survey, false); len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+	// dry run: only validate the draft, nothing is stored
+	if r.URL.Query().Get("validate") == "true" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]bool{"valid": true})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := insertNewSurvey(ctx, r, &survey); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(survey)
+}
+
+// store survey as a new draft of the authenticated user, with fresh ids and a new token
+func insertNewSurvey(ctx context.Context, r *http.Request, survey *Survey) error {
+	survey.Id = bson.NewObjectID()
+	survey.OwnerId, _ = currentUserId(r)
+	survey.Token = genToken()
+	survey.CreatedAt = time.Now()
+	survey.UpdatedAt = survey.CreatedAt
+	survey.Version = 1
+	survey.Status = StatusDraft
+	survey.ResponseCount = 0
+	survey.DeletedAt = nil
+	if survey.Anonymous == nil {
+		anonymous := true
+		survey.Anonymous = &anonymous
+	}
+
+	sectionIds := make(map[bson.ObjectID]bson.ObjectID, len(survey.Sections))
+	for i, section := range survey.Sections {
+		survey.Sections[i].Id = bson.NewObjectID()
+		if !section.Id.IsZero() {
+			sectionIds[section.Id] = survey.Sections[i].Id
+		}
+	}
+	newIds := make(map[bson.ObjectID]bson.ObjectID, len(survey.Questions))
+	for i, q := range survey.Questions {
+		survey.Questions[i].Id = bson.NewObjectID()
+		survey.Questions[i].SectionId = sectionIds[q.SectionId]
+		if !q.Id.IsZero() {
+			newIds[q.Id] = survey.Questions[i].Id
+		}
+		for j := range survey.Questions[i].Rows {
+			survey.Questions[i].Rows[j].Id = bson.NewObjectID()
+		}
+	}
+	// display rules and translations follow the questions to their new ids
+	remapDisplayRules(survey.Questions, newIds)
+	survey.Translations = remapTranslations(survey.Translations, sectionIds, newIds)
+
+	_, err := surveysCollection.InsertOne(ctx, survey)
+	// regenerate the token if it collides (case-insensitively) with an existing one
+	for retry := 0; mongo.IsDuplicateKeyError(err) && retry < 5; retry++ {
+		survey.Token = genToken()
+		_, err = surveysCollection.InsertOne(ctx, survey)
+	}
+	if err == nil {
+		publishEvent(survey.Id, EventSurveyCreated, survey)
+	}
+	return err
+}
+
+// copy the title, questions and settings of a survey into a new draft
+func cloneSurvey(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("clone survey")
+	queries := mux.Vars(r)
+	id, err := bson.ObjectIDFromHex(queries["survey_id"])
+	if err != nil {
+		http.Error(w, "Invalid Survey Id", http.StatusBadRequest)
+		return
+	}
+	source, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+
+	clone := Survey{
+		Title:                    source.Title,
+		Questions:                source.Questions,
+		Sections:                 source.Sections,
+		Anonymous:                source.Anonymous,
+		AllowEdit:                source.AllowEdit,
+		EditWindowMinutes:        source.EditWindowMinutes,
+		OneResponsePerRespondent: source.OneResponsePerRespondent,
+		CollectMetadata:          source.CollectMetadata,
+		RequireCaptcha:           source.RequireCaptcha,
+		BotDetection:             source.BotDetection,
+		MaxSubmissionsPerMinute:  source.MaxSubmissionsPerMinute,
+		ModerateText:             source.ModerateText,
+		Notifications:            source.Notifications,
+		MaxResponses:             source.MaxResponses,
+		RandomizeQuestions:       source.RandomizeQuestions,
+		WelcomeMessage:           source.WelcomeMessage,
+		ThankYouMessage:          source.ThankYouMessage,
+		CompletionRedirectURL:    source.CompletionRedirectURL,
+		Theme:                    source.Theme,
+		Language:                 source.Language,
+		Translations:             source.Translations,
+	}
+	if r.URL.Query().Get("copy_suffix") != "false" {
+		clone.Title += " (copy)"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := insertNewSurvey(ctx, r, &clone); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(clone)
+}
+
+// update survey by id, the replaced content is kept as a version
+func updateSurvey(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("edit survey")
+	queries := mux.Vars(r)
+	id, err := bson.ObjectIDFromHex(queries["survey_id"])
+	if err != nil {
+		http.Error(w, "Invalid Survey Id", http.StatusBadRequest)
+		return
+	}
+	var input Survey
+	err = json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		panic(err)
+	}
+
+	if msg := checkSurveyLimits(input); msg != "" {
+		http.Error(w, "Failed to update survey, "+msg, http.StatusBadRequest)
+		return
+	}
+	// questions are checked against the stored ones, and the stored sections when the update keeps them
+	validated := input
+	var stored []Question
+	if len(input.Questions) > 0 {
+		current, ok := findSurveyById(w, id)
+		if !ok {
+			return
+		}
+		if len(input.Sections) == 0 {
+			validated.Sections = current.Sections
+		}
+		stored = current.Questions
+	}
+	if errs := validateSurveyFor(validated, true, stored); len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	updatedSurvey := bson.M{}
+
+	if input.Title != "" {
+		updatedSurvey["title"] = input.Title
+	}
+
+	if input.Anonymous != nil {
+		updatedSurvey["anonymous"] = *input.Anonymous
+	}
+
+	if input.AllowEdit != nil {
+		updatedSurvey["allow_edit"] = *input.AllowEdit
+	}
+
+	// 0 stops issuing edit tokens
+	if input.EditWindowMinutes != nil {
+		updatedSurvey["edit_window_minutes"] = *input.EditWindowMinutes
+	}
+
+	if input.OneResponsePerRespondent != nil {
+		updatedSurvey["one_response_per_respondent"] = *input.OneResponsePerRespondent
+	}
+
+	if input.CollectMetadata != nil {
+		updatedSurvey["collect_metadata"] = *input.CollectMetadata
+	}
+
+	if input.RequireCaptcha != nil {
+		updatedSurvey["require_captcha"] = *input.RequireCaptcha
+	}
+
+	// the checks are replaced as a whole
+	if input.BotDetection != nil {
+		updatedSurvey["bot_detection"] = *input.BotDetection
+	}
+	if input.MaxSubmissionsPerMinute != nil {
+		updatedSurvey["max_submissions_per_minute"] = *input.MaxSubmissionsPerMinute
+	}
+	if input.ModerateText != nil {
+		updatedSurvey["moderate_text"] = *input.ModerateText
+	}
+	if input.Notifications != nil {
+		updatedSurvey["notifications"] = *input.Notifications
+	}
+
+	if input.ExpiresAt != nil {
+		updatedSurvey["expires_at"] = *input.ExpiresAt
+	}
+
+	if input.RandomizeQuestions != nil {
+		updatedSurvey["randomize_questions"] = *input.RandomizeQuestions
+	}
+
+	// an empty text removes the screen
+	if input.WelcomeMessage != nil {
+		updatedSurvey["welcome_message"] = *input.WelcomeMessage
+	}
+
+	if input.ThankYouMessage != nil {
+		updatedSurvey["thank_you_message"] = *input.ThankYouMessage
+	}
+
+	if input.CompletionRedirectURL != nil {
+		updatedSurvey["completion_redirect_url"] = *input.CompletionRedirectURL
+	}
+
+	// the theme is replaced as a whole
+	if input.Theme != nil {
+		updatedSurvey["theme"] = *input.Theme
+	}
+
+	if input.Language != "" {
+		updatedSurvey["language"] = input.Language
+	}
+
+	if input.MaxResponses != nil {
+		updatedSurvey["max_responses"] = *input.MaxResponses
+	}
+
+	if len(input.Sections) > 0 {
+		for i, section := range input.Sections {
+			if section.Id.IsZero() {
+				input.Sections[i].Id = bson.NewObjectID()
+			}
+		}
+		updatedSurvey["sections"] = input.Sections
+	}
+
+	if len(input.Questions) > 0 {
+		for i, q := range input.Questions {
+			if q.Id.IsZero() {
+				input.Questions[i].Id = bson.NewObjectID()
+			}
+			for j, row := range q.Rows {
+				if row.Id.IsZero() {
+					input.Questions[i].Rows[j].Id = bson.NewObjectID()
+				}
+			}
+		}
+		updatedSurvey["questions"] = input.Questions
+	}
+
+	if len(updatedSurvey) == 0 {
+		http.Error(w, "No updates", http.StatusBadRequest)
+		return
+	}
+
+	updatedSurvey["updated_at"] = time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// only update the version the client has read, so concurrent edits do not clobber each other
+	filter := bson.M{"_id": id, "version": input.Version}
+	if input.Version == 0 {
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+
+	survey, err := updateSurveyWithHistory(ctx, filter, bson.M{"$set": updatedSurvey, "$inc": bson.M{"version": 1}})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, "Survey has been modified by someone else, please reload it and try again", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{"message": "survey updated", "version": survey.Version})
+}
+
+// rename survey by id without touching its questions
+func renameSurvey(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("rename survey")
+	queries := mux.Vars(r)
+	id, err := bson.ObjectIDFromHex(queries["survey_id"])
+	if err != nil {
+		http.Error(w, "Invalid Survey Id", http.StatusBadRequest)
+		return
+	}
+
+	var input struct {
+		Title string `json:"title"`
+	}
+	if err = json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	title := strings.TrimSpace(input.Title)
+	if title == "" {
+		http.Error(w, "Title is required, please make sure the title field is filled", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$set": bson.M{"title": title, "updated_at": time.Now()},
+		"$inc": bson.M{"version": 1},
+	}
+	survey, err := updateSurveyWithHistory(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			http.Error(w, "No survey found", http.StatusNotFound)
+			return
+		}
+		panic(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(survey)
+}
+
+// publish survey by id, it accepts responses from now on
+func publishSurvey(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("publish survey")
+	queries := mux.Vars(r)
+	id, err := bson.ObjectIDFromHex(queries["survey_id"])
+	if err != nil {
+		http.Error(w, "Invalid Survey Id", http.StatusBadRequest)
+		return
+	}
+	survey, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+	if len(survey.Questions) == 0 {
+		http.Error(w, "Failed to publish survey, a survey should have at least 1 question", http.StatusBadRequest)
+		return
+	}
+	if survey.isExpired() {
+		http.Error(w, "Failed to publish survey, expires_at is in the past", http.StatusBadRequest)
+		return
+	}
+	setSurveyStatus(w, id, StatusPublished)
+}
+
+// close survey by id, it stops accepting responses
+func closeSurvey(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("close survey")
+	queries := mux.Vars(r)
+	id, err := bson.ObjectIDFromHex(queries["survey_id"])
+	if err != nil {
+		http.Error(w, "Invalid Survey Id", http.StatusBadRequest)
+		return
+	}
+	setSurveyStatus(w, id, StatusClosed)
+}
+
+func setSurveyStatus(w http.ResponseWriter, id bson.ObjectID, status string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the survey as it was, to tell whether the status changed
+	var survey Survey
+	now := time.Now()
+	update := bson.M{"$set": bson.M{"status": status, "updated_at": now}}
+	err := surveysCollection.FindOneAndUpdate(ctx, bson.M{"_id": id}, update).Decode(&survey)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "No survey found", http.StatusNotFound)
+			return
+		}
+		panic(err)
+	}
+	changed := survey.status() != status
+	survey.Status, survey.UpdatedAt = status, now
+	if changed && status == StatusClosed {
+		notifyWebhooks(ctx, id, EventSurveyClosed, surveyClosedEvent(survey))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(survey)
+}
+
+// close published surveys whose expires_at has passed
+func closeExpiredSurveys() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"status":     bson.M{"$in": bson.A{StatusPublished, "", nil}},
+		"expires_at": bson.M{"$lte": now},
+		"deleted_at": nil,
+	}
+	// closed one at a time, so every survey closed gets its survey.closed event exactly once
+	update := bson.M{"$set": bson.M{"status": StatusClosed, "updated_at": now}}
+	fOpt := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	closed := 0
+	for {
+		var survey Survey
+		err := surveysCollection.FindOneAndUpdate(ctx, filter, update, fOpt).Decode(&survey)
+		if err == mongo.ErrNoDocuments {
+			break
+		}
+		if err != nil {
+			log.Println("closing expired surveys failed:", err)
+			break
+		}
+		closed++
+		notifyWebhooks(ctx, survey.Id, EventSurveyClosed, surveyClosedEvent(survey))
+	}
+	if closed > 0 {
+		log.Printf("closed %d expired surveys", closed)
+	}
+}
+
+// how often the scheduler closes expired surveys
+const expiryCheckInterval = time.Minute
+
+// check for expired surveys every interval until the process exits
+func startExpiryScheduler(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			closeExpiredSurveys()
+		}
+	}()
+}
+
+// delete survey by id
+func deleteSurvey(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("delete survey")
+	queries := mux.Vars(r)
+	id, err := bson.ObjectIDFromHex(queries["survey_id"])
+	if err != nil {
+		http.Error(w, "Invalid Survey Id", http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the survey only moves to the trash, its responses and members stay until it is restored
+	res, err := surveysCollection.UpdateOne(ctx, bson.M{"_id": id, "deleted_at": nil}, bson.M{"$set": bson.M{"deleted_at": time.Now()}})
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to delete survey, nothing has been deleted", http.StatusInternalServerError)
+		return
+	}
+	if res.MatchedCount == 0 {
+		http.Error(w, "Failed to delete survey, survey might have already removed", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "survey deleted"})
+}
+
+// list the surveys in the trash, regular users only see the surveys they own
+func getTrash(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get trash")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"deleted_at": bson.M{"$ne": nil}}
+	if userId, ok := currentUserId(r); ok {
+		filter["owner_id"] = userId
+	}
+	fOpt := options.Find().SetSort(bson.D{{Key: "deleted_at", Value: -1}})
+	cursor, err := surveysCollection.Find(ctx, filter, fOpt)
+	if err != nil {
+		panic(err)
+	}
+	defer cursor.Close(ctx)
+	surveys := []Survey{}
+	if err = cursor.All(ctx, &surveys); err != nil {
+		log.Panic(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(surveys)
+}
+
+// restore survey by id from the trash
+func restoreSurvey(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("restore survey")
+	queries := mux.Vars(r)
+	id, err := bson.ObjectIDFromHex(queries["survey_id"])
+	if err != nil {
+		http.Error(w, "Invalid Survey Id", http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var survey Survey
+	update := bson.M{"$unset": bson.M{"deleted_at": ""}, "$set": bson.M{"updated_at": time.Now()}}
+	fOpt := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = surveysCollection.FindOneAndUpdate(ctx, bson.M{"_id": id, "deleted_at": bson.M{"$ne": nil}}, update, fOpt).Decode(&survey)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "No survey found in the trash", http.StatusNotFound)
+			return
+		}
+		panic(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(survey)
+}
+
+// get survey by token
+func getSurveyByToken(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get survey by token")
+	queries := mux.Vars(r)
+	token := queries["token"]
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var survey Survey
+	err := surveysCollection.FindOne(ctx, bson.M{"token": token, "deleted_at": nil}, options.FindOne().SetCollation(tokenCollation)).Decode(&survey)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			fmt.Println("No survey found")
+		} else {
+			panic(err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	query := r.URL.Query()
+	json.NewEncoder(w).Encode(survey.publicFor(query.Get("session")).localize(survey, query.Get("lang")))
+}
+
+// get the full survey document by id
+func getSurveyById(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get survey by id")
+	queries := mux.Vars(r)
+	id, err := bson.ObjectIDFromHex(queries["survey_id"])
+	if err != nil {
+		http.Error(w, "Invalid Survey Id", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var survey Survey
+	err = surveysCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&survey)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "No survey found", http.StatusNotFound)
+			return
+		}
+		panic(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(survey)
+}
+
+// get a single question of a survey
+func getQuestion(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get question")
+	queries := mux.Vars(r)
+	id, err := bson.ObjectIDFromHex(queries["survey_id"])
+	if err != nil {
+		http.Error(w, "Invalid Survey Id", http.StatusBadRequest)
+		return
+	}
+	questionId, err := bson.ObjectIDFromHex(queries["question_id"])
+	if err != nil {
+		http.Error(w, "Invalid Question Id", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var survey Survey
+	fOpt := options.FindOne().SetProjection(bson.M{"questions": bson.M{"$elemMatch": bson.M{"_id": questionId}}})
+	err = surveysCollection.FindOne(ctx, bson.M{"_id": id, "deleted_at": nil}, fOpt).Decode(&survey)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "No survey found", http.StatusNotFound)
+			return
+		}
+		panic(err)
+	}
+	if len(survey.Questions) == 0 {
+		http.Error(w, "No question found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(survey.Questions[0])
+}
+
+// submit response
+func submitResponse(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("submit response")
+	queries := mux.Vars(r)
+	id, err := bson.ObjectIDFromHex(queries["survey_id"])
+	if err != nil {
+		http.Error(w, "Invalid Survey Id", http.StatusBadRequest)
+		return
+	}
+
+	survey, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+	if len(survey.Questions) == 0 {
+		http.Error(w, "the survey has no questions, responses cannot be submitted", http.StatusBadRequest)
+		return
+	}
+	if !isAcceptingResponses(w, survey) {
+		return
+	}
+	var submission SubmissionInput
+	err = json.NewDecoder(r.Body).Decode(&submission)
+	if err != nil {
+		panic(err)
+	}
+	if submission.RespondentId, ok = respondentSession(w, r); !ok {
+		return
+	}
+	if submission.Metadata, ok = respondentMetadata(w, r, survey, submission); !ok {
+		return
+	}
+	submission.Device, submission.Browser = parseUserAgent(r.UserAgent())
+	if submission.BotFlags, ok = checkBotFlags(w, survey, submission, submissionStart(survey, submission)); !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	userId := bson.NewObjectID()
+	responses, ok := buildResponses(ctx, w, survey, submission, userId)
+	if !ok {
+		return
+	}
+	if !checkCaptcha(ctx, w, r, survey, submission) {
+		return
+	}
+	key, ok := claimRespondentKey(ctx, w, r, survey, submission, userId)
+	if !ok {
+		return
+	}
+
+	// take a slot of the quota first, concurrent submissions cannot push the survey over max_responses
+	count, reserved, err := reserveResponseSlot(ctx, id, 1)
+	if err != nil {
+		panic(err)
+	}
+	if !reserved {
+		releaseRespondentKey(ctx, id, key)
+		http.Error(w, "the survey is full, responses cannot be submitted", http.StatusForbidden)
+		return
+	}
+	// counted last, so submissions rejected as duplicates or over the quota do not use up the rate limit
+	if !throttleSubmission(ctx, w, survey) {
+		if _, _, err := reserveResponseSlot(ctx, id, -1); err != nil {
+			log.Println(err)
+		}
+		releaseRespondentKey(ctx, id, key)
+		return
+	}
+
+	if len(responses) > 0 {
+		_, err = responsesCollection.InsertMany(ctx, responses)
+		if err != nil {
+			// give the slot back
+			if _, _, err := reserveResponseSlot(ctx, id, -1); err != nil {
+				log.Println(err)
+			}
+			releaseRespondentKey(ctx, id, key)
+			http.Error(w, "Failed to submit response", http.StatusInternalServerError)
+			return
+		}
+	}
+	notifyWebhooks(ctx, id, EventResponseSubmitted, SubmissionEvent{userId, responses})
+	publishEvent(id, EventResponseSubmitted, SubmissionEvent{userId, responses})
+	notifySubmission(ctx, survey, count)
+	setEditToken(w, survey, userId)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(submission.Responses)
+}
+
+// add delta to the response count of a survey and return the new count, a positive delta only succeeds
+// while the survey is below max_responses
+func reserveResponseSlot(ctx context.Context, surveyId bson.ObjectID, delta int) (int, bool, error) {
+	filter := bson.M{"_id": surveyId}
+	if delta > 0 {
+		filter["$or"] = bson.A{
+			bson.M{"max_responses": bson.M{"$in": bson.A{nil, 0}}},
+			bson.M{"$expr": bson.M{"$lte": bson.A{bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$response_count", 0}}, delta}}, "$max_responses"}}},
+		}
+	}
+	var survey Survey
+	err := surveysCollection.FindOneAndUpdate(ctx, filter, bson.M{"$inc": bson.M{"response_count": delta}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"response_count": 1}),
+	).Decode(&survey)
+	if err == mongo.ErrNoDocuments {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return survey.ResponseCount, true, nil
+}
+
+// check the survey is published, not expired and not full, writes 403 otherwise
+func isAcceptingResponses(w http.ResponseWriter, survey Survey) bool {
+	switch survey.status() {
+	case StatusDraft:
+		http.Error(w, "the survey has not been published yet, responses cannot be submitted", http.StatusForbidden)
+		return false
+	case StatusClosed:
+		http.Error(w, "the survey is closed, responses cannot be submitted", http.StatusForbidden)
+		return false
+	}
+	// the scheduler may not have closed it yet
+	if survey.isExpired() {
+		http.Error(w, "the survey expired on "+survey.ExpiresAt.Format(time.RFC3339)+", responses cannot be submitted", http.StatusForbidden)
+		return false
+	}
+	if survey.isFull() {
+		http.Error(w, "the survey is full, responses cannot be submitted", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// replace the responses of one respondent of a survey on their behalf, respondents themselves edit
+// with the edit token of their submission
+func editResponses(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("edit responses")
+	queries := mux.Vars(r)
+	id, err := bson.ObjectIDFromHex(queries["survey_id"])
+	if err != nil {
+		http.Error(w, "Invalid Survey Id", http.StatusBadRequest)
+		return
+	}
+	userId, err := bson.ObjectIDFromHex(queries["user_id"])
+	if err != nil {
+		http.Error(w, "Invalid User Id", http.StatusBadRequest)
+		return
+	}
+
+	survey, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+	if survey.AllowEdit == nil || !*survey.AllowEdit {
+		http.Error(w, "the survey does not allow editing responses", http.StatusForbidden)
+		return
+	}
+	if !isAcceptingResponses(w, survey) {
+		return
+	}
+	var submission SubmissionInput
+	err = json.NewDecoder(r.Body).Decode(&submission)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	replaceResponses(w, survey, userId, submission)
+}
+
+// replace the responses of one respondent with a new submission, writing the submitted responses
+func replaceResponses(w http.ResponseWriter, survey Survey, userId bson.ObjectID, submission SubmissionInput) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"survey_id": survey.Id, "user_id": userId}
+	var previous Response
+	err := responsesCollection.FindOne(ctx, filter).Decode(&previous)
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "No responses found for this user", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+	// edits stay linked to the respondent session and metadata of the submission
+	submission.RespondentId = previous.RespondentId
+	submission.Metadata = previous.Metadata
+	submission.Device, submission.Browser = previous.Device, previous.Browser
+	submission.BotFlags = previous.BotFlags
+	submission.Acquisition = Acquisition{}
+	if previous.Acquisition != nil {
+		submission.Acquisition = *previous.Acquisition
+	}
+
+	responses, ok := buildResponses(ctx, w, survey, submission, userId)
+	if !ok {
+		return
+	}
+
+	// the previous answers are replaced, not duplicated
+	err = withTransaction(ctx, func(ctx context.Context) error {
+		if _, err := responsesCollection.DeleteMany(ctx, filter); err != nil {
+			return err
+		}
+		if len(responses) == 0 {
+			return nil
+		}
+		_, err := responsesCollection.InsertMany(ctx, responses)
+		return err
+	})
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to edit responses", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(submission.Responses)
+}
+
+// one historical response of a bulk import, user_id and created_at are optional
+type ImportRecord struct {
+	QuestionId   string `json:"question_id"`
+	RowId        string `json:"row_id,omitempty"` // Matrix questions only
+	ResponseText string `json:"response_text"`
+	OtherText    string `json:"other_text,omitempty"` // with the other_option of a Multiple Choice question
+	UserId       string `json:"user_id,omitempty"`
+	CreatedAt    string `json:"created_at,omitempty"` // RFC3339, defaults to the import time
+}
+
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Message string `json:"message"`
+}
+
+type ImportResult struct {
+	Imported int              `json:"imported"`
+	Rejected int              `json:"rejected"`
+	Errors   []ImportRowError `json:"errors"`
+}
+
+// import historical responses of a survey, invalid rows are skipped and reported
+func importResponses(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("import responses")
+	queries := mux.Vars(r)
+	id, err := bson.ObjectIDFromHex(queries["survey_id"])
+	if err != nil {
+		http.Error(w, "Invalid Survey Id", http.StatusBadRequest)
+		return
+	}
+
+	survey, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+	var records []ImportRecord
+	if err = json.NewDecoder(r.Body).Decode(&records); err != nil {
+		http.Error(w, "Invalid request body, expected an array of responses", http.StatusBadRequest)
+		return
+	}
+
+	questions := make(map[bson.ObjectID]Question, len(survey.Questions))
+	for _, q := range survey.Questions {
+		questions[q.Id] = q
+	}
+
+	result := ImportResult{Errors: []ImportRowError{}}
+	reject := func(row int, msg string) {
+		result.Rejected++
+		result.Errors = append(result.Errors, ImportRowError{Row: row, Message: msg})
+	}
+	// rows are grouped into respondents by user_id, rows without one are respondents of their own
+	answered := make(map[bson.ObjectID]map[answerKey]bool)
+	responses := []any{}
+	now := time.Now()
+	for row, record := range records {
+		questionId, err := bson.ObjectIDFromHex(record.QuestionId)
+		if err != nil {
+			reject(row, "Invalid Question Id")
+			continue
+		}
+		q, ok := questions[questionId]
+		if !ok {
+			reject(row, "the question does not belong to this survey")
+			continue
+		}
+		if record.ResponseText == "" {
+			reject(row, "response_text is required")
+			continue
+		}
+		userId := bson.NewObjectID()
+		if record.UserId != "" {
+			if userId, err = bson.ObjectIDFromHex(record.UserId); err != nil {
+				reject(row, "Invalid User Id")
+				continue
+			}
+		}
+		createdAt := now
+		if record.CreatedAt != "" {
+			if createdAt, err = time.Parse(time.RFC3339, record.CreatedAt); err != nil {
+				reject(row, "Invalid created_at, expected an RFC3339 timestamp")
+				continue
+			}
+		}
+		var rowId bson.ObjectID
+		if record.RowId != "" {
+			if rowId, err = bson.ObjectIDFromHex(record.RowId); err != nil {
+				reject(row, "Invalid Row Id")
+				continue
+			}
+		}
+		if answered[userId] == nil {
+			answered[userId] = make(map[answerKey]bool)
+		}
+		input := ResponseInput{QuestionId: questionId, RowId: rowId, ResponseText: record.ResponseText, OtherText: record.OtherText}
+		key := answerKey{questionId, rowId}
+		if msg := validateResponseShape(q, input, answered[userId][key]); msg != "" {
+			reject(row, msg)
+			continue
+		}
+		answered[userId][key] = true
+		value, text, _ := responseValue(q, input)
+
+		responses = append(responses, Response{
+			Id:               bson.NewObjectID(),
+			UserId:           userId,
+			CreatedAt:        createdAt,
+			SurveyId:         id,
+			QuestionId:       questionId,
+			RowId:            rowId,
+			ResponseText:     text,
+			Value:            value,
+			OtherText:        strings.TrimSpace(record.OtherText),
+			QuestionSnapshot: q.snapshot(rowId),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), streamTimeout)
+	defer cancel()
+
+	if len(responses) > 0 {
+		// every imported respondent takes a slot of the quota like a submission, respondents who already
+		// have responses in the survey took theirs
+		imported := make(map[bson.ObjectID]bool)
+		userIds := bson.A{}
+		for _, response := range responses {
+			if userId := response.(Response).UserId; !imported[userId] {
+				imported[userId] = true
+				userIds = append(userIds, userId)
+			}
+		}
+		existing, err := responsesCollection.Distinct(ctx, "user_id", bson.M{"survey_id": id, "user_id": bson.M{"$in": userIds}}).Raw()
+		if err != nil {
+			panic(err)
+		}
+		values, err := existing.Values()
+		if err != nil {
+			panic(err)
+		}
+		respondents := len(imported) - len(values)
+		if respondents > 0 {
+			_, reserved, err := reserveResponseSlot(ctx, id, respondents)
+			if err != nil {
+				panic(err)
+			}
+			if !reserved {
+				http.Error(w, fmt.Sprintf("importing %d respondents would exceed the max_responses of the survey, nothing has been imported", respondents), http.StatusForbidden)
+				return
+			}
+		}
+
+		res, err := responsesCollection.InsertMany(ctx, responses)
+		if err != nil {
+			// give the slots back
+			if respondents > 0 {
+				if _, _, err := reserveResponseSlot(ctx, id, -respondents); err != nil {
+					log.Println(err)
+				}
+			}
+			log.Println(err)
+			http.Error(w, "Failed to import responses", http.StatusInternalServerError)
+			return
+		}
+		result.Imported = len(res.InsertedIDs)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// validate a submission against its survey and turn it into response documents of userId
+func buildResponses(ctx context.Context, w http.ResponseWriter, survey Survey, submission SubmissionInput, userId bson.ObjectID) ([]any, bool) {
+	responseInputs := submission.Responses
+
+	acquisition, err := submission.Acquisition.normalized()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	respondentEmail := strings.TrimSpace(submission.RespondentEmail)
+	if survey.isAnonymous() {
+		if respondentEmail != "" {
+			http.Error(w, "the survey is anonymous, respondent email must not be provided", http.StatusBadRequest)
+			return nil, false
+		}
+	} else {
+		address, err := mail.ParseAddress(respondentEmail)
+		if err != nil || address.Address != respondentEmail {
+			http.Error(w, "a valid respondent email is required for this survey", http.StatusBadRequest)
+			return nil, false
+		}
+		if config.HashRespondentEmail {
+			respondentEmail = hashEmail(respondentEmail)
+		}
+	}
+
+	session := strings.TrimSpace(submission.Session)
+	if len(session) > maxSessionLength {
+		http.Error(w, fmt.Sprintf("session should be at most %d characters", maxSessionLength), http.StatusBadRequest)
+		return nil, false
+	}
+	var positions map[bson.ObjectID]int
+	if survey.isRandomized() && session != "" {
+		positions = survey.questionPositions(session)
+	}
+
+	questions := make(map[bson.ObjectID]Question, len(survey.Questions))
+	for _, q := range survey.Questions {
+		questions[q.Id] = q
+	}
+
+	// validate the whole submission before storing anything
+	if errs := validateResponses(survey.Questions, responseInputs); len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return nil, false
+	}
+	errs, err := checkUploads(ctx, survey, responseInputs, submission.RespondentId, userId)
+	if err != nil {
+		panic(err)
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return nil, false
 	}
 
-	_, err = surveysCollection.Indexes().CreateOne(ctx, indexModel)
-	if err != nil {
-		log.Fatal(err)
+	responses := make([]any, 0, len(responseInputs))
+	for _, input := range responseInputs {
+		var response Response
+		response.Id = bson.NewObjectID()
+		response.UserId = userId
+		response.CreatedAt = time.Now()
+		response.SurveyId = survey.Id
+		response.QuestionId = input.QuestionId
+		response.RowId = input.RowId
+		// validated above
+		response.Value, response.ResponseText, _ = responseValue(questions[input.QuestionId], input)
+		response.OtherText = strings.TrimSpace(input.OtherText)
+		response.RespondentEmail = respondentEmail
+		response.RespondentId = submission.RespondentId
+		response.Metadata = submission.Metadata
+		response.Device, response.Browser = submission.Device, submission.Browser
+		response.Acquisition = acquisition
+		response.BotFlags = submission.BotFlags
+		response.Position = positions[input.QuestionId]
+		if q := questions[input.QuestionId]; q.ShuffleAnswers && session != "" {
+			response.AnswerOrder = q.answerOrder(survey.Id, session)
+		}
+		response.QuestionSnapshot = questions[input.QuestionId].snapshot(input.RowId)
+		screenResponse(survey, questions[input.QuestionId], &response)
+		responses = append(responses, response)
 	}
 
+	return responses, true
 }
 
-// generate token
-func genToken() string {
-	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
-	b := make([]byte, 5)
-	for i := range b {
-		b[i] = letters[rand.Intn(len(letters))]
-	}
-	return string(b)
+// hex encoded sha256 of the normalized email, so identified responses can be matched without storing the address
+func hashEmail(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(email)))
+	return hex.EncodeToString(sum[:])
 }
 
-func isSurveyIdExist(w http.ResponseWriter, id bson.ObjectID) bool {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	var test Survey
-	err := surveysCollection.FindOne(ctx, bson.M{"_id": id}).Decode(test)
+// streamed exports can take much longer than a single lookup
+const streamTimeout = 60 * time.Second
 
-	if err == mongo.ErrNoDocuments {
-		http.Error(w, "the survey does not exist, please provide correct survey id", http.StatusBadRequest)
-		return false
-	}
+// flush the streamed array to the client every streamFlushSize documents
+const streamFlushSize = 100
 
-	return true
-}
+// write every response of the cursor as one JSON array without loading the whole result set into memory
+func streamResponses(ctx context.Context, w http.ResponseWriter, cursor *mongo.Cursor) {
+	w.Header().Set("Content-Type", "application/json")
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
 
-func validateQuestionTypes(w http.ResponseWriter, t string, a []string) bool {
-	switch t {
-	case "Multiple Choice":
-		if len(a) < 2 {
-			http.Error(w, "Failed to create survey, MC Question should have more than 1 answer", http.StatusBadRequest)
-			return false
+	w.Write([]byte("["))
+	count := 0
+	for cursor.Next(ctx) {
+		var response Response
+		if err := cursor.Decode(&response); err != nil {
+			log.Println(err)
+			break
 		}
-	case "Likert Scale":
-		if len(a) < 3 {
-			http.Error(w, "Failed to create survey, Likert Scale Question should have more than 2 answers", http.StatusBadRequest)
-			return false
+		if count > 0 {
+			w.Write([]byte(","))
+		}
+		if err := encoder.Encode(response); err != nil {
+			// the client has gone away, nothing more can be sent
+			log.Println(err)
+			return
+		}
+		count++
+		if flusher != nil && count%streamFlushSize == 0 {
+			flusher.Flush()
 		}
 	}
-	return true
-}
-
-// extra: get all existing surveys token for displaying a list of surveys
-func getAllSurveysList(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("get surveys list")
-	page := r.URL.Query().Get("page")
-	limit := r.URL.Query().Get("limit")
-	p, err := strconv.ParseInt(page, 10, 64)
-	l, err := strconv.ParseInt(limit, 10, 64)
-	if p < 1 || l < 1 || p > l {
-		//return all surveys if you enter unexpected string or number
-		p = 0
-		l = 0
-	}
-	skip := p*l - l
-	fOpt := options.Find().SetSkip(skip).SetLimit(l)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	cursor, err := surveysCollection.Find(ctx, bson.D{{}}, fOpt)
-	if err != nil {
-		panic(err)
-	}
-	var surveysList []SurveysList
-	if err = cursor.All(ctx, &surveysList); err != nil {
-		log.Panic(err)
+	if err := cursor.Err(); err != nil {
+		log.Println(err)
 	}
-	defer cursor.Close(ctx)
+	w.Write([]byte("]"))
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(surveysList)
+// created_at bounds from the optional from and to query parameters, empty when neither is set
+func parseTimeRange(r *http.Request) (bson.M, error) {
+	return parseTimeBounds(r, "from", "to")
 }
 
-// create survey
-func createSurvey(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("create survey")
-	var survey Survey
-	var validate bool = true
-	_ = json.NewDecoder(r.Body).Decode(&survey)
-	if survey.Title == "" {
-		http.Error(w, "Title is required, please make sure the title field is filled", http.StatusBadRequest)
-		return
+// bounds from two optional query parameters holding RFC3339 timestamps or dates (2006-01-02, UTC).
+// both bounds are inclusive, a date as upper bound includes the whole day
+func parseTimeBounds(r *http.Request, lower, upper string) (bson.M, error) {
+	bounds := bson.M{}
+	var from, to time.Time
+	if value := r.URL.Query().Get(lower); value != "" {
+		t, _, err := parseTimeParam(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s, expected an RFC3339 timestamp or a date", lower)
+		}
+		from = t
+		bounds["$gte"] = t
 	}
-	survey.Id = bson.NewObjectID()
-	survey.Token = genToken()
-	survey.CreatedAt = time.Now()
-	survey.UpdatedAt = survey.CreatedAt
-
-	for i := range survey.Questions {
-		if !validateQuestionTypes(w, survey.Questions[i].QuestionType, survey.Questions[i].Answers) {
-			validate = false
+	if value := r.URL.Query().Get(upper); value != "" {
+		t, isDate, err := parseTimeParam(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s, expected an RFC3339 timestamp or a date", upper)
+		}
+		to = t
+		if isDate {
+			bounds["$lt"] = t.AddDate(0, 0, 1)
+		} else {
+			bounds["$lte"] = t
 		}
-		survey.Questions[i].Id = bson.NewObjectID()
 	}
-
-	if !validate {
-		return
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return nil, fmt.Errorf("Invalid time range, %s is before %s", upper, lower)
 	}
+	return bounds, nil
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+func parseTimeParam(value string) (t time.Time, isDate bool, err error) {
+	if t, err = time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	t, err = time.Parse(time.DateOnly, value)
+	return t, err == nil, err
+}
 
-	_, err := surveysCollection.InsertOne(ctx, survey)
+// fields identifying a respondent, removed when responses are anonymized
+var respondentIdentifyingFields = []string{"respondent_email", "respondent_id", "metadata.ip_hash"}
 
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+// parse a retention period like "720h" or "30d"
+func parseRetention(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(survey)
+	return time.ParseDuration(s)
 }
 
-// update survey by id
-func updateSurvey(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("edit survey")
+// delete or anonymize responses of a survey older than a retention period
+func purgeResponses(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("purge responses")
 	queries := mux.Vars(r)
 	id, err := bson.ObjectIDFromHex(queries["survey_id"])
 	if err != nil {
 		http.Error(w, "Invalid Survey Id", http.StatusBadRequest)
 		return
 	}
-	if !isSurveyIdExist(w, id) {
+	olderThan, err := parseRetention(r.URL.Query().Get("older_than"))
+	if err != nil || olderThan <= 0 {
+		http.Error(w, "Invalid older_than, expected a duration like 720h or 30d", http.StatusBadRequest)
 		return
 	}
-
-	var input Survey
-	err = json.NewDecoder(r.Body).Decode(&input)
-	if err != nil {
-		panic(err)
+	action := r.URL.Query().Get("action")
+	if action == "" {
+		action = "anonymize"
 	}
-
-	updatedSurvey := bson.M{}
-
-	if input.Title != "" {
-		updatedSurvey["title"] = input.Title
+	if action != "anonymize" && action != "delete" {
+		http.Error(w, "Invalid action, expected anonymize or delete", http.StatusBadRequest)
+		return
 	}
 
-	if len(input.Questions) > 0 {
-		for i := range input.Questions {
-			if input.Questions[i].QuestionTitle == "" || input.Questions[i].QuestionType == "" {
-				http.Error(w, "Invalid Question without title or type", http.StatusBadRequest)
-				return
-			}
-			if input.Questions[i].Id.IsZero() {
-				input.Questions[i].Id = bson.NewObjectID()
-			}
+	ctx, cancel := context.WithTimeout(context.Background(), streamTimeout)
+	defer cancel()
+
+	filter := bson.M{"survey_id": id, "created_at": bson.M{"$lt": time.Now().Add(-olderThan)}}
+	var affected int64
+	if action == "delete" {
+		res, err := responsesCollection.DeleteMany(ctx, filter)
+		if err != nil {
+			panic(err)
 		}
-		updatedSurvey["questions"] = input.Questions
+		affected = res.DeletedCount
+	} else {
+		// answers are kept for aggregates, only the respondent details go away
+		unset := bson.M{}
+		orFilter := bson.A{}
+		for _, field := range respondentIdentifyingFields {
+			unset[field] = ""
+			orFilter = append(orFilter, bson.M{field: bson.M{"$exists": true}})
+		}
+		filter["$or"] = orFilter
+		res, err := responsesCollection.UpdateMany(ctx, filter, bson.M{"$unset": unset})
+		if err != nil {
+			panic(err)
+		}
+		affected = res.ModifiedCount
 	}
 
-	if len(updatedSurvey) == 0 {
-		http.Error(w, "No updates", http.StatusBadRequest)
-		return
-	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"action": action, "affected": affected})
+}
 
-	updatedSurvey["updated_at"] = time.Now()
+// get all responses
+func getResponses(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get all responses")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), streamTimeout)
 	defer cancel()
 
-	res, err := surveysCollection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": updatedSurvey})
+	filter := bson.M{}
+	surveyIds, err := accessibleSurveyIds(ctx, r)
 	if err != nil {
-		if res.MatchedCount == 0 {
-			http.Error(w, "No survey found", http.StatusNotFound)
-			return
-		}
 		panic(err)
 	}
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "survey updated"})
-}
-
-// delete survey by id
-func deleteSurvey(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("delete survey")
-	queries := mux.Vars(r)
-	id, err := bson.ObjectIDFromHex(queries["survey_id"])
-	if err != nil {
-		http.Error(w, "Invalid Survey Id", http.StatusBadRequest)
-		return
+	if surveyIds != nil {
+		filter["survey_id"] = bson.M{"$in": surveyIds}
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	res, err := surveysCollection.DeleteOne(ctx, bson.M{"_id": id})
 
-	if res.DeletedCount == 0 {
-		http.Error(w, "Failed to delete survey, survey might have already removed", http.StatusInternalServerError)
+	if isPaged(r) {
+		pageResponses(ctx, w, r, filter)
 		return
 	}
+	cursor, err := responsesCollection.Find(ctx, filter)
 	if err != nil {
 		panic(err)
 	}
+	defer cursor.Close(ctx)
 
-	_, err = responsesCollection.DeleteMany(ctx, bson.M{"survey_id": id})
-	if err != nil {
-		panic(err)
-	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "survey deleted"})
+	streamResponses(ctx, w, cursor)
 }
 
-// get survey by token
-func getSurveyByToken(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("get survey by token")
-	queries := mux.Vars(r)
-	token := queries["token"]
-
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
-
-	var survey Survey
-	err := surveysCollection.FindOne(ctx, bson.M{"token": token}).Decode(&survey)
+// get responses by survey id
+func getResponsesById(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get responses by survey id")
 
+	queries := mux.Vars(r)
+	id, err := bson.ObjectIDFromHex(queries["survey_id"])
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			fmt.Println("No survey found")
-		} else {
-			panic(err)
-		}
+		http.Error(w, "Invalid Survey Id", http.StatusBadRequest)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(survey)
-}
 
-// submit response
-func submitResponse(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("submit response")
-	queries := mux.Vars(r)
-	id, err := bson.ObjectIDFromHex(queries["survey_id"])
+	filter, err := exportFilter(r, id)
 	if err != nil {
-		http.Error(w, "Invalid Survey Id", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q := r.URL.Query().Get("question_id"); q != "" {
+		questionId, err := bson.ObjectIDFromHex(q)
+		if err != nil {
+			http.Error(w, "Invalid Question Id", http.StatusBadRequest)
+			return
+		}
+		filter["question_id"] = questionId
+	}
+	if respondentId := r.URL.Query().Get("respondent_id"); respondentId != "" {
+		filter["respondent_id"] = respondentId
+	}
+	switch r.URL.Query().Get("flagged") {
+	case "":
+	case "true":
+		filter["bot_flags"] = bson.M{"$exists": true}
+	case "false":
+		filter["bot_flags"] = bson.M{"$exists": false}
+	default:
+		http.Error(w, "Invalid flagged, expected true or false", http.StatusBadRequest)
 		return
 	}
+	// the raw responses include the answers held for review unless asked for one state
+	switch moderation := r.URL.Query().Get("moderation"); moderation {
+	case "":
+		delete(filter, "moderation")
+	case ModerationPending, ModerationApproved, ModerationRejected:
+		filter["moderation"] = moderation
+	default:
+		http.Error(w, "Invalid moderation, expected pending, approved or rejected", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), streamTimeout)
+	defer cancel()
 
-	if !isSurveyIdExist(w, id) {
+	if isPaged(r) {
+		pageResponses(ctx, w, r, filter)
 		return
 	}
-	var responseInputs []ResponseInput
-	err = json.NewDecoder(r.Body).Decode(&responseInputs)
+	cursor, err := responsesCollection.Find(ctx, filter)
 	if err != nil {
 		panic(err)
 	}
+	defer cursor.Close(ctx)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	userId := bson.NewObjectID()
+	streamResponses(ctx, w, cursor)
+}
 
-	for _, input := range responseInputs {
-		if input.QuestionId.IsZero() || input.ResponseText == "" {
-			http.Error(w, "Invalid input from submission", http.StatusBadRequest)
-			return
-		}
-		var response Response
-		response.Id = bson.NewObjectID()
-		response.UserId = userId
-		response.CreatedAt = time.Now()
-		response.SurveyId = id
-		response.QuestionId = input.QuestionId
-		response.ResponseText = input.ResponseText
+// responses are paged when after or limit is given, otherwise every response is streamed
+func isPaged(r *http.Request) bool {
+	return r.URL.Query().Has("after") || r.URL.Query().Has("limit")
+}
 
-		_, err := responsesCollection.InsertOne(ctx, response)
+// write one page of the responses matching filter, ordered by _id
+func pageResponses(ctx context.Context, w http.ResponseWriter, r *http.Request, filter bson.M) {
+	l := pageLimit(r)
+	if after := r.URL.Query().Get("after"); after != "" {
+		id, err := decodeCursor(after)
 		if err != nil {
-			http.Error(w, "Failed to submit response", http.StatusInternalServerError)
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
 			return
 		}
+		filter["_id"] = bson.M{"$gt": id}
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(responseInputs)
-}
-
-// get responses by survey id
-func getResponses(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("get all responses")
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	cursor, err := responsesCollection.Find(ctx, bson.D{{}})
+	fOpt := options.Find().SetSort(bson.M{"_id": 1}).SetLimit(l + 1) // one extra row tells whether there is a next page
+	cursor, err := responsesCollection.Find(ctx, filter, fOpt)
 	if err != nil {
 		panic(err)
 	}
 	defer cursor.Close(ctx)
-	var responsesList []Response
-	if err = cursor.All(ctx, &responsesList); err != nil {
-		log.Panic(err)
+	page := ResponsesPage{Data: []Response{}}
+	if err = cursor.All(ctx, &page.Data); err != nil {
+		panic(err)
+	}
+	if int64(len(page.Data)) > l {
+		page.Data = page.Data[:l]
+		page.NextCursor = encodeCursor(page.Data[l-1].Id)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(responsesList)
+	json.NewEncoder(w).Encode(page)
 }
 
-// get responses by survey id
-func getResponsesById(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("get responses by survey id")
-
+// get respondent count, average answers and completion rate of a survey
+func getSurveyStats(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get survey stats")
 	queries := mux.Vars(r)
 	id, err := bson.ObjectIDFromHex(queries["survey_id"])
 	if err != nil {
@@ -414,18 +2395,203 @@ func getResponsesById(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	cursor, err := responsesCollection.Find(ctx, bson.D{{"survey_id", id}})
+	var survey Survey
+	err = surveysCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&survey)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "No survey found", http.StatusNotFound)
+			return
+		}
+		panic(err)
+	}
+
+	// a respondent completed the survey when they answered every required question of it,
+	// or every question when none is required
+	questionIds := bson.A{}
+	for _, q := range survey.Questions {
+		if q.Required {
+			questionIds = append(questionIds, q.Id)
+		}
+	}
+	if len(questionIds) == 0 {
+		for _, q := range survey.Questions {
+			questionIds = append(questionIds, q.Id)
+		}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"survey_id": id}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      "$user_id",
+			"answered": bson.M{"$addToSet": "$question_id"},
+			"answers":  bson.M{"$sum": 1},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":         nil,
+			"respondents": bson.M{"$sum": 1},
+			"answers":     bson.M{"$sum": "$answers"},
+			"completed": bson.M{"$sum": bson.M{
+				"$cond": bson.A{bson.M{"$setIsSubset": bson.A{questionIds, "$answered"}}, 1, 0},
+			}},
+		}}},
+	}
+	cursor, err := responsesCollection.Aggregate(ctx, pipeline)
 	if err != nil {
 		panic(err)
 	}
 	defer cursor.Close(ctx)
-	var responsesList []Response
-	if err = cursor.All(ctx, &responsesList); err != nil {
+	var results []struct {
+		Respondents int `bson:"respondents"`
+		Answers     int `bson:"answers"`
+		Completed   int `bson:"completed"`
+	}
+	if err = cursor.All(ctx, &results); err != nil {
 		log.Panic(err)
 	}
 
+	stats := SurveyStats{SurveyId: id}
+	if len(results) > 0 && results[0].Respondents > 0 {
+		stats.Respondents = results[0].Respondents
+		stats.AverageAnswers = float64(results[0].Answers) / float64(results[0].Respondents)
+		stats.CompletionRate = float64(results[0].Completed) / float64(results[0].Respondents)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(responsesList)
+	json.NewEncoder(w).Encode(stats)
+}
+
+// reply with a JSON error body instead of gorilla/mux's plain text defaults
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSONError(w, http.StatusNotFound, "no endpoint found for "+r.URL.Path)
+}
+
+// answer with the methods the path supports, OPTIONS requests get them without an error
+func methodNotAllowedHandler(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var allowed []string
+		for _, method := range []string{"GET", "POST", "PUT", "PATCH", "DELETE"} {
+			req := r.Clone(r.Context())
+			req.Method = method
+			var match mux.RouteMatch
+			if router.Match(req, &match) && match.MatchErr == nil {
+				allowed = append(allowed, method)
+			}
+		}
+		allowed = append(allowed, "OPTIONS")
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSONError(w, http.StatusMethodNotAllowed, "method "+r.Method+" is not allowed for "+r.URL.Path)
+	})
+}
+
+// routes of the API, with the rate limiters of the configuration
+func newRouter() *mux.Router {
+	var submitLimiter, createLimiter *rateLimiter
+	if config.RateLimit {
+		submitLimiter = newRateLimiter(config.SubmitRateLimit, config.RateLimitBurst)
+		createLimiter = newRateLimiter(config.CreateRateLimit, config.RateLimitBurst)
+	}
+	r := mux.NewRouter()
+	r.Use(loggingMiddleware)
+	r.Handle("/metrics", promhttp.Handler()).Methods("GET")                                                                                                  //prometheus metrics
+	r.HandleFunc("/auth/login", login).Methods("POST")                                                                                                       //issue access and refresh token
+	r.HandleFunc("/auth/refresh", refreshToken).Methods("POST")                                                                                              //exchange refresh token
+	r.HandleFunc("/auth/register", register).Methods("POST")                                                                                                 //register a survey author
+	r.HandleFunc("/auth/verify-email", verifyEmail).Methods("POST")                                                                                          //verify the email of an author
+	r.HandleFunc("/auth/verify-email/resend", requireAuth(resendEmailVerification)).Methods("POST")                                                          //email a new verification token
+	r.HandleFunc("/auth/google", googleLogin).Methods("GET")                                                                                                 //sign in with google
+	r.HandleFunc("/auth/google/link", requireAuth(googleLink)).Methods("POST")                                                                               //link a google account to the author
+	r.HandleFunc("/auth/google/callback", googleCallback).Methods("GET")                                                                                     //google oauth2 callback
+	r.HandleFunc("/question-types", getQuestionTypes).Methods("GET")                                                                                         //list supported question types
+	r.HandleFunc("/surveys", requireAuth(getAllSurveysList)).Methods("GET")                                                                                  //list out all created survey by page, default 10 item in 1 page
+	r.HandleFunc("/surveys", rateLimited(createLimiter, requireAuth(createSurvey))).Methods("POST")                                                          //create survey
+	r.HandleFunc("/surveys/trash", requireAuth(getTrash)).Methods("GET")                                                                                     //list deleted surveys
+	r.HandleFunc("/surveys/search", requireAuth(searchSurveys)).Methods("GET")                                                                               //search surveys by title and questions
+	r.HandleFunc("/surveys/import", requireAuth(importSurvey)).Methods("POST")                                                                               //create survey from a portable definition
+	r.HandleFunc("/surveys/import/google-forms", requireAuth(importGoogleForm)).Methods("POST")                                                              //create survey from a google forms export
+	r.HandleFunc("/surveys/import/typeform", requireAuth(importTypeform)).Methods("POST")                                                                    //create survey from a typeform definition
+	r.HandleFunc("/surveys/{survey_id}", requireRole(RoleViewer, getSurveyById)).Methods("GET")                                                              //get full survey by id
+	r.HandleFunc("/surveys/{survey_id}", requireRole(RoleEditor, updateSurvey)).Methods("PUT")                                                               //update survey
+	r.HandleFunc("/surveys/{survey_id}/title", requireRole(RoleEditor, renameSurvey)).Methods("PATCH")                                                       //rename survey only
+	r.HandleFunc("/surveys/{survey_id}/publish", requireRole(RoleEditor, publishSurvey)).Methods("POST")                                                     //open survey for responses
+	r.HandleFunc("/surveys/{survey_id}/close", requireRole(RoleEditor, closeSurvey)).Methods("POST")                                                         //stop accepting responses
+	r.HandleFunc("/surveys/{survey_id}", requireRole(RoleOwner, deleteSurvey)).Methods("DELETE")                                                             //delete survey
+	r.HandleFunc("/surveys/{survey_id}/restore", requireTrashedRole(RoleOwner, restoreSurvey)).Methods("POST")                                               //restore survey from the trash
+	r.HandleFunc("/surveys/{survey_id}/clone", requireRole(RoleViewer, cloneSurvey)).Methods("POST")                                                         //copy survey into a new draft
+	r.HandleFunc("/surveys/{survey_id}/export", requireRole(RoleViewer, exportSurvey)).Methods("GET")                                                        //export survey as a portable definition
+	r.HandleFunc("/surveys/token/{token}", getSurveyByToken).Methods("GET")                                                                                  //get survey by token
+	r.HandleFunc("/surveys/token/{token}/render", renderSurvey).Methods("POST")                                                                              //respondent view with earlier answers inserted
+	r.HandleFunc("/surveys/token/{token}/pages/{page}", getSurveyPage).Methods("GET")                                                                        //respondent view of one page
+	r.HandleFunc("/surveys/{survey_id}/stats", requireRole(RoleViewer, getSurveyStats)).Methods("GET")                                                       //get respondent stats of a survey
+	r.HandleFunc("/surveys/{survey_id}/report.pdf", requireRole(RoleViewer, getSurveyReport)).Methods("GET")                                                 //pdf report of the results
+	r.HandleFunc("/surveys/{survey_id}/results", requireRole(RoleViewer, getSurveyResults)).Methods("GET")                                                   //answer counts and percentages per question
+	r.HandleFunc("/surveys/{survey_id}/results/live", tokenFromQuery(requireRole(RoleViewer, getLiveResults))).Methods("GET")                                //websocket of results updated as answers arrive
+	r.HandleFunc("/surveys/{survey_id}/nps", requireRole(RoleViewer, getSurveyNPS)).Methods("GET")                                                           //net promoter score
+	r.HandleFunc("/surveys/{survey_id}/crosstab", requireRole(RoleViewer, getCrosstab)).Methods("GET")                                                       //contingency table of two questions
+	r.HandleFunc("/surveys/{survey_id}/volume", requireRole(RoleViewer, getResponseVolume)).Methods("GET")                                                   //submissions per hour, day or week
+	r.HandleFunc("/surveys/{survey_id}/countries", requireRole(RoleViewer, getCountryBreakdown)).Methods("GET")                                              //submissions per country and region
+	r.HandleFunc("/surveys/{survey_id}/devices", requireRole(RoleViewer, getDeviceBreakdown)).Methods("GET")                                                 //submissions per device class and browser
+	r.HandleFunc("/surveys/{survey_id}/sources", requireRole(RoleViewer, getSourceBreakdown)).Methods("GET")                                                 //submissions per utm source, medium, campaign or referrer
+	r.HandleFunc("/surveys/{survey_id}/submissions", requireRole(RoleViewer, getSubmissions)).Methods("GET")                                                 //responses grouped by respondent
+	r.HandleFunc("/surveys/{survey_id}/responses/stream", requireRole(RoleViewer, streamNewResponses)).Methods("GET")                                        //server-sent events of new responses
+	r.HandleFunc("/surveys/{survey_id}/versions", requireRole(RoleViewer, getSurveyVersions)).Methods("GET")                                                 //list previous versions of a survey
+	r.HandleFunc("/surveys/{survey_id}/versions/diff", requireRole(RoleViewer, diffSurveyVersions)).Methods("GET")                                           //diff two versions
+	r.HandleFunc("/surveys/{survey_id}/versions/{version}/rollback", requireRole(RoleEditor, rollbackSurvey)).Methods("POST")                                //roll back to a version
+	r.HandleFunc("/surveys/{survey_id}/sections", requireRole(RoleEditor, addSection)).Methods("POST")                                                       //add a section, a page of the survey
+	r.HandleFunc("/surveys/{survey_id}/sections/{section_id}", requireRole(RoleEditor, updateSection)).Methods("PUT")                                        //change a section or move questions onto it
+	r.HandleFunc("/surveys/{survey_id}/sections/{section_id}", requireRole(RoleEditor, deleteSection)).Methods("DELETE")                                     //remove a section
+	r.HandleFunc("/surveys/{survey_id}/translations/{lang}", requireRole(RoleEditor, setTranslation)).Methods("PUT")                                         //add or replace a translation
+	r.HandleFunc("/surveys/{survey_id}/translations/{lang}", requireRole(RoleEditor, deleteTranslation)).Methods("DELETE")                                   //remove a translation
+	r.HandleFunc("/surveys/{survey_id}/questions/{question_id}", requireRole(RoleViewer, getQuestion)).Methods("GET")                                        //get a single question
+	r.HandleFunc("/surveys/{survey_id}/questions", requireRole(RoleEditor, addQuestion)).Methods("POST")                                                     //add a question
+	r.HandleFunc("/surveys/{survey_id}/questions/order", requireRole(RoleEditor, reorderQuestions)).Methods("PATCH")                                         //reorder the questions
+	r.HandleFunc("/surveys/{survey_id}/questions/{question_id}", requireRole(RoleEditor, updateQuestion)).Methods("PUT")                                     //replace a single question
+	r.HandleFunc("/surveys/{survey_id}/questions/{question_id}", requireRole(RoleEditor, deleteQuestion)).Methods("DELETE")                                  //delete a single question
+	r.HandleFunc("/surveys/{survey_id}/questions/{question_id}/stats", requireRole(RoleViewer, getQuestionStats)).Methods("GET")                             //likert statistics of a question
+	r.HandleFunc("/surveys/{survey_id}/questions/{question_id}/words", requireRole(RoleViewer, getQuestionWords)).Methods("GET")                             //most frequent terms of text answers
+	r.HandleFunc("/surveys/{survey_id}/questions/{question_id}/ranking", requireRole(RoleViewer, getRankingResults)).Methods("GET")                          //average rank of every option of a Ranking question
+	r.HandleFunc("/surveys/{survey_id}/files/{file_id}", requireRole(RoleViewer, downloadFile)).Methods("GET")                                               //download a file uploaded by a respondent
+	r.HandleFunc("/surveys/{survey_id}/members", requireRole(RoleViewer, getMembers)).Methods("GET")                                                         //list collaborators
+	r.HandleFunc("/surveys/{survey_id}/members/{user_id}", requireRole(RoleOwner, setMember)).Methods("PUT")                                                 //add collaborator or change role
+	r.HandleFunc("/surveys/{survey_id}/members/{user_id}", requireRole(RoleOwner, removeMember)).Methods("DELETE")                                           //remove collaborator
+	r.HandleFunc("/surveys/{survey_id}/moderation", requireRole(RoleEditor, getModerationQueue)).Methods("GET")                                              //text answers held for review
+	r.HandleFunc("/surveys/{survey_id}/moderation/{response_id}/approve", requireRole(RoleEditor, approveResponse)).Methods("POST")                          //show a held text answer in results
+	r.HandleFunc("/surveys/{survey_id}/moderation/{response_id}/reject", requireRole(RoleEditor, rejectResponse)).Methods("POST")                            //keep a held text answer out of results
+	r.HandleFunc("/surveys/{survey_id}/webhooks", requireRole(RoleEditor, getWebhooks)).Methods("GET")                                                       //list webhooks
+	r.HandleFunc("/surveys/{survey_id}/webhooks", requireRole(RoleEditor, createWebhook)).Methods("POST")                                                    //register a webhook
+	r.HandleFunc("/surveys/{survey_id}/webhooks/{webhook_id}", requireRole(RoleEditor, deleteWebhook)).Methods("DELETE")                                     //remove a webhook
+	r.HandleFunc("/surveys/{survey_id}/webhooks/{webhook_id}/deliveries", requireRole(RoleEditor, getWebhookDeliveries)).Methods("GET")                      //list deliveries of a webhook
+	r.HandleFunc("/surveys/{survey_id}/webhooks/{webhook_id}/deliveries/{delivery_id}/redeliver", requireRole(RoleEditor, redeliverWebhook)).Methods("POST") //retry a failed delivery
+	r.HandleFunc("/responses/{survey_id}", rateLimited(submitLimiter, submitResponse)).Methods("POST")                                                       //submit response with survey id
+	r.HandleFunc("/sessions", createSession).Methods("POST")                                                                                                 //start an anonymous respondent session
+	r.HandleFunc("/responses/{survey_id}/questions/{question_id}/files", rateLimited(submitLimiter, uploadFile)).Methods("POST")                             //upload a file answering a File Upload question
+	r.HandleFunc("/responses/{survey_id}/pages/{page}", submitPage).Methods("POST")                                                                          //check the answers up to a page
+	r.HandleFunc("/responses/{survey_id}/partial", savePartialResponse).Methods("POST")                                                                      //save incomplete answers to resume later
+	r.HandleFunc("/responses/{survey_id}/partial/{resume_token}", getPartialResponse).Methods("GET")                                                         //get saved answers
+	r.HandleFunc("/responses/{survey_id}/partial/{resume_token}", updatePartialResponse).Methods("PUT")                                                      //replace saved answers
+	r.HandleFunc("/responses/{survey_id}/partial/{resume_token}/submit", rateLimited(submitLimiter, finalizePartialResponse)).Methods("POST")                //submit saved answers
+	r.HandleFunc("/responses/{survey_id}/import", requireRole(RoleEditor, importResponses)).Methods("POST")                                                  //bulk import historical responses
+	r.HandleFunc("/responses/{survey_id}/purge", requireAdmin(purgeResponses)).Methods("POST")                                                               //delete or anonymize old responses
+	r.HandleFunc("/responses/{survey_id}/user/{user_id}", requireRole(RoleEditor, editResponses)).Methods("PUT")                                             //replace responses of a respondent
+	r.HandleFunc("/responses/{survey_id}/edit", editOwnResponses).Methods("PUT")                                                                             //replace a submission with its edit token
+	r.HandleFunc("/responses", requireAuth(getResponses)).Methods("GET")                                                                                     //get all responses
+	r.HandleFunc("/responses/{survey_id}", requireRole(RoleViewer, getResponsesById)).Methods("GET")                                                         //get response by survey id
+	r.HandleFunc("/responses/{survey_id}/chart", requireRole(RoleViewer, getResponsesChart)).Methods("GET")                                                  //get answer distributions for charts
+	r.HandleFunc("/responses/{survey_id}/export.csv", requireRole(RoleViewer, exportResponsesCSV)).Methods("GET")                                            //export responses as csv, one row per respondent
+	r.HandleFunc("/responses/{survey_id}/export.xlsx", requireRole(RoleViewer, exportResponsesXLSX)).Methods("GET")                                          //export responses and a summary as an excel workbook
+
+	r.NotFoundHandler = http.HandlerFunc(notFoundHandler)
+	r.MethodNotAllowedHandler = methodNotAllowedHandler(r)
+	return r
 }
 
 func main() {
@@ -435,15 +2601,13 @@ func main() {
 			panic(err)
 		}
 	}()
-	r := mux.NewRouter()
-	r.HandleFunc("/surveys", getAllSurveysList).Methods("GET")              //list out all created survey by page, default 10 item in 1 page
-	r.HandleFunc("/surveys", createSurvey).Methods("POST")                  //create survey
-	r.HandleFunc("/surveys/{survey_id}", updateSurvey).Methods("PUT")       //update survey
-	r.HandleFunc("/surveys/{survey_id}", deleteSurvey).Methods("DELETE")    //delete survey
-	r.HandleFunc("/surveys/token/{token}", getSurveyByToken).Methods("GET") //get survey by token
-	r.HandleFunc("/responses/{survey_id}", submitResponse).Methods("POST")  //submit response with survey id
-	r.HandleFunc("/responses", getResponses).Methods("GET")                 //get all responses
-	r.HandleFunc("/responses/{survey_id}", getResponsesById).Methods("GET") //get response by survey id
+	closeExpiredSurveys()
+	startExpiryScheduler(expiryCheckInterval)
+	startUploadCleanup(uploadCleanupInterval)
+	startWebhookWorkers(config.WebhookWorkers)
+	startEventBus()
+	startMailer()
+	r := newRouter()
 
 	fmt.Println("Server is running on http://localhost:5050")
 	log.Fatal(http.ListenAndServe(":5050", r))
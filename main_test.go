@@ -0,0 +1,1029 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// tests reading or writing MongoDB run against the server of MONGODB_TEST_URI, e.g.
+// mongodb://localhost:27017, each in a database of its own. they are skipped when it is unset
+var testClient *mongo.Client
+
+func TestMain(m *testing.M) {
+	config = loadConfig()
+	if uri := os.Getenv("MONGODB_TEST_URI"); uri != "" {
+		var err error
+		if testClient, err = mongo.Connect(options.Client().ApplyURI(uri)); err != nil {
+			log.Fatal(err)
+		}
+		client = testClient
+	}
+	code := m.Run()
+	if testClient != nil {
+		testClient.Disconnect(context.Background())
+	}
+	os.Exit(code)
+}
+
+// point the collections at an empty database, dropped once the test is over
+func testDB(t *testing.T) context.Context {
+	t.Helper()
+	if testClient == nil {
+		t.Skip("MONGODB_TEST_URI is not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cancel)
+	db := testClient.Database("OSP_backend_test_" + bson.NewObjectID().Hex())
+	openDatabase(ctx, db)
+	t.Cleanup(func() { db.Drop(context.Background()) })
+	return ctx
+}
+
+// restore the configuration once the test is over, so it can change config freely
+func keepConfig(t *testing.T) {
+	saved := config
+	t.Cleanup(func() { config = saved })
+}
+
+// insert a published survey, filling in its id, token and the ids of its questions
+func insertSurvey(t *testing.T, ctx context.Context, survey Survey) Survey {
+	t.Helper()
+	if survey.Id.IsZero() {
+		survey.Id = bson.NewObjectID()
+	}
+	if survey.Token == "" {
+		survey.Token = genToken()
+	}
+	if survey.Status == "" {
+		survey.Status = StatusPublished
+	}
+	if survey.CreatedAt.IsZero() {
+		survey.CreatedAt = time.Now()
+		survey.UpdatedAt = survey.CreatedAt
+	}
+	for i := range survey.Questions {
+		if survey.Questions[i].Id.IsZero() {
+			survey.Questions[i].Id = bson.NewObjectID()
+		}
+	}
+	if _, err := surveysCollection.InsertOne(ctx, survey); err != nil {
+		t.Fatal(err)
+	}
+	return survey
+}
+
+// serve a request with handler, with the route variables the router would set. body is sent as is
+// when it is a string and as JSON otherwise
+func serve(handler http.HandlerFunc, method, target string, body any, vars map[string]string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			panic(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	r := httptest.NewRequest(method, target, reader)
+	if vars != nil {
+		r = mux.SetURLVars(r, vars)
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+// decode the JSON body of a response, failing the test when it is not
+func decodeBody[T any](t *testing.T, w *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+		t.Fatalf("invalid JSON body %q: %v", w.Body.String(), err)
+	}
+	return v
+}
+
+func TestGetSurveyByTokenIgnoresCase(t *testing.T) {
+	ctx := testDB(t)
+	insertSurvey(t, ctx, Survey{Token: "AbCdE", Title: "Case"})
+
+	for _, token := range []string{"AbCdE", "abcde", "ABCDE", "aBcDe"} {
+		w := serve(getSurveyByToken, "GET", "/surveys/token/"+token, nil, map[string]string{"token": token})
+		if w.Code != http.StatusOK {
+			t.Fatalf("token %s: status %d", token, w.Code)
+		}
+		if got := decodeBody[PublicSurvey](t, w); got.Token != "AbCdE" || got.Title != "Case" {
+			t.Errorf("token %s: got survey %q (%s)", token, got.Title, got.Token)
+		}
+	}
+}
+
+func TestTokensAreUniqueIgnoringCase(t *testing.T) {
+	ctx := testDB(t)
+	insertSurvey(t, ctx, Survey{Token: "AbCdE", Title: "First"})
+
+	_, err := surveysCollection.InsertOne(ctx, Survey{Id: bson.NewObjectID(), Token: "abcde", Title: "Second"})
+	if !mongo.IsDuplicateKeyError(err) {
+		t.Fatalf("expected a duplicate key error, got %v", err)
+	}
+}
+
+// a response of respondent userId answering a question of a survey with text
+func answer(surveyId, userId, questionId bson.ObjectID, text string) Response {
+	return Response{
+		Id:           bson.NewObjectID(),
+		UserId:       userId,
+		CreatedAt:    time.Now(),
+		SurveyId:     surveyId,
+		QuestionId:   questionId,
+		ResponseText: text,
+	}
+}
+
+func insertResponses(t *testing.T, ctx context.Context, responses ...Response) {
+	t.Helper()
+	if _, err := responsesCollection.InsertMany(ctx, responses); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSurveyStatsCompletionRate(t *testing.T) {
+	ctx := testDB(t)
+	survey := insertSurvey(t, ctx, Survey{Title: "Stats", Questions: []Question{
+		{QuestionTitle: "Name", QuestionType: "Textbox", Required: true},
+		{QuestionTitle: "Role", QuestionType: "Textbox", Required: true},
+		{QuestionTitle: "Comments", QuestionType: "Textbox"},
+	}})
+	name, role, comments := survey.Questions[0].Id, survey.Questions[1].Id, survey.Questions[2].Id
+	complete, completeRequired, partial, optionalOnly := bson.NewObjectID(), bson.NewObjectID(), bson.NewObjectID(), bson.NewObjectID()
+	insertResponses(t, ctx,
+		answer(survey.Id, complete, name, "Ann"), answer(survey.Id, complete, role, "Dev"), answer(survey.Id, complete, comments, "Nice"),
+		answer(survey.Id, completeRequired, name, "Bob"), answer(survey.Id, completeRequired, role, "Ops"),
+		answer(survey.Id, partial, name, "Cid"),
+		answer(survey.Id, optionalOnly, comments, "Hi"),
+	)
+
+	w := serve(getSurveyStats, "GET", "/surveys/"+survey.Id.Hex()+"/stats", nil, map[string]string{"survey_id": survey.Id.Hex()})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	stats := decodeBody[SurveyStats](t, w)
+	if stats.Respondents != 4 {
+		t.Errorf("respondents = %d, want 4", stats.Respondents)
+	}
+	if stats.CompletionRate != 0.5 {
+		t.Errorf("completion rate = %v, want 0.5", stats.CompletionRate)
+	}
+	if stats.AverageAnswers != 1.75 {
+		t.Errorf("average answers = %v, want 1.75", stats.AverageAnswers)
+	}
+}
+
+func TestSurveyStatsUnknownSurvey(t *testing.T) {
+	testDB(t)
+	id := bson.NewObjectID().Hex()
+	if w := serve(getSurveyStats, "GET", "/surveys/"+id+"/stats", nil, map[string]string{"survey_id": id}); w.Code != http.StatusNotFound {
+		t.Fatalf("status %d, want 404", w.Code)
+	}
+}
+
+func TestUpdateSurveyWithStaleVersion(t *testing.T) {
+	ctx := testDB(t)
+	survey := insertSurvey(t, ctx, Survey{Title: "Original", Version: 3})
+	vars := map[string]string{"survey_id": survey.Id.Hex()}
+
+	w := serve(updateSurvey, "PUT", "/surveys/"+survey.Id.Hex(), map[string]any{"title": "First edit", "version": 3}, vars)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if got := decodeBody[struct{ Version int }](t, w); got.Version != 4 {
+		t.Fatalf("version = %d, want 4", got.Version)
+	}
+
+	// a second client still holding version 3
+	w = serve(updateSurvey, "PUT", "/surveys/"+survey.Id.Hex(), map[string]any{"title": "Stale edit", "version": 3}, vars)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status %d, want 409", w.Code)
+	}
+	var stored Survey
+	if err := surveysCollection.FindOne(ctx, bson.M{"_id": survey.Id}).Decode(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Title != "First edit" || stored.Version != 4 {
+		t.Errorf("stored survey %q version %d, want %q version 4", stored.Title, stored.Version, "First edit")
+	}
+}
+
+func TestGetResponsesByIdStreamsLargeSets(t *testing.T) {
+	ctx := testDB(t)
+	survey := insertSurvey(t, ctx, Survey{Title: "Large", Questions: []Question{{QuestionTitle: "Comments", QuestionType: "Textbox"}}})
+	// more than a few flushes worth of responses
+	const n = 5 * streamFlushSize
+	responses := make([]Response, n)
+	for i := range responses {
+		responses[i] = answer(survey.Id, bson.NewObjectID(), survey.Questions[0].Id, strings.Repeat("x", i%50+1))
+	}
+	insertResponses(t, ctx, responses...)
+
+	vars := map[string]string{"survey_id": survey.Id.Hex()}
+	w := serve(getResponsesById, "GET", "/responses/"+survey.Id.Hex(), nil, vars)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if !json.Valid(w.Body.Bytes()) {
+		t.Fatal("the streamed body is not valid JSON")
+	}
+	got := decodeBody[[]Response](t, w)
+	if len(got) != n {
+		t.Fatalf("got %d responses, want %d", len(got), n)
+	}
+	seen := map[bson.ObjectID]bool{}
+	for _, response := range got {
+		seen[response.Id] = true
+	}
+	if len(seen) != n {
+		t.Errorf("got %d distinct responses, want %d", len(seen), n)
+	}
+
+	// a survey without responses streams an empty array
+	other := insertSurvey(t, ctx, Survey{Title: "Empty"})
+	w = serve(getResponsesById, "GET", "/responses/"+other.Id.Hex(), nil, map[string]string{"survey_id": other.Id.Hex()})
+	if got := decodeBody[[]Response](t, w); len(got) != 0 {
+		t.Errorf("got %d responses for a survey without any", len(got))
+	}
+}
+
+func TestSubmitToSurveyWithoutQuestions(t *testing.T) {
+	ctx := testDB(t)
+	survey := insertSurvey(t, ctx, Survey{Title: "Empty"})
+
+	body := map[string]any{"responses": []map[string]any{{"question_id": bson.NewObjectID(), "response_text": "Hi"}}}
+	w := serve(submitResponse, "POST", "/responses/"+survey.Id.Hex(), body, map[string]string{"survey_id": survey.Id.Hex()})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", w.Code)
+	}
+	if n, err := responsesCollection.CountDocuments(ctx, bson.M{"survey_id": survey.Id}); err != nil || n != 0 {
+		t.Errorf("%d responses stored (%v), want none", n, err)
+	}
+}
+
+func TestRejectedSubmissionsDoNotUseUpTheRateLimit(t *testing.T) {
+	ctx := testDB(t)
+	once, perMinute := true, 2
+	survey := insertSurvey(t, ctx, Survey{Title: "Limited", Questions: []Question{{QuestionTitle: "Name", QuestionType: "Text"}},
+		OneResponsePerRespondent: &once, MaxSubmissionsPerMinute: &perMinute})
+	submit := func(userAgent string) int {
+		data, _ := json.Marshal(map[string]any{"responses": []map[string]any{{"question_id": survey.Questions[0].Id, "response_text": "Ada"}}})
+		r := httptest.NewRequest("POST", "/responses/"+survey.Id.Hex(), bytes.NewReader(data))
+		r.Header.Set("User-Agent", userAgent)
+		r = mux.SetURLVars(r, map[string]string{"survey_id": survey.Id.Hex()})
+		w := httptest.NewRecorder()
+		submitResponse(w, r)
+		return w.Code
+	}
+
+	for _, c := range []struct {
+		respondent string
+		want       int
+	}{
+		{"first", http.StatusCreated},
+		{"first", http.StatusConflict},
+		{"second", http.StatusCreated},
+		{"third", http.StatusTooManyRequests},
+		// the respondent turned away by the rate limit is not recorded as having submitted
+		{"third", http.StatusTooManyRequests},
+	} {
+		if got := submit(c.respondent); got != c.want {
+			t.Errorf("submission of the %s respondent: status %d, want %d", c.respondent, got, c.want)
+		}
+	}
+	var stored Survey
+	if err := surveysCollection.FindOne(ctx, bson.M{"_id": survey.Id}).Decode(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.ResponseCount != 2 {
+		t.Errorf("response count %d, want 2", stored.ResponseCount)
+	}
+}
+
+func TestPublishSurveyWithoutQuestions(t *testing.T) {
+	ctx := testDB(t)
+	survey := insertSurvey(t, ctx, Survey{Title: "Empty", Status: StatusDraft})
+
+	w := serve(publishSurvey, "POST", "/surveys/"+survey.Id.Hex()+"/publish", nil, map[string]string{"survey_id": survey.Id.Hex()})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", w.Code)
+	}
+}
+
+func TestRenameSurveyLeavesQuestionsUntouched(t *testing.T) {
+	ctx := testDB(t)
+	survey := insertSurvey(t, ctx, Survey{Title: "Before", Questions: []Question{
+		{QuestionTitle: "Name", QuestionType: "Textbox"},
+		{QuestionTitle: "Role", QuestionType: "Multiple Choice", Answers: []string{"Dev", "Ops"}},
+	}})
+
+	// a stale questions array sent along is ignored
+	body := map[string]any{"title": "  After  ", "questions": []map[string]any{{"question_title": "Stale", "question_type": "Textbox"}}}
+	w := serve(renameSurvey, "PATCH", "/surveys/"+survey.Id.Hex()+"/title", body, map[string]string{"survey_id": survey.Id.Hex()})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if got := decodeBody[Survey](t, w); got.Title != "After" {
+		t.Errorf("title = %q, want %q", got.Title, "After")
+	}
+
+	var stored Survey
+	if err := surveysCollection.FindOne(ctx, bson.M{"_id": survey.Id}).Decode(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.Questions) != len(survey.Questions) {
+		t.Fatalf("got %d questions, want %d", len(stored.Questions), len(survey.Questions))
+	}
+	for i, q := range stored.Questions {
+		want := survey.Questions[i]
+		if q.Id != want.Id || q.QuestionTitle != want.QuestionTitle || q.QuestionType != want.QuestionType || !slices.Equal(q.Answers, want.Answers) {
+			t.Errorf("question %d = %+v, want %+v", i, q, want)
+		}
+	}
+}
+
+func TestResponseSnapshotSurvivesSurveyEdits(t *testing.T) {
+	ctx := testDB(t)
+	survey := insertSurvey(t, ctx, Survey{Title: "Snapshot", Questions: []Question{
+		{QuestionTitle: "Role", QuestionType: "Multiple Choice", Answers: []string{"Dev", "Ops"}},
+	}})
+	q := survey.Questions[0]
+	vars := map[string]string{"survey_id": survey.Id.Hex()}
+
+	body := map[string]any{"responses": []map[string]any{{"question_id": q.Id, "response_text": "Dev"}}}
+	if w := serve(submitResponse, "POST", "/responses/"+survey.Id.Hex(), body, vars); w.Code != http.StatusCreated {
+		t.Fatalf("submit: status %d: %s", w.Code, w.Body)
+	}
+
+	edited := map[string]any{"questions": []map[string]any{{
+		"id": q.Id, "question_title": "Team", "question_type": "Multiple Choice", "answers": []string{"Dev", "Ops", "QA"},
+	}}}
+	if w := serve(updateSurvey, "PUT", "/surveys/"+survey.Id.Hex(), edited, vars); w.Code != http.StatusOK {
+		t.Fatalf("update: status %d: %s", w.Code, w.Body)
+	}
+
+	var response Response
+	if err := responsesCollection.FindOne(ctx, bson.M{"survey_id": survey.Id}).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := response.QuestionSnapshot
+	if snapshot == nil {
+		t.Fatal("the response has no question snapshot")
+	}
+	if snapshot.QuestionTitle != "Role" || !slices.Equal(snapshot.Answers, []string{"Dev", "Ops"}) {
+		t.Errorf("snapshot = %+v, want the question as it was submitted", *snapshot)
+	}
+}
+
+func TestSubmitRespondentEmail(t *testing.T) {
+	ctx := testDB(t)
+	keepConfig(t)
+	anonymous, identified := true, false
+	submit := func(survey Survey, email string) *httptest.ResponseRecorder {
+		body := map[string]any{
+			"responses":        []map[string]any{{"question_id": survey.Questions[0].Id, "response_text": "Hi"}},
+			"respondent_email": email,
+		}
+		return serve(submitResponse, "POST", "/responses/"+survey.Id.Hex(), body, map[string]string{"survey_id": survey.Id.Hex()})
+	}
+	storedEmail := func(survey Survey) string {
+		t.Helper()
+		var response Response
+		if err := responsesCollection.FindOne(ctx, bson.M{"survey_id": survey.Id}).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		return response.RespondentEmail
+	}
+	questions := func() []Question { return []Question{{QuestionTitle: "Comments", QuestionType: "Textbox"}} }
+
+	open := insertSurvey(t, ctx, Survey{Title: "Anonymous", Anonymous: &anonymous, Questions: questions()})
+	if w := submit(open, "ann@example.com"); w.Code != http.StatusBadRequest {
+		t.Errorf("anonymous survey with an email: status %d, want 400", w.Code)
+	}
+	if w := submit(open, ""); w.Code != http.StatusCreated {
+		t.Fatalf("anonymous survey without an email: status %d: %s", w.Code, w.Body)
+	}
+	if email := storedEmail(open); email != "" {
+		t.Errorf("anonymous response stored the email %q", email)
+	}
+
+	config.HashRespondentEmail = false
+	named := insertSurvey(t, ctx, Survey{Title: "Identified", Anonymous: &identified, Questions: questions()})
+	for _, email := range []string{"", "not an email", "Ann <ann@example.com>"} {
+		if w := submit(named, email); w.Code != http.StatusBadRequest {
+			t.Errorf("identified survey with email %q: status %d, want 400", email, w.Code)
+		}
+	}
+	if w := submit(named, "ann@example.com"); w.Code != http.StatusCreated {
+		t.Fatalf("identified survey with an email: status %d: %s", w.Code, w.Body)
+	}
+	if email := storedEmail(named); email != "ann@example.com" {
+		t.Errorf("stored email = %q, want ann@example.com", email)
+	}
+
+	config.HashRespondentEmail = true
+	hashed := insertSurvey(t, ctx, Survey{Title: "Hashed", Anonymous: &identified, Questions: questions()})
+	if w := submit(hashed, "Ann@Example.com"); w.Code != http.StatusCreated {
+		t.Fatalf("hashed email: status %d: %s", w.Code, w.Body)
+	}
+	if email := storedEmail(hashed); email != hashEmail("ann@example.com") {
+		t.Errorf("stored email = %q, want the hash of the address", email)
+	}
+}
+
+func TestCreateSurveyDryRun(t *testing.T) {
+	ctx := testDB(t)
+	draft := map[string]any{"title": "Draft", "questions": []map[string]any{{"question_title": "Comments", "question_type": "Textbox"}}}
+	w := serve(createSurvey, "POST", "/surveys?validate=true", draft, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("valid draft: status %d: %s", w.Code, w.Body)
+	}
+	if got := decodeBody[map[string]bool](t, w); !got["valid"] {
+		t.Errorf("valid draft: got %v", got)
+	}
+
+	invalid := map[string]any{"questions": []map[string]any{{"question_type": "Textbox"}}}
+	w = serve(createSurvey, "POST", "/surveys?validate=true", invalid, nil)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("invalid draft: status %d, want 422", w.Code)
+	}
+	if errs := decodeBody[[]ValidationError](t, w); len(errs) == 0 {
+		t.Error("invalid draft: no errors reported")
+	}
+
+	if n, err := surveysCollection.CountDocuments(ctx, bson.M{}); err != nil || n != 0 {
+		t.Errorf("dry runs stored %d surveys (%v)", n, err)
+	}
+}
+
+func TestGetQuestion(t *testing.T) {
+	ctx := testDB(t)
+	survey := insertSurvey(t, ctx, Survey{Title: "Questions", Questions: []Question{
+		{QuestionTitle: "Name", QuestionType: "Textbox"},
+		{QuestionTitle: "Role", QuestionType: "Multiple Choice", Answers: []string{"Dev", "Ops"}},
+	}})
+	get := func(surveyId, questionId string) *httptest.ResponseRecorder {
+		return serve(getQuestion, "GET", "/surveys/"+surveyId+"/questions/"+questionId, nil,
+			map[string]string{"survey_id": surveyId, "question_id": questionId})
+	}
+
+	w := get(survey.Id.Hex(), survey.Questions[1].Id.Hex())
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if q := decodeBody[Question](t, w); q.Id != survey.Questions[1].Id || q.QuestionTitle != "Role" {
+		t.Errorf("got question %q (%s), want Role", q.QuestionTitle, q.Id.Hex())
+	}
+	if w := get(bson.NewObjectID().Hex(), survey.Questions[1].Id.Hex()); w.Code != http.StatusNotFound {
+		t.Errorf("unknown survey: status %d, want 404", w.Code)
+	}
+	if w := get(survey.Id.Hex(), bson.NewObjectID().Hex()); w.Code != http.StatusNotFound {
+		t.Errorf("unknown question: status %d, want 404", w.Code)
+	}
+}
+
+func TestGetQuestionRequiresViewer(t *testing.T) {
+	keepConfig(t)
+	config.JWTSecret = []byte("test secret")
+	router := newRouter()
+	get := func(survey Survey, token string) int {
+		r := httptest.NewRequest("GET", "/surveys/"+survey.Id.Hex()+"/questions/"+survey.Questions[0].Id.Hex(), nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+	accessToken := func(userId bson.ObjectID) string {
+		now := time.Now()
+		token, err := signJWT(Claims{userId.Hex(), "access", now.Unix(), now.Add(time.Hour).Unix()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	draft := Survey{Id: bson.NewObjectID(), Questions: []Question{{Id: bson.NewObjectID(), QuestionTitle: "Secret", QuestionType: "Textbox"}}}
+	if code := get(draft, ""); code != http.StatusUnauthorized {
+		t.Errorf("without a token: status %d, want 401", code)
+	}
+
+	ctx := testDB(t)
+	owner, stranger := bson.NewObjectID(), bson.NewObjectID()
+	draft = insertSurvey(t, ctx, Survey{Title: "Draft", Status: StatusDraft, OwnerId: owner, Questions: draft.Questions})
+	if code := get(draft, accessToken(stranger)); code != http.StatusNotFound {
+		t.Errorf("another author: status %d, want 404", code)
+	}
+	if code := get(draft, accessToken(owner)); code != http.StatusOK {
+		t.Errorf("the owner: status %d, want 200", code)
+	}
+}
+
+func TestSurveysListKeysetPagingIgnoresNewSurveys(t *testing.T) {
+	ctx := testDB(t)
+	for i := range 5 {
+		insertSurvey(t, ctx, Survey{Title: fmt.Sprintf("Before %d", i)})
+	}
+	fetch := func(query string) SurveysPage {
+		t.Helper()
+		w := serve(getAllSurveysList, "GET", "/surveys/list?limit=2"+query, nil, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		return decodeBody[SurveysPage](t, w)
+	}
+
+	for _, order := range []string{"", "&sort=created_at&order=desc"} {
+		seen := map[string]int{}
+		page := fetch(order)
+		for _, s := range page.Data {
+			seen[s.Token]++
+		}
+		// surveys created between two fetches must not shift the following pages
+		for i := range 3 {
+			time.Sleep(time.Millisecond)
+			insertSurvey(t, ctx, Survey{Title: fmt.Sprintf("Between %d", i)})
+		}
+		for page.NextCursor != "" {
+			page = fetch(order + "&after=" + page.NextCursor)
+			for _, s := range page.Data {
+				seen[s.Token]++
+			}
+		}
+		for token, n := range seen {
+			if n > 1 {
+				t.Errorf("order %q: survey %s listed %d times", order, token, n)
+			}
+		}
+		if len(seen) < 5 {
+			t.Errorf("order %q: listed %d surveys, want at least the 5 existing before the first page", order, len(seen))
+		}
+	}
+}
+
+func TestUpdateSurveyRejectsDuplicateOptions(t *testing.T) {
+	ctx := testDB(t)
+	survey := insertSurvey(t, ctx, Survey{Title: "Options", Questions: []Question{
+		{QuestionTitle: "Agree", QuestionType: "Multiple Choice", Answers: []string{"Yes", "No"}},
+	}})
+	for _, answers := range [][]string{{"Yes", "YES"}, {"Yes", ""}} {
+		edited := map[string]any{"questions": []map[string]any{{
+			"id": survey.Questions[0].Id, "question_title": "Agree", "question_type": "Multiple Choice", "answers": answers,
+		}}}
+		w := serve(updateSurvey, "PUT", "/surveys/"+survey.Id.Hex(), edited, map[string]string{"survey_id": survey.Id.Hex()})
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("answers %q: status %d, want 422", answers, w.Code)
+		}
+	}
+}
+
+// skip tests relying on transactions on standalone servers, which run withTransaction without one
+func requireTransactions(t *testing.T, ctx context.Context) {
+	t.Helper()
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := testClient.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		t.Fatal(err)
+	}
+	if hello.SetName == "" && hello.Msg != "isdbgrid" {
+		t.Skip("MONGODB_TEST_URI is a standalone server without transactions")
+	}
+}
+
+func TestFailedSurveyDeleteLeavesNoOrphans(t *testing.T) {
+	ctx := testDB(t)
+	requireTransactions(t, ctx)
+	survey := insertSurvey(t, ctx, Survey{Title: "Cascade", Questions: []Question{{QuestionTitle: "Name", QuestionType: "Textbox"}}})
+	insertResponses(t, ctx, answer(survey.Id, bson.NewObjectID(), survey.Questions[0].Id, "Ann"))
+
+	// the process fails between deleting the survey and deleting its responses
+	crash := errors.New("crash")
+	err := withTransaction(ctx, func(ctx context.Context) error {
+		if _, err := surveysCollection.DeleteOne(ctx, bson.M{"_id": survey.Id}); err != nil {
+			return err
+		}
+		return crash
+	})
+	if !errors.Is(err, crash) {
+		t.Fatalf("err = %v, want the failure", err)
+	}
+
+	surveys, err := surveysCollection.CountDocuments(ctx, bson.M{"_id": survey.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	responses, err := responsesCollection.CountDocuments(ctx, bson.M{"survey_id": survey.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if responses > 0 && surveys == 0 {
+		t.Errorf("%d responses were left without their survey", responses)
+	}
+	if surveys != 1 || responses != 1 {
+		t.Errorf("got %d surveys and %d responses, want the delete rolled back", surveys, responses)
+	}
+}
+
+func TestGenToken(t *testing.T) {
+	keepConfig(t)
+	config.TokenLength, config.TokenAlphabet = 12, "abc123"
+
+	token := genToken()
+	if len(token) != 12 {
+		t.Errorf("token %q has %d characters, want 12", token, len(token))
+	}
+	if i := strings.IndexFunc(token, func(r rune) bool { return !strings.ContainsRune(config.TokenAlphabet, r) }); i >= 0 {
+		t.Errorf("token %q has %q, not in the alphabet", token, token[i])
+	}
+	if other := genToken(); other == token {
+		t.Errorf("two calls both generated %q", token)
+	}
+}
+
+func TestPublicSurveyOmitsInternalFields(t *testing.T) {
+	now := time.Now()
+	survey := Survey{
+		Id: bson.NewObjectID(), OwnerId: bson.NewObjectID(), Token: "AbCdE", Title: "Public",
+		CreatedAt: now, UpdatedAt: now, Status: StatusPublished,
+		Questions: []Question{{Id: bson.NewObjectID(), QuestionTitle: "Name", QuestionType: "Textbox"}},
+	}
+	data, err := json.Marshal(survey.public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(data, &payload); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"created_at", "updated_at", "_id", "id", "owner_id"} {
+		if _, ok := payload[field]; ok {
+			t.Errorf("the public survey has %s: %s", field, data)
+		}
+	}
+	if payload["token"] != "AbCdE" || payload["title"] != "Public" {
+		t.Errorf("the public survey lacks its token or title: %s", data)
+	}
+}
+
+func TestGetResponsesByIdTimeRange(t *testing.T) {
+	ctx := testDB(t)
+	survey := insertSurvey(t, ctx, Survey{Title: "Range", Questions: []Question{{QuestionTitle: "Name", QuestionType: "Textbox"}}})
+	for _, day := range []int{1, 2, 3} {
+		response := answer(survey.Id, bson.NewObjectID(), survey.Questions[0].Id, fmt.Sprintf("May %d", day))
+		response.CreatedAt = time.Date(2024, time.May, day, 12, 0, 0, 0, time.UTC)
+		insertResponses(t, ctx, response)
+	}
+	get := func(query string) *httptest.ResponseRecorder {
+		return serve(getResponsesById, "GET", "/responses/"+survey.Id.Hex()+"?"+query, nil, map[string]string{"survey_id": survey.Id.Hex()})
+	}
+
+	for query, want := range map[string][]string{
+		"from=2024-05-02T00:00:00Z&to=2024-05-02T23:59:59Z": {"May 2"},
+		"from=2024-05-02&to=2024-05-02":                     {"May 2"},
+		"from=2024-05-02T00:00:00Z":                         {"May 2", "May 3"},
+		"to=2024-05-01":                                     {"May 1"},
+	} {
+		w := get(query)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", query, w.Code, w.Body)
+		}
+		got := []string{}
+		for _, response := range decodeBody[[]Response](t, w) {
+			got = append(got, response.ResponseText)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: got %v, want %v", query, got, want)
+		}
+	}
+
+	for _, query := range []string{"from=2024-05-03&to=2024-05-01", "from=yesterday"} {
+		if w := get(query); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestEditResponsesReplacesPriorAnswers(t *testing.T) {
+	ctx := testDB(t)
+	allowEdit := true
+	survey := insertSurvey(t, ctx, Survey{Title: "Editable", AllowEdit: &allowEdit, Questions: []Question{
+		{QuestionTitle: "Name", QuestionType: "Textbox"},
+		{QuestionTitle: "Role", QuestionType: "Multiple Choice", Answers: []string{"Dev", "Ops"}},
+	}})
+	name, role := survey.Questions[0].Id, survey.Questions[1].Id
+	vars := map[string]string{"survey_id": survey.Id.Hex()}
+	submission := map[string]any{"responses": []map[string]any{
+		{"question_id": name, "response_text": "Ann"},
+		{"question_id": role, "response_text": "Dev"},
+	}}
+	if w := serve(submitResponse, "POST", "/responses/"+survey.Id.Hex(), submission, vars); w.Code != http.StatusCreated {
+		t.Fatalf("submit: status %d: %s", w.Code, w.Body)
+	}
+	var submitted Response
+	if err := responsesCollection.FindOne(ctx, bson.M{"survey_id": survey.Id}).Decode(&submitted); err != nil {
+		t.Fatal(err)
+	}
+
+	vars["user_id"] = submitted.UserId.Hex()
+	edit := map[string]any{"responses": []map[string]any{{"question_id": name, "response_text": "Anne"}}}
+	if w := serve(editResponses, "PUT", "/responses/"+survey.Id.Hex()+"/user/"+submitted.UserId.Hex(), edit, vars); w.Code != http.StatusOK {
+		t.Fatalf("edit: status %d: %s", w.Code, w.Body)
+	}
+
+	cursor, err := responsesCollection.Find(ctx, bson.M{"survey_id": survey.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored []Response
+	if err := cursor.All(ctx, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || stored[0].QuestionId != name || stored[0].ResponseText != "Anne" || stored[0].UserId != submitted.UserId {
+		t.Errorf("stored %+v, want only the edited answer Anne of the respondent", stored)
+	}
+}
+
+func TestImportResponsesWithInvalidRows(t *testing.T) {
+	ctx := testDB(t)
+	survey := insertSurvey(t, ctx, Survey{Title: "Import", Questions: []Question{
+		{QuestionTitle: "Name", QuestionType: "Textbox"},
+		{QuestionTitle: "Role", QuestionType: "Multiple Choice", Answers: []string{"Dev", "Ops"}},
+	}})
+	name, role := survey.Questions[0].Id.Hex(), survey.Questions[1].Id.Hex()
+	ann := bson.NewObjectID().Hex()
+	records := []ImportRecord{
+		{QuestionId: name, ResponseText: "Ann", UserId: ann, CreatedAt: "2020-01-02T03:04:05Z"},
+		{QuestionId: role, ResponseText: "Dev", UserId: ann, CreatedAt: "2020-01-02T03:04:05Z"},
+		{QuestionId: role, ResponseText: "Design"},                      // not an option
+		{QuestionId: bson.NewObjectID().Hex(), ResponseText: "Hi"},      // not a question of the survey
+		{QuestionId: name, ResponseText: "Bob", CreatedAt: "yesterday"}, // malformed timestamp
+		{QuestionId: role, ResponseText: "Ops", UserId: ann},            // answered twice by the same respondent
+		{QuestionId: name, ResponseText: "Cid"},
+	}
+
+	w := serve(importResponses, "POST", "/responses/"+survey.Id.Hex()+"/import", records, map[string]string{"survey_id": survey.Id.Hex()})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	result := decodeBody[ImportResult](t, w)
+	if result.Imported != 3 || result.Rejected != 4 {
+		t.Errorf("imported %d and rejected %d rows, want 3 and 4", result.Imported, result.Rejected)
+	}
+	rows := []int{}
+	for _, e := range result.Errors {
+		rows = append(rows, e.Row)
+	}
+	if !slices.Equal(rows, []int{2, 3, 4, 5}) {
+		t.Errorf("rejected rows %v, want [2 3 4 5]", rows)
+	}
+
+	cursor, err := responsesCollection.Find(ctx, bson.M{"survey_id": survey.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored []Response
+	if err := cursor.All(ctx, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 3 {
+		t.Fatalf("stored %d responses, want 3", len(stored))
+	}
+	for _, response := range stored {
+		if response.UserId.Hex() == ann && !response.CreatedAt.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)) {
+			t.Errorf("created_at = %v, want the imported timestamp", response.CreatedAt)
+		}
+	}
+}
+
+func TestImportResponsesTakeQuotaSlots(t *testing.T) {
+	ctx := testDB(t)
+	limit := 3
+	survey := insertSurvey(t, ctx, Survey{Title: "Import", MaxResponses: &limit, Questions: []Question{{QuestionTitle: "Name", QuestionType: "Textbox"}}})
+	name := survey.Questions[0].Id.Hex()
+	ann := bson.NewObjectID().Hex()
+	importRows := func(records ...ImportRecord) *httptest.ResponseRecorder {
+		return serve(importResponses, "POST", "/responses/"+survey.Id.Hex()+"/import", records, map[string]string{"survey_id": survey.Id.Hex()})
+	}
+	responseCount := func() int {
+		t.Helper()
+		var stored Survey
+		if err := surveysCollection.FindOne(ctx, bson.M{"_id": survey.Id}).Decode(&stored); err != nil {
+			t.Fatal(err)
+		}
+		return stored.ResponseCount
+	}
+
+	if w := importRows(ImportRecord{QuestionId: name, ResponseText: "Ann", UserId: ann}, ImportRecord{QuestionId: name, ResponseText: "Bob"}); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if count := responseCount(); count != 2 {
+		t.Errorf("response count = %d after importing 2 respondents, want 2", count)
+	}
+	// ann already took a slot
+	if w := importRows(ImportRecord{QuestionId: name, ResponseText: "Ann again", UserId: ann}, ImportRecord{QuestionId: name, ResponseText: "Cid"}); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if count := responseCount(); count != 3 {
+		t.Errorf("response count = %d, want 3", count)
+	}
+	if w := importRows(ImportRecord{QuestionId: name, ResponseText: "Dan"}); w.Code != http.StatusForbidden {
+		t.Errorf("import over max_responses: status %d, want 403", w.Code)
+	}
+	if n, err := responsesCollection.CountDocuments(ctx, bson.M{"survey_id": survey.Id}); err != nil || n != 4 {
+		t.Errorf("stored %d responses (%v), want 4", n, err)
+	}
+}
+
+func TestUnroutedRequestsGetJSONErrors(t *testing.T) {
+	r := mux.NewRouter()
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	r.HandleFunc("/surveys", ok).Methods("GET")
+	r.HandleFunc("/surveys", ok).Methods("POST")
+	r.NotFoundHandler = http.HandlerFunc(notFoundHandler)
+	r.MethodNotAllowedHandler = methodNotAllowedHandler(r)
+
+	for _, tc := range []struct {
+		method, path string
+		status       int
+	}{
+		{"PATCH", "/surveys", http.StatusMethodNotAllowed},
+		{"GET", "/nowhere", http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+		if w.Code != tc.status {
+			t.Errorf("%s %s: status %d, want %d", tc.method, tc.path, w.Code, tc.status)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s %s: content type %q, want JSON", tc.method, tc.path, ct)
+		}
+		if body := decodeBody[map[string]string](t, w); body["error"] == "" {
+			t.Errorf("%s %s: no error message in %s", tc.method, tc.path, w.Body)
+		}
+		if tc.status == http.StatusMethodNotAllowed && w.Header().Get("Allow") != "GET, POST, OPTIONS" {
+			t.Errorf("Allow = %q, want GET, POST, OPTIONS", w.Header().Get("Allow"))
+		}
+	}
+}
+
+func TestPurgeResponsesOnlyAffectsOldOnes(t *testing.T) {
+	ctx := testDB(t)
+	survey := insertSurvey(t, ctx, Survey{Title: "Retention", Questions: []Question{{QuestionTitle: "Name", QuestionType: "Textbox"}}})
+	q := survey.Questions[0].Id
+	seed := func(text string, age time.Duration) {
+		response := answer(survey.Id, bson.NewObjectID(), q, text)
+		response.CreatedAt = time.Now().Add(-age)
+		response.RespondentEmail = text + "@example.com"
+		response.RespondentId = text
+		insertResponses(t, ctx, response)
+	}
+	seed("old", 40*24*time.Hour)
+	seed("older", 90*24*time.Hour)
+	seed("new", time.Hour)
+	purge := func(action string) int {
+		t.Helper()
+		w := serve(purgeResponses, "POST", "/responses/"+survey.Id.Hex()+"/purge?older_than=30d&action="+action, nil, map[string]string{"survey_id": survey.Id.Hex()})
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", action, w.Code, w.Body)
+		}
+		return int(decodeBody[map[string]any](t, w)["affected"].(float64))
+	}
+	stored := func() map[string]Response {
+		t.Helper()
+		cursor, err := responsesCollection.Find(ctx, bson.M{"survey_id": survey.Id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var responses []Response
+		if err := cursor.All(ctx, &responses); err != nil {
+			t.Fatal(err)
+		}
+		byText := map[string]Response{}
+		for _, response := range responses {
+			byText[response.ResponseText] = response
+		}
+		return byText
+	}
+
+	if n := purge("anonymize"); n != 2 {
+		t.Errorf("anonymized %d responses, want 2", n)
+	}
+	responses := stored()
+	for _, text := range []string{"old", "older"} {
+		if r, ok := responses[text]; !ok || r.RespondentEmail != "" || r.RespondentId != "" {
+			t.Errorf("%s response after anonymizing: %+v", text, r)
+		}
+	}
+	if r := responses["new"]; r.RespondentEmail != "new@example.com" || r.RespondentId != "new" {
+		t.Errorf("the new response was anonymized: %+v", r)
+	}
+
+	if n := purge("delete"); n != 2 {
+		t.Errorf("deleted %d responses, want 2", n)
+	}
+	responses = stored()
+	if _, ok := responses["new"]; len(responses) != 1 || !ok {
+		t.Errorf("kept %d responses, want only the new one", len(responses))
+	}
+}
+
+func TestRollbackRestoresTheWholeSurvey(t *testing.T) {
+	ctx := testDB(t)
+	welcome := "Welcome"
+	survey := insertSurvey(t, ctx, Survey{Title: "Original", Version: 1, WelcomeMessage: &welcome})
+	vars := map[string]string{"survey_id": survey.Id.Hex()}
+	edit := map[string]any{"title": "Edited", "welcome_message": "Hello", "thank_you_message": "Thanks", "version": 1}
+	if w := serve(updateSurvey, "PUT", "/surveys/"+survey.Id.Hex(), edit, vars); w.Code != http.StatusOK {
+		t.Fatalf("update: status %d: %s", w.Code, w.Body)
+	}
+	if _, err := surveysCollection.UpdateOne(ctx, bson.M{"_id": survey.Id}, bson.M{"$set": bson.M{"response_count": 5}}); err != nil {
+		t.Fatal(err)
+	}
+
+	versions := decodeBody[[]SurveyVersion](t, serve(getSurveyVersions, "GET", "/surveys/"+survey.Id.Hex()+"/versions", nil, vars))
+	if len(versions) != 1 || versions[0].WelcomeMessage == nil || *versions[0].WelcomeMessage != welcome {
+		t.Fatalf("versions = %+v, want version 1 with its welcome message", versions)
+	}
+
+	w := serve(rollbackSurvey, "POST", "/surveys/"+survey.Id.Hex()+"/versions/1/rollback", nil,
+		map[string]string{"survey_id": survey.Id.Hex(), "version": "1"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("rollback: status %d: %s", w.Code, w.Body)
+	}
+	got := decodeBody[Survey](t, w)
+	if got.Title != "Original" || got.WelcomeMessage == nil || *got.WelcomeMessage != welcome {
+		t.Errorf("rolled back to %q with welcome message %v, want Original with %q", got.Title, got.WelcomeMessage, welcome)
+	}
+	if got.ThankYouMessage != nil {
+		t.Errorf("thank you message %q added after version 1 was kept", *got.ThankYouMessage)
+	}
+	if got.Id != survey.Id || got.Token != survey.Token || got.ResponseCount != 5 || got.Version != 3 {
+		t.Errorf("rollback changed the bookkeeping: id %s token %q response count %d version %d", got.Id.Hex(), got.Token, got.ResponseCount, got.Version)
+	}
+}
+
+func TestRollbackWithStaleVersion(t *testing.T) {
+	ctx := testDB(t)
+	survey := insertSurvey(t, ctx, Survey{Title: "Original", Version: 1})
+	vars := map[string]string{"survey_id": survey.Id.Hex()}
+	if w := serve(updateSurvey, "PUT", "/surveys/"+survey.Id.Hex(), map[string]any{"title": "Edited", "version": 1}, vars); w.Code != http.StatusOK {
+		t.Fatalf("update: status %d: %s", w.Code, w.Body)
+	}
+	rollback := func(body any) *httptest.ResponseRecorder {
+		return serve(rollbackSurvey, "POST", "/surveys/"+survey.Id.Hex()+"/versions/1/rollback", body,
+			map[string]string{"survey_id": survey.Id.Hex(), "version": "1"})
+	}
+
+	// a client that read version 1 did not see the edit
+	if w := rollback(map[string]any{"version": 1}); w.Code != http.StatusConflict {
+		t.Fatalf("stale rollback: status %d, want 409", w.Code)
+	}
+	var stored Survey
+	if err := surveysCollection.FindOne(ctx, bson.M{"_id": survey.Id}).Decode(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Title != "Edited" || stored.Version != 2 {
+		t.Errorf("stale rollback stored %q version %d, want Edited version 2", stored.Title, stored.Version)
+	}
+
+	w := rollback(map[string]any{"version": 2})
+	if w.Code != http.StatusOK {
+		t.Fatalf("rollback: status %d: %s", w.Code, w.Body)
+	}
+	if got := decodeBody[Survey](t, w); got.Title != "Original" || got.Version != 3 {
+		t.Errorf("rolled back to %q version %d, want Original version 3", got.Title, got.Version)
+	}
+	if w := rollback(nil); w.Code != http.StatusOK {
+		t.Errorf("rollback without a version: status %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// details of the respondent of a submission, stored with every response of surveys collecting metadata
+type RespondentMetadata struct {
+	IPHash   string `json:"ip_hash,omitempty" bson:"ip_hash,omitempty"`   // keyed hash of the address, the address itself is not stored
+	Country  string `json:"country,omitempty" bson:"country,omitempty"`   // ISO 3166-1 alpha-2 code, unset when the address is unknown
+	Region   string `json:"region,omitempty" bson:"region,omitempty"`     // state or province, when the GeoIP database has them
+	Timezone string `json:"timezone,omitempty" bson:"timezone,omitempty"` // IANA time zone of the respondent, as given by the submission
+}
+
+// one address range of the GeoIP database
+type geoIPRange struct {
+	First, Last netip.Addr
+	Country     string
+	Region      string
+}
+
+// address ranges sorted by their first address, empty without GEOIP_DATABASE
+var geoIPRanges []geoIPRange
+
+func (s Survey) collectsMetadata() bool {
+	return s.CollectMetadata != nil && *s.CollectMetadata
+}
+
+// read a GeoIP database in CSV: the first and last address of a range, its country code and
+// optionally its region, one range per line. IPv4 and IPv6 ranges can be mixed
+func loadGeoIP(path string) ([]geoIPRange, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	var ranges []geoIPRange
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 3 {
+			return nil, fmt.Errorf("%s line %d: expected first address, last address and country", path, line)
+		}
+		first, err1 := netip.ParseAddr(record[0])
+		last, err2 := netip.ParseAddr(record[1])
+		if err1 != nil || err2 != nil {
+			// header line
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("%s line %d: invalid address range", path, line)
+		}
+		g := geoIPRange{First: first.Unmap(), Last: last.Unmap(), Country: record[2]}
+		if len(record) > 3 {
+			g.Region = record[3]
+		}
+		ranges = append(ranges, g)
+	}
+	slices.SortFunc(ranges, func(a, b geoIPRange) int { return a.First.Compare(b.First) })
+	return ranges, nil
+}
+
+// country and region of an address, empty when it is not in the GeoIP database
+func lookupGeo(ip string) (string, string) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "", ""
+	}
+	addr = addr.Unmap()
+	// the last range starting at or before the address
+	i, found := slices.BinarySearchFunc(geoIPRanges, addr, func(g geoIPRange, a netip.Addr) int { return g.First.Compare(a) })
+	if !found {
+		i--
+	}
+	if i < 0 || geoIPRanges[i].Last.Compare(addr) < 0 {
+		return "", ""
+	}
+	return geoIPRanges[i].Country, geoIPRanges[i].Region
+}
+
+// keyed hash of an address, so submissions from one address can be grouped without storing it
+func hashIP(ip string) string {
+	mac := hmac.New(sha256.New, ipHashKey())
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// key of the address hashes. without IP_HASH_KEY it is derived from JWTSecret, so the hashes never
+// use the signing key of the tokens itself
+func ipHashKey() []byte {
+	if len(config.IPHashKey) > 0 {
+		return config.IPHashKey
+	}
+	mac := hmac.New(sha256.New, config.JWTSecret)
+	mac.Write([]byte("ip-hash"))
+	return mac.Sum(nil)
+}
+
+// metadata of the respondent of a request to a survey collecting it, nil for other surveys.
+// writes a 400 when the submission gives an unknown time zone
+func respondentMetadata(w http.ResponseWriter, r *http.Request, survey Survey, submission SubmissionInput) (*RespondentMetadata, bool) {
+	if !survey.collectsMetadata() {
+		return nil, true
+	}
+	if submission.Timezone != "" {
+		if _, err := time.LoadLocation(submission.Timezone); err != nil {
+			http.Error(w, "Invalid timezone, expected an IANA time zone like Asia/Hong_Kong", http.StatusBadRequest)
+			return nil, false
+		}
+	}
+	ip := clientIP(r)
+	country, region := lookupGeo(ip)
+	return &RespondentMetadata{
+		IPHash:   hashIP(ip),
+		Country:  country,
+		Region:   region,
+		Timezone: submission.Timezone,
+	}, true
+}
+
+// submissions of a survey from one country, unknown countries are grouped under ""
+type CountryCount struct {
+	Country string        `json:"country"`
+	Count   int           `json:"count"`
+	Regions []RegionCount `json:"regions,omitempty"`
+}
+
+type RegionCount struct {
+	Region string `json:"region" bson:"region"`
+	Count  int    `json:"count" bson:"count"`
+}
+
+// get the number of submissions per country and region of a survey collecting metadata
+func getCountryBreakdown(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get country breakdown")
+	id, _ := bson.ObjectIDFromHex(mux.Vars(r)["survey_id"])
+	filter, err := exportFilter(r, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// submissions without metadata were made before the survey collected it
+	filter["metadata"] = bson.M{"$exists": true}
+
+	ctx, cancel := context.WithTimeout(context.Background(), streamTimeout)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{
+			"_id":     "$user_id",
+			"country": bson.M{"$first": bson.M{"$ifNull": bson.A{"$metadata.country", ""}}},
+			"region":  bson.M{"$first": bson.M{"$ifNull": bson.A{"$metadata.region", ""}}},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"country": "$country", "region": "$region"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":     "$_id.country",
+			"count":   bson.M{"$sum": "$count"},
+			"regions": bson.M{"$push": bson.M{"region": "$_id.region", "count": "$count"}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+	}
+	cursor, err := responsesCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		panic(err)
+	}
+	defer cursor.Close(ctx)
+	var groups []struct {
+		Country string        `bson:"_id"`
+		Count   int           `bson:"count"`
+		Regions []RegionCount `bson:"regions"`
+	}
+	if err = cursor.All(ctx, &groups); err != nil {
+		panic(err)
+	}
+
+	countries := make([]CountryCount, 0, len(groups))
+	for _, g := range groups {
+		// ranges without regions are not broken down
+		regions := slices.DeleteFunc(g.Regions, func(rc RegionCount) bool { return rc.Region == "" })
+		slices.SortFunc(regions, func(a, b RegionCount) int { return b.Count - a.Count })
+		countries = append(countries, CountryCount{g.Country, g.Count, regions})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(countries)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.mongodb.org/mongo-driver/v2/event"
+)
+
+// metrics exposed at /metrics in the Prometheus text format, next to the Go runtime and process metrics
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Number of handled HTTP requests.",
+	}, []string{"route", "method", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of handled HTTP requests.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "status"})
+
+	mongoActiveOperations = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "mongo_active_operations",
+		Help: "Mongo commands currently in flight.",
+	})
+
+	eventBusFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "event_bus_failures_total",
+		Help: "Events not published on the event bus, because the queue was full or publishing failed.",
+	}, []string{"reason"})
+
+	eventQueueLength = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "event_bus_queue_length",
+		Help: "Events waiting to be published on the event bus.",
+	}, func() float64 { return float64(len(eventQueue)) })
+)
+
+func observeRequest(route, method string, status int, d time.Duration) {
+	code := strconv.Itoa(status)
+	httpRequests.WithLabelValues(route, method, code).Inc()
+	httpRequestDuration.WithLabelValues(route, code).Observe(d.Seconds())
+}
+
+// count in-flight Mongo commands through the driver's command monitor
+func mongoMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(context.Context, *event.CommandStartedEvent) {
+			mongoActiveOperations.Inc()
+		},
+		Succeeded: func(context.Context, *event.CommandSucceededEvent) {
+			mongoActiveOperations.Dec()
+		},
+		Failed: func(context.Context, *event.CommandFailedEvent) {
+			mongoActiveOperations.Dec()
+		},
+	}
+}
+
+// remembers the status code written by a handler, keeps streaming working by forwarding Flush
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// lets http.ResponseController reach the connection
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// hands the connection over to WebSockets, whose upgrader needs an http.Hijacker
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	s.status = http.StatusSwitchingProtocols
+	return http.NewResponseController(s.ResponseWriter).Hijack()
+}
+
+// log every request and record it in the metrics, labeled by route template instead of the raw path
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if tpl, err := current.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+		defer func() {
+			err := recover()
+			if err != nil {
+				// a panicking handler ends up as a 500 for the client
+				rec.status = http.StatusInternalServerError
+			}
+			d := time.Since(start)
+			observeRequest(route, r.Method, rec.status, d)
+			log.Printf("%s %s %d %s", r.Method, r.URL.Path, rec.status, d)
+			if err != nil {
+				panic(err)
+			}
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
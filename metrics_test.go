@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func TestMetricsCountRequests(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(loggingMiddleware)
+	r.HandleFunc("/metrics-test/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["id"] == "missing" {
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}).Methods("GET")
+	r.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	get := func(path string) string {
+		t.Helper()
+		res, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(body)
+	}
+	for _, path := range []string{"/metrics-test/1", "/metrics-test/2", "/metrics-test/missing"} {
+		get(path)
+	}
+
+	scraped := get("/metrics")
+	for _, series := range []string{
+		`http_requests_total{method="GET",route="/metrics-test/{id}",status="200"} 2`,
+		`http_requests_total{method="GET",route="/metrics-test/{id}",status="404"} 1`,
+		`http_request_duration_seconds_count{route="/metrics-test/{id}",status="200"} 2`,
+		`mongo_active_operations 0`,
+	} {
+		if !strings.Contains(scraped, series+"\n") {
+			t.Errorf("/metrics lacks %s", series)
+		}
+	}
+
+	get("/metrics-test/3")
+	if scraped := get("/metrics"); !strings.Contains(scraped, `http_requests_total{method="GET",route="/metrics-test/{id}",status="200"} 3`+"\n") {
+		t.Error("the request counter did not increment")
+	}
+}
+
+func TestLoggingMiddlewareKeepsWebSockets(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(loggingMiddleware)
+	r.HandleFunc("/ws-test", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := liveResultsUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteMessage(websocket.TextMessage, []byte("hello"))
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws-test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(message) != "hello" {
+		t.Errorf("message = %q, want hello", message)
+	}
+}
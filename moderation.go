@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// review states of screened text answers, answers that passed the screening have none
+const (
+	ModerationPending  = "pending"
+	ModerationApproved = "approved"
+	ModerationRejected = "rejected"
+)
+
+// why a text answer was held for review, stored in moderation_reasons
+const (
+	ModerationProfanity  = "profanity"
+	ModerationEmail      = "email"
+	ModerationPhone      = "phone"
+	ModerationCardNumber = "card_number"
+)
+
+// words held for review wherever they appear as a word of their own
+var profanity = wordSet(`arse arsehole ass asshole bastard bitch bollocks bullshit cock crap cunt damn dick
+	dickhead fag faggot fuck fucked fucker fucking goddamn motherfucker nigger piss prick pussy retard shit
+	shitty slut twat wanker whore`)
+
+var (
+	emailPattern      = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	phonePattern      = regexp.MustCompile(`\+?\(?\d[\d\s().\-]{7,}\d`)
+	cardNumberPattern = regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`)
+)
+
+func (s Survey) moderatesText() bool {
+	return s.ModerateText != nil && *s.ModerateText
+}
+
+// reasons text has to be reviewed before it is shown in results, nil when it looks fine
+func screenText(text string) []string {
+	var reasons []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !('a' <= r && r <= 'z')
+	}) {
+		if profanity[word] {
+			reasons = append(reasons, ModerationProfanity)
+			break
+		}
+	}
+	if emailPattern.MatchString(text) {
+		reasons = append(reasons, ModerationEmail)
+	}
+	if slices.ContainsFunc(cardNumberPattern.FindAllString(text, -1), luhnValid) {
+		reasons = append(reasons, ModerationCardNumber)
+	}
+	// card numbers look like phone numbers as well
+	for _, match := range phonePattern.FindAllString(text, -1) {
+		if len(strings.Map(digitsOnly, match)) >= 9 && !luhnValid(match) {
+			reasons = append(reasons, ModerationPhone)
+			break
+		}
+	}
+	return reasons
+}
+
+func digitsOnly(r rune) rune {
+	if '0' <= r && r <= '9' {
+		return r
+	}
+	return -1
+}
+
+// the digits of s pass the Luhn checksum of payment card numbers
+func luhnValid(s string) bool {
+	digits := strings.Map(digitsOnly, s)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	for i := range len(digits) {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// hold the text answers of a response to a survey moderating text for review when the screening flags them
+func screenResponse(survey Survey, q Question, response *Response) {
+	if !survey.moderatesText() {
+		return
+	}
+	text := response.OtherText
+	if q.QuestionType == "Textbox" {
+		text = response.ResponseText + "\n" + text
+	}
+	if reasons := screenText(text); len(reasons) > 0 {
+		response.Moderation = ModerationPending
+		response.ModerationReasons = reasons
+	}
+}
+
+// list the screened text answers of a survey waiting for review, or already reviewed with status
+func getModerationQueue(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get moderation queue")
+	id, _ := bson.ObjectIDFromHex(mux.Vars(r)["survey_id"])
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = ModerationPending
+	case ModerationPending, ModerationApproved, ModerationRejected:
+	default:
+		http.Error(w, "Invalid status, expected pending, approved or rejected", http.StatusBadRequest)
+		return
+	}
+	filter := bson.M{"survey_id": id, "moderation": status}
+
+	ctx, cancel := context.WithTimeout(context.Background(), streamTimeout)
+	defer cancel()
+
+	if isPaged(r) {
+		pageResponses(ctx, w, r, filter)
+		return
+	}
+	cursor, err := responsesCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		panic(err)
+	}
+	defer cursor.Close(ctx)
+
+	streamResponses(ctx, w, cursor)
+}
+
+// approve a held text answer, adding it to the results
+func approveResponse(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("approve response")
+	reviewResponse(w, r, ModerationApproved)
+}
+
+// reject a held text answer, keeping it out of the results for good
+func rejectResponse(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("reject response")
+	reviewResponse(w, r, ModerationRejected)
+}
+
+func reviewResponse(w http.ResponseWriter, r *http.Request, decision string) {
+	queries := mux.Vars(r)
+	id, _ := bson.ObjectIDFromHex(queries["survey_id"])
+	responseId, err := bson.ObjectIDFromHex(queries["response_id"])
+	if err != nil {
+		http.Error(w, "Invalid Response Id", http.StatusBadRequest)
+		return
+	}
+	set := bson.M{"moderation": decision, "reviewed_at": time.Now()}
+	if userId, ok := currentUserId(r); ok {
+		set["reviewed_by"] = userId
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var response Response
+	err = responsesCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": responseId, "survey_id": id, "moderation": bson.M{"$exists": true}},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&response)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, "No screened response found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
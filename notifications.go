@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// when the owner of a survey is emailed about its responses
+type Notifications struct {
+	Mode  string `json:"mode" bson:"mode"`                       // every, nth or daily
+	Every int    `json:"every,omitempty" bson:"every,omitempty"` // nth only: email on every this many submissions
+}
+
+const (
+	NotifyEvery = "every" // an email per submission
+	NotifyNth   = "nth"   // an email every Every submissions
+	NotifyDaily = "daily" // a summary of the submissions of the last day
+)
+
+// largest every of nth notifications
+const maxNotifyEvery = 100000
+
+// how often the scheduler looks for surveys due for their daily summary
+const summaryCheckInterval = time.Hour
+
+// emails waiting to be sent, emails are dropped while it is full
+const mailQueueSize = 1000
+
+type email struct {
+	to      string
+	subject string
+	body    string
+}
+
+var mailQueue = make(chan email, mailQueueSize)
+
+// an SMTP server to send notifications with is configured
+func smtpEnabled() bool {
+	return config.SMTPHost != "" && config.SMTPFrom != ""
+}
+
+func validateNotifications(n *Notifications) []ValidationError {
+	if n == nil {
+		return nil
+	}
+	var errs []ValidationError
+	switch n.Mode {
+	case NotifyEvery, NotifyDaily:
+	case NotifyNth:
+		if n.Every < 2 || n.Every > maxNotifyEvery {
+			errs = append(errs, ValidationError{"notifications.every", fmt.Sprintf("every should be from 2 to %d", maxNotifyEvery)})
+		}
+	default:
+		errs = append(errs, ValidationError{"notifications.mode", "mode should be every, nth or daily"})
+	}
+	if !smtpEnabled() {
+		errs = append(errs, ValidationError{"notifications", "no SMTP server is configured, set SMTP_HOST and SMTP_FROM first"})
+	}
+	return errs
+}
+
+// send queued emails one after another, and the daily summaries once due, until the process exits
+func startMailer() {
+	if !smtpEnabled() {
+		return
+	}
+	go func() {
+		for m := range mailQueue {
+			if err := sendMail(m); err != nil {
+				log.Printf("emailing %q to %s failed: %v", m.subject, m.to, err)
+			}
+		}
+	}()
+	go func() {
+		sendDailySummaries()
+		ticker := time.NewTicker(summaryCheckInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			sendDailySummaries()
+		}
+	}()
+}
+
+// send an email through the configured SMTP server, which is switched to TLS when it offers STARTTLS
+func sendMail(m email) error {
+	var auth smtp.Auth
+	if config.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", config.SMTPUsername, config.SMTPPassword, config.SMTPHost)
+	}
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", config.SMTPFrom)
+	fmt.Fprintf(&msg, "To: %s\r\n", m.to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(m.body, "\n", "\r\n"))
+	from, err := mail.ParseAddress(config.SMTPFrom)
+	if err != nil {
+		return err
+	}
+	addr := net.JoinHostPort(config.SMTPHost, strconv.Itoa(config.SMTPPort))
+	return smtp.SendMail(addr, auth, from.Address, []string{m.to}, []byte(msg.String()))
+}
+
+// address notifications of a survey go to: the verified email of its owner. "" for surveys without an
+// owner to email
+func ownerEmail(ctx context.Context, survey Survey) (string, error) {
+	if survey.OwnerId.IsZero() {
+		return "", nil
+	}
+	var owner User
+	err := usersCollection.FindOne(ctx, bson.M{"_id": survey.OwnerId}).Decode(&owner)
+	if err == mongo.ErrNoDocuments {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !owner.EmailVerified {
+		return "", nil
+	}
+	return owner.Email, nil
+}
+
+// queue an email to the owner of a survey, without waiting for it to be sent
+func notifyOwner(ctx context.Context, survey Survey, subject, body string) {
+	to, err := ownerEmail(ctx, survey)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if to == "" {
+		log.Printf("survey %s: notifications are on but its owner has no verified email", survey.Id.Hex())
+		return
+	}
+	queueEmail(email{to, subject, body})
+}
+
+// queue an email for the mailer, without waiting for it to be sent
+func queueEmail(m email) {
+	select {
+	case mailQueue <- m:
+	default:
+		log.Printf("mail queue is full, %q to %s dropped", m.subject, m.to)
+	}
+}
+
+// email the owner of a survey about a submission, count is the number of submissions including it
+func notifySubmission(ctx context.Context, survey Survey, count int) {
+	n := survey.Notifications
+	if n == nil || !smtpEnabled() {
+		return
+	}
+	switch {
+	case n.Mode == NotifyEvery:
+		notifyOwner(ctx, survey, fmt.Sprintf("New response to %s", survey.Title),
+			fmt.Sprintf("Your survey \"%s\" received a new response.\n\nIt has %d responses so far.\n", survey.Title, count))
+	case n.Mode == NotifyNth && n.Every > 0 && count%n.Every == 0:
+		notifyOwner(ctx, survey, fmt.Sprintf("%s reached %d responses", survey.Title, count),
+			fmt.Sprintf("Your survey \"%s\" reached %d responses.\n", survey.Title, count))
+	}
+}
+
+// email the owners of surveys with daily notifications the submissions of the last day. every survey is
+// claimed before its summary is sent, so server instances running the scheduler together send it once
+func sendDailySummaries() {
+	ctx, cancel := context.WithTimeout(context.Background(), streamTimeout)
+	defer cancel()
+
+	for {
+		now := time.Now()
+		var survey Survey
+		err := surveysCollection.FindOneAndUpdate(ctx,
+			bson.M{
+				"notifications.mode": NotifyDaily,
+				"deleted_at":         nil,
+				"$or": bson.A{
+					bson.M{"summary_sent_at": nil},
+					bson.M{"summary_sent_at": bson.M{"$lte": now.Add(-24 * time.Hour)}},
+				},
+			},
+			bson.M{"$set": bson.M{"summary_sent_at": now}},
+		).Decode(&survey)
+		if err == mongo.ErrNoDocuments {
+			return
+		}
+		if err != nil {
+			log.Println("sending daily summaries failed:", err)
+			return
+		}
+		since := now.Add(-24 * time.Hour)
+		if survey.SummarySentAt != nil && survey.SummarySentAt.After(since) {
+			since = *survey.SummarySentAt
+		}
+		// submissions are told apart by their user_id
+		userIds, err := responsesCollection.Distinct(ctx, "user_id", bson.M{"survey_id": survey.Id, "created_at": bson.M{"$gt": since, "$lte": now}}).Raw()
+		if err != nil {
+			log.Println("sending daily summaries failed:", err)
+			return
+		}
+		values, err := userIds.Values()
+		if err != nil {
+			log.Println("sending daily summaries failed:", err)
+			return
+		}
+		// no email on quiet days
+		if len(values) == 0 {
+			continue
+		}
+		notifyOwner(ctx, survey, fmt.Sprintf("Daily summary of %s", survey.Title),
+			fmt.Sprintf("Your survey \"%s\" received %d responses since %s.\n\nIt has %d responses so far.\n",
+				survey.Title, len(values), since.UTC().Format("2006-01-02 15:04 UTC"), survey.ResponseCount))
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestReserveResponseSlotCounts(t *testing.T) {
+	ctx := testDB(t)
+	limit := 5
+	survey := insertSurvey(t, ctx, Survey{Title: "Quota", MaxResponses: &limit})
+
+	// every submission gets the count it brought the survey to, concurrent ones included
+	var mu sync.Mutex
+	var counts []int
+	var wg sync.WaitGroup
+	for range limit + 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			count, reserved, err := reserveResponseSlot(ctx, survey.Id, 1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if reserved {
+				mu.Lock()
+				counts = append(counts, count)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	slices.Sort(counts)
+	if want := []int{1, 2, 3, 4, 5}; !slices.Equal(counts, want) {
+		t.Errorf("counts = %v, want %v", counts, want)
+	}
+}
+
+func TestNotificationsOnlyGoToVerifiedEmails(t *testing.T) {
+	ctx := testDB(t)
+	keepConfig(t)
+	config.JWTSecret = []byte("test secret")
+	unverified := User{Id: bson.NewObjectID(), Username: "ann@example.com", Email: "ann@example.org", CreatedAt: time.Now()}
+	if _, err := usersCollection.InsertOne(ctx, unverified); err != nil {
+		t.Fatal(err)
+	}
+	survey := Survey{Id: bson.NewObjectID(), OwnerId: unverified.Id}
+	if to, err := ownerEmail(ctx, survey); err != nil || to != "" {
+		t.Errorf("owner email = %q, %v, want none while it is unverified", to, err)
+	}
+
+	verify := func(subject string) int {
+		now := time.Now()
+		token, err := signJWT(Claims{subject, "verify-email", now.Unix(), now.Add(time.Hour).Unix()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return serve(verifyEmail, "POST", "/auth/verify-email", map[string]string{"token": token}, nil).Code
+	}
+	if code := serve(verifyEmail, "POST", "/auth/verify-email", map[string]string{"token": "nonsense"}, nil).Code; code != http.StatusBadRequest {
+		t.Errorf("invalid token: status %d, want 400", code)
+	}
+	if code := verify(unverified.Id.Hex() + " ann@example.com"); code != http.StatusNotFound {
+		t.Errorf("token of another email: status %d, want 404", code)
+	}
+	if to, _ := ownerEmail(ctx, survey); to != "" {
+		t.Errorf("owner email = %q after verifying another address, want none", to)
+	}
+	if code := verify(unverified.Id.Hex() + " ann@example.org"); code != http.StatusOK {
+		t.Errorf("token of the email: status %d, want 200", code)
+	}
+	if to, err := ownerEmail(ctx, survey); err != nil || to != "ann@example.org" {
+		t.Errorf("owner email = %q, %v, want ann@example.org", to, err)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const googleAuthURL = "https://accounts.google.com/o/oauth2/v2/auth"
+const googleTokenURL = "https://oauth2.googleapis.com/token"
+const googleUserInfoURL = "https://openidconnect.googleapis.com/v1/userinfo"
+
+const oauthStateTTL = 10 * time.Minute
+
+// profile returned by Google's userinfo endpoint
+type GoogleUserInfo struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+var oauthClient = &http.Client{Timeout: 10 * time.Second}
+
+// redirect to Google's consent screen, the state is bound to the browser through a cookie
+func googleLogin(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("google login")
+	if config.GoogleClientId == "" {
+		http.Error(w, "Google login is not configured", http.StatusNotFound)
+		return
+	}
+	consentURL, err := googleConsentURL(w, r, "oauth_state", "")
+	if err != nil {
+		panic(err)
+	}
+	http.Redirect(w, r, consentURL, http.StatusFound)
+}
+
+// start linking a Google account to the authenticated author. the frontend sends the browser to the
+// returned url, as browsers can not send the access token along with a redirect. signing in with the
+// account afterwards logs in as the author
+func googleLink(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("google link")
+	if config.GoogleClientId == "" {
+		http.Error(w, "Google login is not configured", http.StatusNotFound)
+		return
+	}
+	userId, ok := currentUserId(r)
+	if !ok {
+		http.Error(w, "the admin can not be linked to a Google account", http.StatusBadRequest)
+		return
+	}
+	consentURL, err := googleConsentURL(w, r, "oauth_link", userId.Hex())
+	if err != nil {
+		panic(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"url": consentURL})
+}
+
+// URL of Google's consent screen. its state is a token of tokenType holding a nonce, followed by the
+// author to link for "oauth_link", the nonce is also set in a cookie binding the state to the browser
+func googleConsentURL(w http.ResponseWriter, r *http.Request, tokenType, linkTo string) (string, error) {
+	b := make([]byte, 16)
+	rand.Read(b)
+	nonce := hex.EncodeToString(b)
+	subject := nonce
+	if linkTo != "" {
+		subject += " " + linkTo
+	}
+	state, err := signJWT(Claims{subject, tokenType, time.Now().Unix(), time.Now().Add(oauthStateTTL).Unix()})
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     "oauth_state",
+		Value:    nonce,
+		Path:     "/auth/google",
+		MaxAge:   int(oauthStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	params := url.Values{
+		"client_id":     {config.GoogleClientId},
+		"redirect_uri":  {config.GoogleRedirectURL},
+		"response_type": {"code"},
+		"scope":         {"openid email"},
+		"state":         {state},
+	}
+	return googleAuthURL + "?" + params.Encode(), nil
+}
+
+// finish the Google login or link: exchange the code, find, create or link the account and issue tokens
+func googleCallback(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("google callback")
+	if config.GoogleClientId == "" {
+		http.Error(w, "Google login is not configured", http.StatusNotFound)
+		return
+	}
+	query := r.URL.Query()
+	if e := query.Get("error"); e != "" {
+		http.Error(w, "Google login failed: "+e, http.StatusUnauthorized)
+		return
+	}
+	// the state of a link names the author to link after the nonce
+	claims, err := parseJWT(query.Get("state"), "oauth_state")
+	linkTo := ""
+	if err != nil {
+		if claims, err = parseJWT(query.Get("state"), "oauth_link"); err == nil {
+			claims.Subject, linkTo, _ = strings.Cut(claims.Subject, " ")
+		}
+	}
+	cookie, cookieErr := r.Cookie("oauth_state")
+	if err != nil || cookieErr != nil || cookie.Value != claims.Subject {
+		http.Error(w, "Invalid OAuth state", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	info, err := fetchGoogleUser(ctx, query.Get("code"))
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Google login failed", http.StatusUnauthorized)
+		return
+	}
+	if !info.EmailVerified {
+		http.Error(w, "Google account email is not verified", http.StatusUnauthorized)
+		return
+	}
+
+	var user User
+	if linkTo != "" {
+		userId, _ := bson.ObjectIDFromHex(linkTo)
+		user, err = linkGoogleAccount(ctx, userId, info)
+		switch {
+		case errors.Is(err, errGoogleAccountTaken), errors.Is(err, errOtherGoogleAccount):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err == mongo.ErrNoDocuments:
+			http.Error(w, "No author found", http.StatusNotFound)
+			return
+		}
+	} else {
+		user, err = linkGoogleUser(ctx, info)
+	}
+	if err != nil {
+		panic(err)
+	}
+	tokens, err := issueTokens(user.Id.Hex())
+	if err != nil {
+		panic(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// exchange the authorization code for an access token and read the user's profile
+func fetchGoogleUser(ctx context.Context, code string) (GoogleUserInfo, error) {
+	var info GoogleUserInfo
+	form := url.Values{
+		"code":          {code},
+		"client_id":     {config.GoogleClientId},
+		"client_secret": {config.GoogleClientSecret},
+		"redirect_uri":  {config.GoogleRedirectURL},
+		"grant_type":    {"authorization_code"},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", googleTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return info, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := oauthClient.Do(req)
+	if err != nil {
+		return info, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return info, fmt.Errorf("google token exchange returned %s", res.Status)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return info, err
+	}
+
+	req, err = http.NewRequestWithContext(ctx, "GET", googleUserInfoURL, nil)
+	if err != nil {
+		return info, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	res, err = oauthClient.Do(req)
+	if err != nil {
+		return info, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return info, fmt.Errorf("google userinfo returned %s", res.Status)
+	}
+	err = json.NewDecoder(res.Body).Decode(&info)
+	return info, err
+}
+
+// find the user of a Google account, or create one. Google accounts are never linked to an existing author
+// by their username, anyone can register a username that is someone else's email
+func linkGoogleUser(ctx context.Context, info GoogleUserInfo) (User, error) {
+	var user User
+	err := usersCollection.FindOne(ctx, bson.M{"google_id": info.Subject}).Decode(&user)
+	if err != mongo.ErrNoDocuments {
+		return user, err
+	}
+
+	// the email is the username of the new author, unless another author registered it
+	email := strings.ToLower(info.Email)
+	for _, username := range []string{email, "google-" + info.Subject} {
+		user = User{
+			Id:            bson.NewObjectID(),
+			Username:      username,
+			Email:         email,
+			GoogleId:      info.Subject,
+			EmailVerified: true, // googleCallback only accepts verified Google emails
+			CreatedAt:     time.Now(),
+		}
+		_, err = usersCollection.InsertOne(ctx, user)
+		if !mongo.IsDuplicateKeyError(err) {
+			return user, err
+		}
+		// signed in twice at once, the other login created the author
+		var existing User
+		if usersCollection.FindOne(ctx, bson.M{"google_id": info.Subject}).Decode(&existing) == nil {
+			return existing, nil
+		}
+	}
+	return user, err
+}
+
+var (
+	errGoogleAccountTaken = errors.New("the Google account is already linked to another author")
+	errOtherGoogleAccount = errors.New("the author is already linked to another Google account")
+)
+
+// link a Google account to an existing author, who can then sign in with it. the author's email is
+// verified when it is the verified email of the account
+func linkGoogleAccount(ctx context.Context, userId bson.ObjectID, info GoogleUserInfo) (User, error) {
+	var user User
+	err := usersCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": userId, "google_id": bson.M{"$in": bson.A{nil, info.Subject}}},
+		bson.M{"$set": bson.M{"google_id": info.Subject}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if mongo.IsDuplicateKeyError(err) {
+		return user, errGoogleAccountTaken
+	}
+	if err == mongo.ErrNoDocuments {
+		n, err := usersCollection.CountDocuments(ctx, bson.M{"_id": userId})
+		if err != nil {
+			return user, err
+		}
+		if n == 0 {
+			return user, mongo.ErrNoDocuments
+		}
+		return user, errOtherGoogleAccount
+	}
+	if err != nil {
+		return user, err
+	}
+	if !user.EmailVerified && user.Email != "" && strings.EqualFold(user.Email, info.Email) {
+		if _, err := usersCollection.UpdateOne(ctx, bson.M{"_id": userId, "email": user.Email}, bson.M{"$set": bson.M{"email_verified": true}}); err != nil {
+			return user, err
+		}
+		user.EmailVerified = true
+	}
+	return user, nil
+}
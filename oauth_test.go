@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+func TestGoogleSignInNeverTakesOverAnAuthor(t *testing.T) {
+	ctx := testDB(t)
+	// someone registered the victim's email as their username before the victim signed in with Google
+	local := User{Id: bson.NewObjectID(), Username: "ann@example.com", PasswordHash: "x", CreatedAt: time.Now()}
+	if _, err := usersCollection.InsertOne(ctx, local); err != nil {
+		t.Fatal(err)
+	}
+	info := GoogleUserInfo{Subject: "1234", Email: "Ann@example.com", EmailVerified: true}
+
+	user, err := linkGoogleUser(ctx, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Id == local.Id {
+		t.Fatal("the Google account was linked to the author registered with its email")
+	}
+	if user.Username != "google-1234" || user.Email != "ann@example.com" {
+		t.Errorf("new author %q with email %q, want google-1234 and ann@example.com", user.Username, user.Email)
+	}
+	again, err := linkGoogleUser(ctx, info)
+	if err != nil || again.Id != user.Id {
+		t.Errorf("signing in again gave author %s (%v), want %s", again.Id.Hex(), err, user.Id.Hex())
+	}
+
+	other, err := linkGoogleUser(ctx, GoogleUserInfo{Subject: "5678", Email: "bob@example.com", EmailVerified: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Username != "bob@example.com" {
+		t.Errorf("username = %q, want the free email", other.Username)
+	}
+}
+
+func TestLinkGoogleAccount(t *testing.T) {
+	ctx := testDB(t)
+	ann := User{Id: bson.NewObjectID(), Username: "ann", Email: "ann@example.com", PasswordHash: "x", CreatedAt: time.Now()}
+	bob := User{Id: bson.NewObjectID(), Username: "bob", PasswordHash: "x", CreatedAt: time.Now()}
+	if _, err := usersCollection.InsertMany(ctx, []any{ann, bob}); err != nil {
+		t.Fatal(err)
+	}
+	info := GoogleUserInfo{Subject: "1234", Email: "Ann@example.com", EmailVerified: true}
+
+	linked, err := linkGoogleAccount(ctx, ann.Id, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linked.GoogleId != "1234" || !linked.EmailVerified {
+		t.Errorf("linked author has google id %q and verified email %v, want 1234 and true", linked.GoogleId, linked.EmailVerified)
+	}
+	// signing in with the account now logs in as the author, their surveys included
+	user, err := linkGoogleUser(ctx, info)
+	if err != nil || user.Id != ann.Id {
+		t.Errorf("signing in gave author %s (%v), want %s", user.Id.Hex(), err, ann.Id.Hex())
+	}
+	if _, err := linkGoogleAccount(ctx, ann.Id, info); err != nil {
+		t.Errorf("linking the same account again: %v", err)
+	}
+
+	if _, err := linkGoogleAccount(ctx, bob.Id, info); !errors.Is(err, errGoogleAccountTaken) {
+		t.Errorf("linking the account to another author: %v, want %v", err, errGoogleAccountTaken)
+	}
+	if _, err := linkGoogleAccount(ctx, ann.Id, GoogleUserInfo{Subject: "5678", Email: "ann@example.org", EmailVerified: true}); !errors.Is(err, errOtherGoogleAccount) {
+		t.Errorf("linking a second account: %v, want %v", err, errOtherGoogleAccount)
+	}
+	if _, err := linkGoogleAccount(ctx, bson.NewObjectID(), GoogleUserInfo{Subject: "9999"}); err != mongo.ErrNoDocuments {
+		t.Errorf("linking to an unknown author: %v, want no documents", err)
+	}
+}
+
+func TestGoogleLinkRequiresAnAuthor(t *testing.T) {
+	keepConfig(t)
+	config.JWTSecret = []byte("test secret")
+	config.GoogleClientId = "client"
+	if w := serve(requireAuth(googleLink), "POST", "/auth/google/link", nil, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("without a token: status %d, want 401", w.Code)
+	}
+
+	userId := bson.NewObjectID()
+	now := time.Now()
+	token, err := signJWT(Claims{userId.Hex(), "access", now.Unix(), now.Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", "/auth/google/link", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	requireAuth(googleLink)(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	consent, err := url.Parse(decodeBody[map[string]string](t, w)["url"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := parseJWT(consent.Query().Get("state"), "oauth_link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, linkTo, _ := strings.Cut(claims.Subject, " ")
+	if linkTo != userId.Hex() {
+		t.Errorf("state links %q, want the author %s", linkTo, userId.Hex())
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].Value != nonce {
+		t.Errorf("cookies %v, want the nonce of the state", cookies)
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// answers saved by a respondent who has not finished a survey yet, resumed with its token
+type PartialResponse struct {
+	Id              bson.ObjectID   `json:"id" bson:"_id"` // becomes the user_id of the responses once submitted
+	SurveyId        bson.ObjectID   `json:"survey_id" bson:"survey_id"`
+	ResumeToken     string          `json:"resume_token" bson:"resume_token"`
+	RespondentEmail string          `json:"respondent_email,omitempty" bson:"respondent_email,omitempty"` // identified surveys only
+	Session         string          `json:"session,omitempty" bson:"session,omitempty"`                   // randomized surveys: the session the questions were ordered for
+	Acquisition     *Acquisition    `json:"acquisition,omitempty" bson:"acquisition,omitempty"`
+	Responses       []ResponseInput `json:"responses" bson:"responses"`
+	CreatedAt       time.Time       `json:"created_at" bson:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at" bson:"updated_at"` // saved answers are removed config.PartialResponseDays after it
+}
+
+var partialResponsesCollection *mongo.Collection
+
+// check the answers saved so far, unanswered questions are not required yet. returns the acquisition
+// of the submission to save with them
+func checkPartialAnswers(w http.ResponseWriter, survey Survey, submission SubmissionInput) (*Acquisition, bool) {
+	if len(strings.TrimSpace(submission.Session)) > maxSessionLength {
+		http.Error(w, fmt.Sprintf("session should be at most %d characters", maxSessionLength), http.StatusBadRequest)
+		return nil, false
+	}
+	acquisition, err := submission.Acquisition.normalized()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	if errs := validateResponsesFor(survey.Questions, submission.Responses, map[bson.ObjectID]bool{}); len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return nil, false
+	}
+	return acquisition, true
+}
+
+// find the saved answers of a survey by their resume token, writing a 404 when they do not exist
+func findPartialResponse(w http.ResponseWriter, surveyId bson.ObjectID, token string) (PartialResponse, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var partial PartialResponse
+	err := partialResponsesCollection.FindOne(ctx, bson.M{"survey_id": surveyId, "resume_token": token}).Decode(&partial)
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "No saved responses found, they may have expired", http.StatusNotFound)
+		return partial, false
+	}
+	if err != nil {
+		panic(err)
+	}
+	return partial, true
+}
+
+// save incomplete answers to a survey, the returned resume token lets the respondent continue later
+func savePartialResponse(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("save partial response")
+	id, err := bson.ObjectIDFromHex(mux.Vars(r)["survey_id"])
+	if err != nil {
+		http.Error(w, "Invalid Survey Id", http.StatusBadRequest)
+		return
+	}
+	survey, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+	if !isAcceptingResponses(w, survey) {
+		return
+	}
+	var submission SubmissionInput
+	if err := json.NewDecoder(r.Body).Decode(&submission); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	acquisition, ok := checkPartialAnswers(w, survey, submission)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	partial := PartialResponse{
+		Id:              bson.NewObjectID(),
+		SurveyId:        id,
+		ResumeToken:     rand.Text(),
+		RespondentEmail: strings.TrimSpace(submission.RespondentEmail),
+		Session:         strings.TrimSpace(submission.Session),
+		Acquisition:     acquisition,
+		Responses:       submission.Responses,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if partial.Responses == nil {
+		partial.Responses = []ResponseInput{}
+	}
+	if _, err := partialResponsesCollection.InsertOne(ctx, partial); err != nil {
+		panic(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(partial)
+}
+
+// get the answers saved under a resume token, to continue the survey where the respondent left it
+func getPartialResponse(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get partial response")
+	queries := mux.Vars(r)
+	id, _ := bson.ObjectIDFromHex(queries["survey_id"])
+	partial, ok := findPartialResponse(w, id, queries["resume_token"])
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(partial)
+}
+
+// replace the answers saved under a resume token
+func updatePartialResponse(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("update partial response")
+	queries := mux.Vars(r)
+	id, err := bson.ObjectIDFromHex(queries["survey_id"])
+	if err != nil {
+		http.Error(w, "Invalid Survey Id", http.StatusBadRequest)
+		return
+	}
+	survey, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+	if !isAcceptingResponses(w, survey) {
+		return
+	}
+	var submission SubmissionInput
+	if err := json.NewDecoder(r.Body).Decode(&submission); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	acquisition, ok := checkPartialAnswers(w, survey, submission)
+	if !ok {
+		return
+	}
+	if submission.Responses == nil {
+		submission.Responses = []ResponseInput{}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var partial PartialResponse
+	err = partialResponsesCollection.FindOneAndUpdate(ctx,
+		bson.M{"survey_id": id, "resume_token": queries["resume_token"]},
+		bson.M{"$set": bson.M{
+			"respondent_email": strings.TrimSpace(submission.RespondentEmail),
+			"session":          strings.TrimSpace(submission.Session),
+			"acquisition":      acquisition,
+			"responses":        submission.Responses,
+			"updated_at":       time.Now(),
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&partial)
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "No saved responses found, they may have expired", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(partial)
+}
+
+// submit the answers saved under a resume token as a complete submission. answers sent in the body
+// replace the saved ones, an empty body submits them as they are
+func finalizePartialResponse(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("finalize partial response")
+	queries := mux.Vars(r)
+	id, err := bson.ObjectIDFromHex(queries["survey_id"])
+	if err != nil {
+		http.Error(w, "Invalid Survey Id", http.StatusBadRequest)
+		return
+	}
+	token := queries["resume_token"]
+	survey, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+	if len(survey.Questions) == 0 {
+		http.Error(w, "the survey has no questions, responses cannot be submitted", http.StatusBadRequest)
+		return
+	}
+	if !isAcceptingResponses(w, survey) {
+		return
+	}
+	partial, ok := findPartialResponse(w, id, token)
+	if !ok {
+		return
+	}
+	submission := SubmissionInput{RespondentEmail: partial.RespondentEmail, Session: partial.Session, Responses: partial.Responses}
+	if partial.Acquisition != nil {
+		submission.Acquisition = *partial.Acquisition
+	}
+	if err := json.NewDecoder(r.Body).Decode(&submission); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if submission.RespondentId, ok = respondentSession(w, r); !ok {
+		return
+	}
+	if submission.Metadata, ok = respondentMetadata(w, r, survey, submission); !ok {
+		return
+	}
+	submission.Device, submission.Browser = parseUserAgent(r.UserAgent())
+	// saved answers were started when they were first saved
+	if submission.BotFlags, ok = checkBotFlags(w, survey, submission, partial.CreatedAt); !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the saved answers are checked like any submission, required questions included
+	responses, ok := buildResponses(ctx, w, survey, submission, partial.Id)
+	if !ok {
+		return
+	}
+	if !checkCaptcha(ctx, w, r, survey, submission) {
+		return
+	}
+	key, ok := claimRespondentKey(ctx, w, r, survey, submission, partial.Id)
+	if !ok {
+		return
+	}
+
+	count, reserved, err := reserveResponseSlot(ctx, id, 1)
+	if err != nil {
+		panic(err)
+	}
+	if !reserved {
+		releaseRespondentKey(ctx, id, key)
+		http.Error(w, "the survey is full, responses cannot be submitted", http.StatusForbidden)
+		return
+	}
+	// counted last, so submissions rejected as duplicates or over the quota do not use up the rate limit
+	if !throttleSubmission(ctx, w, survey) {
+		if _, _, err := reserveResponseSlot(ctx, id, -1); err != nil {
+			log.Println(err)
+		}
+		releaseRespondentKey(ctx, id, key)
+		return
+	}
+
+	// the saved answers are removed with the submission, so they can only be submitted once
+	errSubmitted := errors.New("the responses have already been submitted")
+	err = withTransaction(ctx, func(ctx context.Context) error {
+		res, err := partialResponsesCollection.DeleteOne(ctx, bson.M{"_id": partial.Id})
+		if err != nil {
+			return err
+		}
+		if res.DeletedCount == 0 {
+			return errSubmitted
+		}
+		if len(responses) == 0 {
+			return nil
+		}
+		_, err = responsesCollection.InsertMany(ctx, responses)
+		return err
+	})
+	if err != nil {
+		// give the slot back
+		if _, _, err := reserveResponseSlot(ctx, id, -1); err != nil {
+			log.Println(err)
+		}
+		releaseRespondentKey(ctx, id, key)
+		if errors.Is(err, errSubmitted) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		log.Println(err)
+		http.Error(w, "Failed to submit response", http.StatusInternalServerError)
+		return
+	}
+	notifyWebhooks(ctx, id, EventResponseSubmitted, SubmissionEvent{partial.Id, responses})
+	publishEvent(id, EventResponseSubmitted, SubmissionEvent{partial.Id, responses})
+	notifySubmission(ctx, survey, count)
+	setEditToken(w, survey, partial.Id)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(submission.Responses)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// placeholder in a question title replaced by the answer to an earlier question, {{q:2}} is the
+// answer to the second question of the survey
+var pipePattern = regexp.MustCompile(`\{\{\s*q:(\d+)\s*\}\}`)
+
+// longest answer inserted into a title, longer answers are cut
+const maxPipedLength = 100
+
+// question number of a placeholder, 0 when it is out of range
+func placeholderIndex(digits string) int {
+	n, err := strconv.Atoi(digits)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// placeholders of the title of the question at index i must refer to earlier questions with a single answer
+func validatePiping(field string, i int, questions []Question) []ValidationError {
+	var errs []ValidationError
+	for _, m := range pipePattern.FindAllStringSubmatch(questions[i].QuestionTitle, -1) {
+		n := placeholderIndex(m[1])
+		if n < 1 || n > i {
+			errs = append(errs, ValidationError{field + ".question_title", fmt.Sprintf("%s should refer to one of the questions before this one, numbered from 1", m[0])})
+			continue
+		}
+		if ref := questions[n-1]; ref.QuestionType == "Matrix" || ref.QuestionType == "File Upload" {
+			errs = append(errs, ValidationError{field + ".question_title", fmt.Sprintf("%s refers to a %s question, their answers can not be inserted", m[0], ref.QuestionType)})
+		}
+	}
+	return errs
+}
+
+// placeholders numbering the question at index or a later one, they would point at another question
+// once a question is added or removed at index
+func shiftedPlaceholders(questions []Question, index int) []ValidationError {
+	var errs []ValidationError
+	for i, q := range questions {
+		for _, m := range pipePattern.FindAllStringSubmatch(q.QuestionTitle, -1) {
+			if n := placeholderIndex(m[1]); n > index {
+				errs = append(errs, ValidationError{fmt.Sprintf("questions[%d].question_title", i), fmt.Sprintf("%s numbers a question that would move, update the placeholder first", m[0])})
+			}
+		}
+	}
+	return errs
+}
+
+// the title of a question with its placeholders numbering the questions in the order of reordered
+func renumberPlaceholders(title string, questions, reordered []Question) string {
+	return pipePattern.ReplaceAllStringFunc(title, func(placeholder string) string {
+		n := placeholderIndex(pipePattern.FindStringSubmatch(placeholder)[1])
+		if n < 1 || n > len(questions) {
+			return placeholder
+		}
+		id := questions[n-1].Id
+		return fmt.Sprintf("{{q:%d}}", slices.IndexFunc(reordered, func(q Question) bool { return q.Id == id })+1)
+	})
+}
+
+// texts inserted for the answers in inputs, by question id. invalid answers are left out
+func pipedAnswers(questions []Question, inputs []ResponseInput) map[bson.ObjectID]string {
+	byId := make(map[bson.ObjectID]Question, len(questions))
+	for _, q := range questions {
+		byId[q.Id] = q
+	}
+	answers := make(map[bson.ObjectID]string)
+	for _, input := range inputs {
+		q, ok := byId[input.QuestionId]
+		if !ok || q.QuestionType == "Matrix" || q.QuestionType == "File Upload" {
+			continue
+		}
+		_, text, err := responseValue(q, input)
+		if err != nil {
+			continue
+		}
+		if other := strings.TrimSpace(input.OtherText); other != "" {
+			text = other
+		}
+		answers[q.Id] = pipedText(text)
+	}
+	return answers
+}
+
+// an answer as inserted into a title: on a single line and cut to maxPipedLength characters
+func pipedText(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > maxPipedLength {
+		text = string(runes[:maxPipedLength-1]) + "…"
+	}
+	return text
+}
+
+// replace the placeholders of a title, unanswered questions leave their placeholder empty. the
+// title is scanned once, placeholders within inserted answers are kept as they are
+func pipeTitle(title string, questions []Question, answers map[bson.ObjectID]string) string {
+	return pipePattern.ReplaceAllStringFunc(title, func(placeholder string) string {
+		n := placeholderIndex(pipePattern.FindStringSubmatch(placeholder)[1])
+		if n < 1 || n > len(questions) {
+			return ""
+		}
+		return answers[questions[n-1].Id]
+	})
+}
+
+// respondent view of a survey for a partial submission, with the answers given so far inserted into the
+// question titles and questions hidden by their display rules left out
+func renderSurvey(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("render survey")
+	queries := mux.Vars(r)
+	token := queries["token"]
+
+	var submission SubmissionInput
+	if err := json.NewDecoder(r.Body).Decode(&submission); err != nil {
+		http.Error(w, "the body should hold the responses given so far", http.StatusBadRequest)
+		return
+	}
+
+	survey, ok := findSurveyByToken(w, token)
+	if !ok {
+		return
+	}
+
+	answers := pipedAnswers(survey.Questions, submission.Responses)
+	visible := visibleQuestions(survey.Questions, submission.Responses)
+	// placeholders number the questions in the order of the survey, not the order they are shown in
+	rendered := survey.publicFor(submission.Session).localize(survey, r.URL.Query().Get("lang"))
+	questions := rendered.Questions[:0]
+	for _, pq := range rendered.Questions {
+		if !visible[pq.Id] {
+			continue
+		}
+		pq.QuestionTitle = pipeTitle(pq.QuestionTitle, survey.Questions, answers)
+		questions = append(questions, pq)
+	}
+	rendered.Questions = questions
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rendered)
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// current version of the portable survey definition, bump it when the format changes incompatibly
+const surveyDefinitionVersion = 1
+
+// survey without ids, token and timestamps, so it can be moved between environments
+type SurveyDefinition struct {
+	SchemaVersion            int                  `json:"schema_version"`
+	Title                    string               `json:"title"`
+	Anonymous                *bool                `json:"anonymous,omitempty"`
+	AllowEdit                *bool                `json:"allow_edit,omitempty"`
+	EditWindowMinutes        *int                 `json:"edit_window_minutes,omitempty"`
+	OneResponsePerRespondent *bool                `json:"one_response_per_respondent,omitempty"`
+	CollectMetadata          *bool                `json:"collect_metadata,omitempty"`
+	RequireCaptcha           *bool                `json:"require_captcha,omitempty"`
+	BotDetection             *BotDetection        `json:"bot_detection,omitempty"`
+	MaxSubmissionsPerMinute  *int                 `json:"max_submissions_per_minute,omitempty"`
+	ModerateText             *bool                `json:"moderate_text,omitempty"`
+	MaxResponses             *int                 `json:"max_responses,omitempty"`
+	RandomizeQuestions       *bool                `json:"randomize_questions,omitempty"`
+	WelcomeMessage           *string              `json:"welcome_message,omitempty"`
+	ThankYouMessage          *string              `json:"thank_you_message,omitempty"`
+	CompletionRedirectURL    *string              `json:"completion_redirect_url,omitempty"`
+	Theme                    *Theme               `json:"theme,omitempty"`
+	Language                 string               `json:"language,omitempty"`
+	Sections                 []SectionDefinition  `json:"sections,omitempty"`
+	Questions                []QuestionDefinition `json:"questions"`
+}
+
+type SectionDefinition struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+}
+
+type QuestionDefinition struct {
+	QuestionTitle  string                `json:"question_title"`
+	QuestionType   string                `json:"question_type"`
+	Answers        []string              `json:"answers,omitempty"`
+	Scores         []float64             `json:"scores,omitempty"`
+	Required       bool                  `json:"required,omitempty"`
+	MinSelections  int                   `json:"min_selections,omitempty"`
+	MaxSelections  int                   `json:"max_selections,omitempty"`
+	ScaleMin       int                   `json:"scale_min,omitempty"`
+	ScaleMax       int                   `json:"scale_max,omitempty"`
+	Rows           []string              `json:"rows,omitempty"` // Matrix only, row titles in order
+	MinDate        string                `json:"min_date,omitempty"`
+	MaxDate        string                `json:"max_date,omitempty"`
+	MinValue       *float64              `json:"min_value,omitempty"`
+	MaxValue       *float64              `json:"max_value,omitempty"`
+	Step           float64               `json:"step,omitempty"`
+	MaxFileSize    int64                 `json:"max_file_size,omitempty"`
+	AllowedTypes   []string              `json:"allowed_types,omitempty"`
+	OtherOption    string                `json:"other_option,omitempty"`
+	ShowIf         []ConditionDefinition `json:"show_if,omitempty"`
+	ShuffleAnswers bool                  `json:"shuffle_answers,omitempty"`
+	PinnedAnswers  []string              `json:"pinned_answers,omitempty"`
+	Section        *int                  `json:"section,omitempty"` // index in sections, from 0, unset for the first page
+}
+
+// display condition referring to the question it depends on by its position, definitions carry no ids
+type ConditionDefinition struct {
+	Question int    `json:"question"` // index in questions, from 0
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+func (s Survey) definition() SurveyDefinition {
+	d := SurveyDefinition{
+		SchemaVersion:            surveyDefinitionVersion,
+		Title:                    s.Title,
+		Anonymous:                s.Anonymous,
+		AllowEdit:                s.AllowEdit,
+		EditWindowMinutes:        s.EditWindowMinutes,
+		OneResponsePerRespondent: s.OneResponsePerRespondent,
+		CollectMetadata:          s.CollectMetadata,
+		RequireCaptcha:           s.RequireCaptcha,
+		BotDetection:             s.BotDetection,
+		MaxSubmissionsPerMinute:  s.MaxSubmissionsPerMinute,
+		ModerateText:             s.ModerateText,
+		MaxResponses:             s.MaxResponses,
+		RandomizeQuestions:       s.RandomizeQuestions,
+		WelcomeMessage:           s.WelcomeMessage,
+		ThankYouMessage:          s.ThankYouMessage,
+		CompletionRedirectURL:    s.CompletionRedirectURL,
+		Theme:                    s.Theme,
+		Language:                 s.Language,
+		Questions:                make([]QuestionDefinition, 0, len(s.Questions)),
+	}
+	sections := make(map[bson.ObjectID]int, len(s.Sections))
+	for i, section := range s.Sections {
+		sections[section.Id] = i
+		d.Sections = append(d.Sections, SectionDefinition{section.Title, section.Description})
+	}
+	positions := make(map[bson.ObjectID]int, len(s.Questions))
+	for i, q := range s.Questions {
+		positions[q.Id] = i
+	}
+	for _, q := range s.Questions {
+		var showIf []ConditionDefinition
+		for _, c := range q.ShowIf {
+			showIf = append(showIf, ConditionDefinition{positions[c.QuestionId], c.Operator, c.Value})
+		}
+		var rows []string
+		for _, row := range q.Rows {
+			rows = append(rows, row.Title)
+		}
+		var section *int
+		if i, ok := sections[q.SectionId]; ok {
+			section = &i
+		}
+		d.Questions = append(d.Questions, QuestionDefinition{
+			QuestionTitle:  q.QuestionTitle,
+			QuestionType:   q.QuestionType,
+			Answers:        q.Answers,
+			Scores:         q.Scores,
+			Required:       q.Required,
+			MinSelections:  q.MinSelections,
+			MaxSelections:  q.MaxSelections,
+			ScaleMin:       q.ScaleMin,
+			ScaleMax:       q.ScaleMax,
+			Rows:           rows,
+			MinDate:        q.MinDate,
+			MaxDate:        q.MaxDate,
+			MinValue:       q.MinValue,
+			MaxValue:       q.MaxValue,
+			Step:           q.Step,
+			MaxFileSize:    q.MaxFileSize,
+			AllowedTypes:   q.AllowedTypes,
+			OtherOption:    q.OtherOption,
+			ShowIf:         showIf,
+			ShuffleAnswers: q.ShuffleAnswers,
+			PinnedAnswers:  q.PinnedAnswers,
+			Section:        section,
+		})
+	}
+	return d
+}
+
+func (d SurveyDefinition) survey() Survey {
+	s := Survey{
+		Title:                    d.Title,
+		Anonymous:                d.Anonymous,
+		AllowEdit:                d.AllowEdit,
+		EditWindowMinutes:        d.EditWindowMinutes,
+		OneResponsePerRespondent: d.OneResponsePerRespondent,
+		CollectMetadata:          d.CollectMetadata,
+		RequireCaptcha:           d.RequireCaptcha,
+		BotDetection:             d.BotDetection,
+		MaxSubmissionsPerMinute:  d.MaxSubmissionsPerMinute,
+		ModerateText:             d.ModerateText,
+		MaxResponses:             d.MaxResponses,
+		RandomizeQuestions:       d.RandomizeQuestions,
+		WelcomeMessage:           d.WelcomeMessage,
+		ThankYouMessage:          d.ThankYouMessage,
+		CompletionRedirectURL:    d.CompletionRedirectURL,
+		Theme:                    d.Theme,
+		Language:                 d.Language,
+		Questions:                make([]Question, 0, len(d.Questions)),
+	}
+	// temporary ids link display rules and sections to their questions until the survey is stored with fresh ids
+	ids := make([]bson.ObjectID, len(d.Questions))
+	for i := range ids {
+		ids[i] = bson.NewObjectID()
+	}
+	for _, section := range d.Sections {
+		s.Sections = append(s.Sections, Section{Id: bson.NewObjectID(), Title: section.Title, Description: section.Description})
+	}
+	for i, q := range d.Questions {
+		var showIf []DisplayCondition
+		for _, c := range q.ShowIf {
+			var ref bson.ObjectID // unknown positions are reported by the validation
+			if c.Question >= 0 && c.Question < len(ids) {
+				ref = ids[c.Question]
+			}
+			showIf = append(showIf, DisplayCondition{ref, c.Operator, c.Value})
+		}
+		var rows []MatrixRow
+		for _, title := range q.Rows {
+			rows = append(rows, MatrixRow{Title: title})
+		}
+		var sectionId bson.ObjectID
+		if q.Section != nil {
+			sectionId = bson.NewObjectID() // reported by the validation unless it is one of the sections
+			if *q.Section >= 0 && *q.Section < len(s.Sections) {
+				sectionId = s.Sections[*q.Section].Id
+			}
+		}
+		s.Questions = append(s.Questions, Question{
+			Id:             ids[i],
+			QuestionTitle:  q.QuestionTitle,
+			QuestionType:   q.QuestionType,
+			Answers:        q.Answers,
+			Scores:         q.Scores,
+			Required:       q.Required,
+			MinSelections:  q.MinSelections,
+			MaxSelections:  q.MaxSelections,
+			ScaleMin:       q.ScaleMin,
+			ScaleMax:       q.ScaleMax,
+			Rows:           rows,
+			MinDate:        q.MinDate,
+			MaxDate:        q.MaxDate,
+			MinValue:       q.MinValue,
+			MaxValue:       q.MaxValue,
+			Step:           q.Step,
+			MaxFileSize:    q.MaxFileSize,
+			AllowedTypes:   q.AllowedTypes,
+			OtherOption:    q.OtherOption,
+			ShowIf:         showIf,
+			ShuffleAnswers: q.ShuffleAnswers,
+			PinnedAnswers:  q.PinnedAnswers,
+			SectionId:      sectionId,
+		})
+	}
+	return s
+}
+
+// export survey by id as a portable definition
+func exportSurvey(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("export survey")
+	id, _ := bson.ObjectIDFromHex(mux.Vars(r)["survey_id"])
+	survey, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"survey-%s.json\"", survey.Token))
+	json.NewEncoder(w).Encode(survey.definition())
+}
+
+// create a new draft from a portable definition
+func importSurvey(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("import survey")
+	var definition SurveyDefinition
+	if err := json.NewDecoder(r.Body).Decode(&definition); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if definition.SchemaVersion != surveyDefinitionVersion {
+		http.Error(w, fmt.Sprintf("Unsupported schema_version %d, expected %d", definition.SchemaVersion, surveyDefinitionVersion), http.StatusBadRequest)
+		return
+	}
+
+	survey := definition.survey()
+	if msg := checkSurveyLimits(survey); msg != "" {
+		http.Error(w, "Failed to import survey, "+msg, http.StatusBadRequest)
+		return
+	}
+	if errs := validateSurvey(survey, false); len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := insertNewSurvey(ctx, r, &survey); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(survey)
+}
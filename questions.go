@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+type QuestionOrderInput struct {
+	QuestionIds []bson.ObjectID `json:"question_ids"` // every question of the survey, in the new order
+}
+
+// check the questions a survey would have after changing one of them, writing the problems found
+func checkChangedQuestions(w http.ResponseWriter, survey Survey, questions []Question) bool {
+	changed := Survey{Questions: questions, Sections: survey.Sections}
+	if msg := checkSurveyLimits(changed); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return false
+	}
+	if errs := validateSurveyFor(changed, true, survey.Questions); len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return false
+	}
+	return true
+}
+
+// add a question to a survey, at the end or at the position given from 1
+func addQuestion(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("add question")
+	id, _ := bson.ObjectIDFromHex(mux.Vars(r)["survey_id"])
+	var q Question
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	survey, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+	position := len(survey.Questions)
+	if p := r.URL.Query().Get("position"); p != "" {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 {
+			http.Error(w, "position should be a question number from 1", http.StatusBadRequest)
+			return
+		}
+		position = min(n-1, len(survey.Questions))
+	}
+
+	q.Id = bson.NewObjectID()
+	for i := range q.Rows {
+		q.Rows[i].Id = bson.NewObjectID()
+	}
+	if position < len(survey.Questions) {
+		if errs := shiftedPlaceholders(survey.Questions, position); len(errs) > 0 {
+			writeValidationErrors(w, errs)
+			return
+		}
+	}
+	if !checkChangedQuestions(w, survey, slices.Insert(slices.Clone(survey.Questions), position, q)) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// only the question is written, concurrent edits of other questions are kept. the survey must
+	// still have room for it when it is added
+	filter := bson.M{"_id": id, "deleted_at": nil, fmt.Sprintf("questions.%d", config.MaxQuestions-1): bson.M{"$exists": false}}
+	update := bson.M{
+		"$push": bson.M{"questions": bson.M{"$each": bson.A{q}, "$position": position}},
+		"$set":  bson.M{"updated_at": time.Now()},
+		"$inc":  bson.M{"version": 1},
+	}
+	if _, err := updateSurveyWithHistory(ctx, filter, update); errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, fmt.Sprintf("a survey can have at most %d questions", config.MaxQuestions), http.StatusConflict)
+		return
+	} else if err != nil {
+		panic(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(q)
+}
+
+// replace a single question of a survey, keeping its id
+func updateQuestion(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("update question")
+	queries := mux.Vars(r)
+	id, _ := bson.ObjectIDFromHex(queries["survey_id"])
+	questionId, err := bson.ObjectIDFromHex(queries["question_id"])
+	if err != nil {
+		http.Error(w, "Invalid Question Id", http.StatusBadRequest)
+		return
+	}
+	var q Question
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	survey, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+	i := slices.IndexFunc(survey.Questions, func(q Question) bool { return q.Id == questionId })
+	if i < 0 {
+		http.Error(w, "No question found", http.StatusNotFound)
+		return
+	}
+
+	// rows keep their ids so earlier responses stay linked to them
+	q.Id = questionId
+	for j, row := range q.Rows {
+		if row.Id.IsZero() {
+			q.Rows[j].Id = bson.NewObjectID()
+		}
+	}
+	questions := slices.Clone(survey.Questions)
+	questions[i] = q
+	if !checkChangedQuestions(w, survey, questions) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": id, "deleted_at": nil, "questions._id": questionId}
+	update := bson.M{
+		"$set": bson.M{"questions.$": q, "updated_at": time.Now()},
+		"$inc": bson.M{"version": 1},
+	}
+	if _, err := updateSurveyWithHistory(ctx, filter, update); errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, "No question found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		panic(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(q)
+}
+
+// remove a single question of a survey, its responses are kept
+func deleteQuestion(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("delete question")
+	queries := mux.Vars(r)
+	id, _ := bson.ObjectIDFromHex(queries["survey_id"])
+	questionId, err := bson.ObjectIDFromHex(queries["question_id"])
+	if err != nil {
+		http.Error(w, "Invalid Question Id", http.StatusBadRequest)
+		return
+	}
+	survey, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+	i := slices.IndexFunc(survey.Questions, func(q Question) bool { return q.Id == questionId })
+	if i < 0 {
+		http.Error(w, "No question found", http.StatusNotFound)
+		return
+	}
+
+	// questions depending on it have to be changed first
+	errs := shiftedPlaceholders(survey.Questions, i)
+	for j, q := range survey.Questions {
+		if slices.ContainsFunc(q.ShowIf, func(c DisplayCondition) bool { return c.QuestionId == questionId }) {
+			errs = append(errs, ValidationError{fmt.Sprintf("questions[%d].show_if", j), fmt.Sprintf("question %q is shown depending on the question, update its display rules first", q.QuestionTitle)})
+		}
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": id, "deleted_at": nil, "questions._id": questionId}
+	update := bson.M{
+		"$pull": bson.M{"questions": bson.M{"_id": questionId}},
+		"$set":  bson.M{"updated_at": time.Now()},
+		"$inc":  bson.M{"version": 1},
+	}
+	if _, err := updateSurveyWithHistory(ctx, filter, update); errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, "No question found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		panic(err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// reorder the questions of a survey, placeholders are renumbered so they keep pointing at the same questions
+func reorderQuestions(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("reorder questions")
+	id, _ := bson.ObjectIDFromHex(mux.Vars(r)["survey_id"])
+	var input QuestionOrderInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	survey, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+
+	byId := make(map[bson.ObjectID]Question, len(survey.Questions))
+	for _, q := range survey.Questions {
+		byId[q.Id] = q
+	}
+	reordered := make([]Question, 0, len(input.QuestionIds))
+	for _, questionId := range input.QuestionIds {
+		q, ok := byId[questionId]
+		if !ok {
+			http.Error(w, fmt.Sprintf("question %s is not part of the survey or is listed twice", questionId.Hex()), http.StatusBadRequest)
+			return
+		}
+		delete(byId, questionId)
+		reordered = append(reordered, q)
+	}
+	if len(byId) > 0 {
+		http.Error(w, "question_ids should list every question of the survey", http.StatusBadRequest)
+		return
+	}
+	for i, q := range reordered {
+		reordered[i].QuestionTitle = renumberPlaceholders(q.QuestionTitle, survey.Questions, reordered)
+	}
+	if !checkChangedQuestions(w, survey, reordered) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the order is only written when no question was changed since it was read
+	filter := bson.M{"_id": id, "deleted_at": nil, "version": survey.Version}
+	if survey.Version == 0 {
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+	update := bson.M{
+		"$set": bson.M{"questions": reordered, "updated_at": time.Now()},
+		"$inc": bson.M{"version": 1},
+	}
+	updated, err := updateSurveyWithHistory(ctx, filter, update)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, "Survey has been modified by someone else, please reload it and try again", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// how a question type uses the answers of a question
+const (
+	AnswersRequired = "required" // the options respondents choose from
+	AnswersNone     = "none"     // generated or not used, must be left out
+	AnswersIgnored  = "ignored"  // not used, accepted for compatibility
+)
+
+// definition of a question type: its answer constraints and the settings it accepts
+type QuestionTypeDef struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Answers     string   `json:"answers"`               // required, none or ignored
+	MinAnswers  int      `json:"min_answers,omitempty"` // required answers only
+	OddAnswers  bool     `json:"odd_answers,omitempty"` // the number of answers must be odd
+	Settings    []string `json:"settings"`              // question fields specific to the type
+	Value       string   `json:"value"`                 // JSON type of the typed answer of a response
+}
+
+// every supported question type, in the order frontends list them
+var questionTypes = []QuestionTypeDef{
+	{Name: "Textbox", Description: "Free text answer", Answers: AnswersIgnored, Settings: []string{}, Value: "string"},
+	{Name: "Multiple Choice", Description: "One of the answers", Answers: AnswersRequired, MinAnswers: 2, Settings: []string{"other_option", "shuffle_answers", "pinned_answers"}, Value: "string"},
+	{Name: "Likert Scale", Description: "One of an odd number of ordered answers, optionally scored", Answers: AnswersRequired, MinAnswers: 3, OddAnswers: true, Settings: []string{"scores"}, Value: "number"},
+	{Name: "Checkbox", Description: "Several of the answers", Answers: AnswersRequired, MinAnswers: 2, Settings: []string{"min_selections", "max_selections", "shuffle_answers", "pinned_answers"}, Value: "array"},
+	{Name: "Ranking", Description: "Every answer, in order of preference", Answers: AnswersRequired, MinAnswers: 2, Settings: []string{"shuffle_answers", "pinned_answers"}, Value: "array"},
+	{Name: "Rating", Description: "A whole number on a scale", Answers: AnswersNone, Settings: []string{"scale_min", "scale_max"}, Value: "number"},
+	{Name: "NPS", Description: "Net promoter score, a rating from 0 to 10", Answers: AnswersNone, Settings: []string{}, Value: "number"},
+	{Name: "Number", Description: "A number, optionally limited to a range and steps", Answers: AnswersNone, Settings: []string{"min_value", "max_value", "step"}, Value: "number"},
+	{Name: "Date", Description: "A date or timestamp, optionally limited to a range", Answers: AnswersIgnored, Settings: []string{"min_date", "max_date"}, Value: "timestamp"},
+	{Name: "Time", Description: "A time of day", Answers: AnswersNone, Settings: []string{}, Value: "string"},
+	{Name: "Matrix", Description: "One of the answers for each of the rows", Answers: AnswersRequired, MinAnswers: 2, Settings: []string{"rows"}, Value: "string"},
+	{Name: "File Upload", Description: "An uploaded file", Answers: AnswersNone, Settings: []string{"max_file_size", "allowed_types"}, Value: "string"},
+}
+
+// definition of the question type called name, nil for unknown types
+func questionTypeDef(name string) *QuestionTypeDef {
+	i := slices.IndexFunc(questionTypes, func(t QuestionTypeDef) bool { return t.Name == name })
+	if i < 0 {
+		return nil
+	}
+	return &questionTypes[i]
+}
+
+// check the type of a question and its answers against the type's definition. stored is the question as it
+// is saved, nil for new questions, an even Likert scale saved before the odd number rule is kept as it is
+func validateQuestionType(field string, q Question, stored *Question) []ValidationError {
+	if q.QuestionType == "" {
+		return nil // reported as missing
+	}
+	def := questionTypeDef(q.QuestionType)
+	if def == nil {
+		return []ValidationError{{field + ".question_type", fmt.Sprintf("Unknown question type %q, see GET /question-types for the supported types", q.QuestionType)}}
+	}
+	var errs []ValidationError
+	switch def.Answers {
+	case AnswersRequired:
+		if len(q.Answers) < def.MinAnswers {
+			errs = append(errs, ValidationError{field + ".answers", fmt.Sprintf("%s Question should have at least %d answers", def.Name, def.MinAnswers)})
+		} else if def.OddAnswers && len(q.Answers)%2 == 0 && !keepsAnswers(q, stored) {
+			errs = append(errs, ValidationError{field + ".answers", fmt.Sprintf("%s Question should have an odd number of answers", def.Name)})
+		}
+	case AnswersNone:
+		if len(q.Answers) > 0 {
+			errs = append(errs, ValidationError{field + ".answers", fmt.Sprintf("%s Questions have no answers, answers should be left out", def.Name)})
+		}
+	}
+	return errs
+}
+
+// the question has the type and answers it is saved with
+func keepsAnswers(q Question, stored *Question) bool {
+	return stored != nil && stored.QuestionType == q.QuestionType && slices.Equal(stored.Answers, q.Answers)
+}
+
+// list the supported question types, so frontends can render them without hardcoding
+func getQuestionTypes(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get question types")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(questionTypes)
+}
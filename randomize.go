@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/rand"
+	"hash/fnv"
+	mathrand "math/rand/v2"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// longest session accepted from respondents, sessions are generated by the server otherwise
+const maxSessionLength = 64
+
+func (s Survey) isRandomized() bool {
+	return s.RandomizeQuestions != nil && *s.RandomizeQuestions
+}
+
+// surveys ordering questions or answers per respondent, their respondents need a session
+func (s Survey) needsSession() bool {
+	return s.isRandomized() || slices.ContainsFunc(s.Questions, func(q Question) bool { return q.ShuffleAnswers })
+}
+
+// a new session for a respondent of a randomized survey
+func newSession() string {
+	return rand.Text()
+}
+
+// random numbers seeded by a survey, a respondent session and optionally a question, the same
+// arguments always give the same numbers
+func sessionRandom(surveyId bson.ObjectID, session string, questionId bson.ObjectID) *mathrand.Rand {
+	h := fnv.New64a()
+	h.Write(surveyId[:])
+	h.Write([]byte(session))
+	if !questionId.IsZero() {
+		h.Write(questionId[:])
+	}
+	return mathrand.New(mathrand.NewPCG(h.Sum64(), 0))
+}
+
+// choice questions whose answers can be listed in a different order for every respondent
+func (q Question) canShuffleAnswers() bool {
+	return q.QuestionType == "Multiple Choice" || q.QuestionType == "Checkbox" || q.QuestionType == "Ranking"
+}
+
+// the answers of a question in the order the respondent of session sees them. pinned answers and the
+// other option are not shuffled, they follow the shuffled answers in the order they are defined in
+func (q Question) answerOrder(surveyId bson.ObjectID, session string) []string {
+	if !q.ShuffleAnswers || session == "" {
+		return q.Answers
+	}
+	var shuffled, pinned []string
+	for _, answer := range q.Answers {
+		if answer == q.OtherOption || slices.Contains(q.PinnedAnswers, answer) {
+			pinned = append(pinned, answer)
+		} else {
+			shuffled = append(shuffled, answer)
+		}
+	}
+	random := sessionRandom(surveyId, session, q.Id)
+	random.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	return append(shuffled, pinned...)
+}
+
+// the questions of a survey in the order the respondent of session sees them. randomized surveys are
+// shuffled by a seed derived from the survey and the session, so the same session always gets the same
+// order. questions with display rules or placeholders, and the questions they refer to, keep their
+// positions so they are still asked after the questions they depend on
+func (s Survey) questionOrder(session string) []Question {
+	if !s.isRandomized() || session == "" {
+		return s.Questions
+	}
+	fixed := make(map[bson.ObjectID]bool)
+	for i, q := range s.Questions {
+		for _, c := range q.ShowIf {
+			fixed[q.Id], fixed[c.QuestionId] = true, true
+		}
+		for _, m := range pipePattern.FindAllStringSubmatch(q.QuestionTitle, -1) {
+			fixed[q.Id] = true
+			if n := placeholderIndex(m[1]); n >= 1 && n <= i {
+				fixed[s.Questions[n-1].Id] = true
+			}
+		}
+	}
+	var positions []int
+	var shuffled []Question
+	for i, q := range s.Questions {
+		if !fixed[q.Id] {
+			positions = append(positions, i)
+			shuffled = append(shuffled, q)
+		}
+	}
+
+	random := sessionRandom(s.Id, session, bson.ObjectID{})
+	random.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+
+	ordered := make([]Question, len(s.Questions))
+	copy(ordered, s.Questions)
+	for i, position := range positions {
+		ordered[position] = shuffled[i]
+	}
+	return ordered
+}
+
+// respondent view of a survey with the questions and answers in the order of session. randomized
+// surveys start a new session when none or an invalid one is given
+func (s Survey) publicFor(session string) PublicSurvey {
+	if !s.needsSession() {
+		return s.public()
+	}
+	session = strings.TrimSpace(session)
+	if session == "" || len(session) > maxSessionLength {
+		session = newSession()
+	}
+	questions := slices.Clone(s.questionOrder(session))
+	for i, q := range questions {
+		questions[i].Answers = q.answerOrder(s.Id, session)
+	}
+	s.Questions = questions
+	p := s.public()
+	p.Session = session
+	return p
+}
+
+// position of every question in the order the respondent of session sees them, from 1
+func (s Survey) questionPositions(session string) map[bson.ObjectID]int {
+	order := s.questionOrder(session)
+	positions := make(map[bson.ObjectID]int, len(order))
+	for i, q := range order {
+		positions[q.Id] = i + 1
+	}
+	return positions
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// token bucket of one client, refilled continuously
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// per-client token buckets allowing burst requests at once and perMinute requests a minute after that
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	perMinute float64
+	burst     float64
+	swept     time.Time
+}
+
+func newRateLimiter(perMinute, burst int) *rateLimiter {
+	return &rateLimiter{buckets: make(map[string]*bucket), perMinute: float64(perMinute), burst: float64(burst), swept: time.Now()}
+}
+
+// take a token for key, returning how long to wait for one when there is none left
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// buckets full again are forgotten, so the map does not grow with every client ever seen
+	refill := time.Duration(l.burst / l.perMinute * float64(time.Minute))
+	if now.Sub(l.swept) > refill {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > refill {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Minutes()*l.perMinute)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.perMinute * float64(time.Minute))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// limit the requests of every client address to next with limiter, a nil limiter lets every request through
+func rateLimited(limiter *rateLimiter, next http.HandlerFunc) http.HandlerFunc {
+	if limiter == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := limiter.allow(clientIP(r), time.Now())
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "Too many requests, please try again later", http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// roles a user can have on a survey, each includes the permissions of the ones before it
+const (
+	RoleViewer = "viewer" // read the survey and its results
+	RoleEditor = "editor" // modify the survey and its questions
+	RoleOwner  = "owner"  // delete the survey and manage its collaborators
+)
+
+var roleLevels = map[string]int{RoleViewer: 1, RoleEditor: 2, RoleOwner: 3}
+
+// collaborator of a survey, the owner is taken from the survey's owner_id and has no membership
+type Membership struct {
+	Id        bson.ObjectID `json:"id" bson:"_id"`
+	SurveyId  bson.ObjectID `json:"survey_id" bson:"survey_id"`
+	UserId    bson.ObjectID `json:"user_id" bson:"user_id"`
+	Role      string        `json:"role" bson:"role"`
+	CreatedAt time.Time     `json:"created_at" bson:"created_at"`
+}
+
+var membershipsCollection *mongo.Collection
+
+// role of the authenticated user on a survey, "" without access, the admin owns every survey.
+// trashed looks up surveys in the trash instead of live ones
+func surveyRole(ctx context.Context, r *http.Request, surveyId bson.ObjectID, trashed bool) (string, error) {
+	filter := bson.M{"_id": surveyId, "deleted_at": nil}
+	if trashed {
+		filter["deleted_at"] = bson.M{"$ne": nil}
+	}
+	var survey Survey
+	err := surveysCollection.FindOne(ctx, filter, options.FindOne().SetProjection(bson.M{"owner_id": 1})).Decode(&survey)
+	if err == mongo.ErrNoDocuments {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	userId, ok := currentUserId(r)
+	if !ok {
+		return RoleOwner, nil
+	}
+	if survey.OwnerId == userId {
+		return RoleOwner, nil
+	}
+	var membership Membership
+	err = membershipsCollection.FindOne(ctx, bson.M{"survey_id": surveyId, "user_id": userId}).Decode(&membership)
+	if err == mongo.ErrNoDocuments {
+		return "", nil
+	}
+	return membership.Role, err
+}
+
+// only let authenticated users with at least role on the {survey_id} of the route through
+func requireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return requireSurveyRole(role, false, next)
+}
+
+// same as requireRole for a {survey_id} in the trash
+func requireTrashedRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return requireSurveyRole(role, true, next)
+}
+
+func requireSurveyRole(role string, trashed bool, next http.HandlerFunc) http.HandlerFunc {
+	return requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		id, err := bson.ObjectIDFromHex(mux.Vars(r)["survey_id"])
+		if err != nil {
+			http.Error(w, "Invalid Survey Id", http.StatusBadRequest)
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		have, err := surveyRole(ctx, r, id, trashed)
+		if err != nil {
+			panic(err)
+		}
+		if have == "" {
+			// surveys of other authors are not revealed
+			http.Error(w, "No survey found", http.StatusNotFound)
+			return
+		}
+		if roleLevels[have] < roleLevels[role] {
+			http.Error(w, "Forbidden, this requires the "+role+" role on the survey", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	})
+}
+
+// filter limiting surveys to the ones the authenticated user owns or collaborates on, the admin sees every survey
+func surveyAccessScope(ctx context.Context, r *http.Request) (bson.M, error) {
+	userId, ok := currentUserId(r)
+	if !ok {
+		return bson.M{}, nil
+	}
+	surveyIds := []bson.ObjectID{}
+	if err := membershipsCollection.Distinct(ctx, "survey_id", bson.M{"user_id": userId}).Decode(&surveyIds); err != nil {
+		return nil, err
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{"owner_id": userId},
+		bson.M{"_id": bson.M{"$in": surveyIds}},
+	}}, nil
+}
+
+// ids of every survey the authenticated user can access, nil for the admin who is not limited
+func accessibleSurveyIds(ctx context.Context, r *http.Request) ([]bson.ObjectID, error) {
+	if _, ok := currentUserId(r); !ok {
+		return nil, nil
+	}
+	scope, err := surveyAccessScope(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	scope["deleted_at"] = nil
+	ids := []bson.ObjectID{}
+	err = surveysCollection.Distinct(ctx, "_id", scope).Decode(&ids)
+	return ids, err
+}
+
+// get collaborators of a survey
+func getMembers(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get members")
+	id, _ := bson.ObjectIDFromHex(mux.Vars(r)["survey_id"])
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := membershipsCollection.Find(ctx, bson.M{"survey_id": id})
+	if err != nil {
+		panic(err)
+	}
+	defer cursor.Close(ctx)
+	members := []Membership{}
+	if err = cursor.All(ctx, &members); err != nil {
+		panic(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
+
+// add a collaborator to a survey or change their role
+func setMember(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("set member")
+	queries := mux.Vars(r)
+	id, _ := bson.ObjectIDFromHex(queries["survey_id"])
+	userId, err := bson.ObjectIDFromHex(queries["user_id"])
+	if err != nil {
+		http.Error(w, "Invalid User Id", http.StatusBadRequest)
+		return
+	}
+	var input struct {
+		Role string `json:"role"`
+	}
+	if err = json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if input.Role != RoleViewer && input.Role != RoleEditor {
+		http.Error(w, "Invalid role, expected viewer or editor", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := usersCollection.CountDocuments(ctx, bson.M{"_id": userId})
+	if err != nil {
+		panic(err)
+	}
+	if count == 0 {
+		http.Error(w, "No user found", http.StatusNotFound)
+		return
+	}
+
+	var membership Membership
+	update := bson.M{
+		"$set":         bson.M{"role": input.Role},
+		"$setOnInsert": bson.M{"_id": bson.NewObjectID(), "created_at": time.Now()},
+	}
+	fOpt := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err = membershipsCollection.FindOneAndUpdate(ctx, bson.M{"survey_id": id, "user_id": userId}, update, fOpt).Decode(&membership)
+	if err != nil {
+		panic(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(membership)
+}
+
+// remove a collaborator from a survey
+func removeMember(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("remove member")
+	queries := mux.Vars(r)
+	id, _ := bson.ObjectIDFromHex(queries["survey_id"])
+	userId, err := bson.ObjectIDFromHex(queries["user_id"])
+	if err != nil {
+		http.Error(w, "Invalid User Id", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := membershipsCollection.DeleteOne(ctx, bson.M{"survey_id": id, "user_id": userId})
+	if err != nil {
+		panic(err)
+	}
+	if res.DeletedCount == 0 {
+		http.Error(w, "No member found", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "member removed"})
+}
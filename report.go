@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// render a PDF report with the answer distribution of every question of a survey
+func getSurveyReport(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get survey report")
+	id, _ := bson.ObjectIDFromHex(mux.Vars(r)["survey_id"])
+	survey, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+	filter, err := exportFilter(r, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), streamTimeout)
+	defer cancel()
+
+	counts, err := answerCounts(ctx, filter)
+	if err != nil {
+		panic(err)
+	}
+	respondents := []bson.ObjectID{}
+	if err = responsesCollection.Distinct(ctx, "user_id", filter).Decode(&respondents); err != nil {
+		panic(err)
+	}
+
+	doc := renderSurveyReport(survey, counts, len(respondents))
+	var out bytes.Buffer
+	if err = doc.writeTo(&out); err != nil {
+		panic(err)
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"survey-%s-report.pdf\"", survey.Token))
+	if _, err = w.Write(out.Bytes()); err != nil {
+		log.Println(err)
+	}
+}
+
+func renderSurveyReport(survey Survey, counts map[answerKey]map[string]int, respondents int) *pdfDoc {
+	const (
+		labelWidth = 180.0
+		barX       = pdfMargin + labelWidth + 10
+		barWidth   = 220.0
+		rowHeight  = 16.0
+	)
+	contentWidth := pdfPageWidth - 2*pdfMargin
+
+	doc := newPDF()
+	doc.paragraph(pdfMargin, contentWidth, 18, true, survey.Title)
+	doc.y += 4
+	doc.text(pdfMargin, doc.y, 10, false, fmt.Sprintf("%d respondents, generated %s", respondents, time.Now().UTC().Format("2006-01-02 15:04 MST")))
+	doc.y += 30
+
+	charts := make(map[bson.ObjectID]ChartData)
+	for _, chart := range surveyCharts(survey, counts) {
+		charts[chart.QuestionId] = chart
+	}
+
+	for i, q := range survey.Questions {
+		chart, isChart := charts[q.Id]
+		rows := 1
+		if isChart {
+			rows = len(chart.Options) + 1
+		}
+		// keep a question together with its first rows
+		doc.ensureSpace(30 + rowHeight*float64(min(rows, 5)))
+		doc.paragraph(pdfMargin, contentWidth, 12, true, fmt.Sprintf("%d. %s", i+1, q.QuestionTitle))
+		doc.text(pdfMargin, doc.y, 9, false, q.QuestionType)
+		doc.y += rowHeight
+
+		if !isChart {
+			// the answers to every row of a Matrix question are counted together
+			answers := 0
+			for key, answerCounts := range counts {
+				if key.QuestionId != q.Id {
+					continue
+				}
+				for _, n := range answerCounts {
+					answers += n
+				}
+			}
+			doc.text(pdfMargin, doc.y, 10, false, strconv.Itoa(answers)+" answers")
+			doc.y += rowHeight + 14
+			continue
+		}
+
+		total, most := 0, 0
+		for _, option := range chart.Options {
+			total += option.Count
+			most = max(most, option.Count)
+		}
+		for _, option := range chart.Options {
+			doc.ensureSpace(rowHeight)
+			doc.text(pdfMargin, doc.y+2, 10, false, pdfTruncate(option.Label, labelWidth, 10))
+			doc.rect(barX, doc.y, barWidth, rowHeight-4, 0.92)
+			if most > 0 {
+				doc.rect(barX, doc.y, barWidth*float64(option.Count)/float64(most), rowHeight-4, 0.35)
+			}
+			share := 0.0
+			if total > 0 {
+				share = 100 * float64(option.Count) / float64(total)
+			}
+			doc.text(barX+barWidth+8, doc.y+2, 10, false, fmt.Sprintf("%d (%.1f%%)", option.Count, share))
+			doc.y += rowHeight
+		}
+		if chart.Mean != nil {
+			doc.ensureSpace(rowHeight)
+			doc.text(pdfMargin, doc.y+2, 10, true, fmt.Sprintf("Mean score: %.2f", *chart.Mean))
+			doc.y += rowHeight
+		}
+		doc.y += 14
+	}
+	return doc
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// respondent of a survey accepting one response per respondent, unique per survey
+type RespondentKey struct {
+	Id            bson.ObjectID `bson:"_id"`
+	SurveyId      bson.ObjectID `bson:"survey_id"`
+	RespondentKey string        `bson:"respondent_key"`
+	UserId        bson.ObjectID `bson:"user_id"` // user_id of the responses submitted
+	CreatedAt     time.Time     `bson:"created_at"`
+}
+
+var respondentKeysCollection *mongo.Collection
+
+// cookie remembering the respondent key of a browser, so a browser keeps its key when its address changes
+const respondentKeyCookie = "respondent_key"
+
+// respondent keys are hex encoded sha256 hashes
+var respondentKeyPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+func (s Survey) isOncePerRespondent() bool {
+	return s.OneResponsePerRespondent != nil && *s.OneResponsePerRespondent
+}
+
+// address of the client of a request. behind trusted proxies it is taken from X-Forwarded-For, where every
+// proxy appends the address it got the request from: the client can forge the addresses on the left, so
+// the one appended by the first of config.TrustedProxyHops proxies is used, counting from the right
+func clientIP(r *http.Request) string {
+	if config.TrustProxyHeaders {
+		var forwarded []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			for _, addr := range strings.Split(header, ",") {
+				if addr = strings.TrimSpace(addr); addr != "" {
+					forwarded = append(forwarded, addr)
+				}
+			}
+		}
+		if len(forwarded) > 0 {
+			return forwarded[max(len(forwarded)-max(config.TrustedProxyHops, 1), 0)]
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// pseudonymous key of the respondent of a request: a hash of their respondent session, the key
+// remembered by the browser, or a hash of its address and user agent for browsers without one
+func respondentKey(r *http.Request, respondentId string) string {
+	if respondentId != "" {
+		sum := sha256.Sum256([]byte("session\n" + respondentId))
+		return hex.EncodeToString(sum[:])
+	}
+	if cookie, err := r.Cookie(respondentKeyCookie); err == nil && respondentKeyPattern.MatchString(cookie.Value) {
+		return cookie.Value
+	}
+	sum := sha256.Sum256([]byte(clientIP(r) + "\n" + r.UserAgent()))
+	return hex.EncodeToString(sum[:])
+}
+
+// record the submission of a respondent to a survey accepting one response per respondent, writing a
+// 409 when the respondent already submitted. returns the key to release if storing the responses fails,
+// "" for other surveys
+func claimRespondentKey(ctx context.Context, w http.ResponseWriter, r *http.Request, survey Survey, submission SubmissionInput, userId bson.ObjectID) (string, bool) {
+	if !survey.isOncePerRespondent() {
+		return "", true
+	}
+	key := respondentKey(r, submission.RespondentId)
+	_, err := respondentKeysCollection.InsertOne(ctx, RespondentKey{
+		Id:            bson.NewObjectID(),
+		SurveyId:      survey.Id,
+		RespondentKey: key,
+		UserId:        userId,
+		CreatedAt:     time.Now(),
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		http.Error(w, "a response has already been submitted to this survey", http.StatusConflict)
+		return "", false
+	}
+	if err != nil {
+		panic(err)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     respondentKeyCookie,
+		Value:    key,
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return key, true
+}
+
+// let the respondent submit again after their responses could not be stored
+func releaseRespondentKey(ctx context.Context, surveyId bson.ObjectID, key string) {
+	if key == "" {
+		return
+	}
+	if _, err := respondentKeysCollection.DeleteOne(ctx, bson.M{"survey_id": surveyId, "respondent_key": key}); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPIgnoresForgedForwardedAddresses(t *testing.T) {
+	keepConfig(t)
+	request := func(forwarded ...string) string {
+		r := httptest.NewRequest("POST", "/responses/x", nil)
+		r.RemoteAddr = "10.0.0.2:41234"
+		for _, f := range forwarded {
+			r.Header.Add("X-Forwarded-For", f)
+		}
+		return clientIP(r)
+	}
+
+	config.TrustProxyHeaders = false
+	if ip := request("198.51.100.7"); ip != "10.0.0.2" {
+		t.Errorf("without trusted proxies: %s, want the peer address", ip)
+	}
+
+	config.TrustProxyHeaders, config.TrustedProxyHops = true, 1
+	if ip := request("198.51.100.7"); ip != "198.51.100.7" {
+		t.Errorf("one proxy: %s, want 198.51.100.7", ip)
+	}
+	// the client sent a forged address, the proxy appended the real one
+	if ip := request("203.0.113.99, 198.51.100.7"); ip != "198.51.100.7" {
+		t.Errorf("forged header: %s, want the address appended by the proxy", ip)
+	}
+	if ip := request("203.0.113.99", "198.51.100.7"); ip != "198.51.100.7" {
+		t.Errorf("forged header line: %s, want the address appended by the proxy", ip)
+	}
+	if ip := request(); ip != "10.0.0.2" {
+		t.Errorf("no header: %s, want the peer address", ip)
+	}
+
+	// a CDN appended the client, then the load balancer appended the CDN
+	config.TrustedProxyHops = 2
+	if ip := request("203.0.113.99, 198.51.100.7, 192.0.2.10"); ip != "198.51.100.7" {
+		t.Errorf("two proxies: %s, want 198.51.100.7", ip)
+	}
+}
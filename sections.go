@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// group of questions shown together, every section is a page of the survey
+type Section struct {
+	Id          bson.ObjectID `json:"id" bson:"_id"`
+	Title       string        `json:"title" bson:"title"`
+	Description string        `json:"description,omitempty" bson:"description,omitempty"`
+}
+
+// body of the section endpoints
+type SectionInput struct {
+	Title       string          `json:"title"`
+	Description string          `json:"description"`
+	Position    int             `json:"position"`     // page number from 1, 0 keeps the section where it is or adds it last
+	QuestionIds []bson.ObjectID `json:"question_ids"` // questions moved to the section, unset leaves them as they are
+}
+
+// a page of a survey: a section and its questions, surveys without sections are a single page
+type Page struct {
+	Section   *Section
+	Questions []Question
+}
+
+// respondent view of one page of a survey
+type PublicPage struct {
+	Page        int              `json:"page"`
+	PageCount   int              `json:"page_count"`
+	Title       string           `json:"title,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Session     string           `json:"session,omitempty"`
+	Language    string           `json:"language,omitempty"`
+	Questions   []PublicQuestion `json:"questions"`
+}
+
+// outcome of checking the answers of the pages up to one page
+type PageResult struct {
+	Page     int  `json:"page"`
+	NextPage int  `json:"next_page,omitempty"` // unset after the last page
+	Complete bool `json:"complete"`            // no pages left, the answers can be submitted
+}
+
+// section titles are required, questions can only be in sections of their survey
+func validateSections(survey Survey) []ValidationError {
+	var errs []ValidationError
+	ids := make(map[bson.ObjectID]bool, len(survey.Sections))
+	for i, section := range survey.Sections {
+		field := fmt.Sprintf("sections[%d]", i)
+		if strings.TrimSpace(section.Title) == "" {
+			errs = append(errs, ValidationError{field + ".title", "Section title is required"})
+		}
+		if !section.Id.IsZero() {
+			if ids[section.Id] {
+				errs = append(errs, ValidationError{field + ".id", fmt.Sprintf("Duplicate section id %s", section.Id.Hex())})
+			}
+			ids[section.Id] = true
+		}
+	}
+	for i, q := range survey.Questions {
+		if !q.SectionId.IsZero() && !ids[q.SectionId] {
+			errs = append(errs, ValidationError{fmt.Sprintf("questions[%d].section_id", i), fmt.Sprintf("section %s is not part of the survey", q.SectionId.Hex())})
+		}
+	}
+	return errs
+}
+
+// the pages of a survey with questions in the given order. questions without a section, or
+// whose section was removed, are on the first page
+func (s Survey) pages(questions []Question) []Page {
+	if len(s.Sections) == 0 {
+		return []Page{{Questions: questions}}
+	}
+	pages := make([]Page, len(s.Sections))
+	index := make(map[bson.ObjectID]int, len(s.Sections))
+	for i := range s.Sections {
+		pages[i].Section = &s.Sections[i]
+		index[s.Sections[i].Id] = i
+	}
+	for _, q := range questions {
+		i := index[q.SectionId]
+		pages[i].Questions = append(pages[i].Questions, q)
+	}
+	return pages
+}
+
+// page number from the path, writes a 400 when it is not one
+func pageNumber(w http.ResponseWriter, r *http.Request) (int, bool) {
+	page, err := strconv.Atoi(mux.Vars(r)["page"])
+	if err != nil || page < 1 {
+		http.Error(w, "Invalid page, pages are numbered from 1", http.StatusBadRequest)
+		return 0, false
+	}
+	return page, true
+}
+
+// add a section to a survey
+func addSection(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("add section")
+	changeSections(w, r, func(survey *Survey, input SectionInput) (int, string) {
+		section := Section{Id: bson.NewObjectID(), Title: strings.TrimSpace(input.Title), Description: input.Description}
+		position := len(survey.Sections)
+		if input.Position > 0 {
+			position = min(input.Position-1, len(survey.Sections))
+		}
+		survey.Sections = slices.Insert(survey.Sections, position, section)
+		return position, ""
+	})
+}
+
+// change the title, description or position of a section, or the questions on it
+func updateSection(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("update section")
+	sectionId, err := bson.ObjectIDFromHex(mux.Vars(r)["section_id"])
+	if err != nil {
+		http.Error(w, "Invalid Section Id", http.StatusBadRequest)
+		return
+	}
+	changeSections(w, r, func(survey *Survey, input SectionInput) (int, string) {
+		i := slices.IndexFunc(survey.Sections, func(s Section) bool { return s.Id == sectionId })
+		if i < 0 {
+			return 0, "No section found"
+		}
+		section := survey.Sections[i]
+		section.Title, section.Description = strings.TrimSpace(input.Title), input.Description
+		survey.Sections = slices.Delete(survey.Sections, i, i+1)
+		if input.Position > 0 {
+			i = min(input.Position-1, len(survey.Sections))
+		}
+		survey.Sections = slices.Insert(survey.Sections, i, section)
+		return i, ""
+	})
+}
+
+// remove a section, its questions move to the first page
+func deleteSection(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("delete section")
+	sectionId, err := bson.ObjectIDFromHex(mux.Vars(r)["section_id"])
+	if err != nil {
+		http.Error(w, "Invalid Section Id", http.StatusBadRequest)
+		return
+	}
+	id, _ := bson.ObjectIDFromHex(mux.Vars(r)["survey_id"])
+	survey, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+	i := slices.IndexFunc(survey.Sections, func(s Section) bool { return s.Id == sectionId })
+	if i < 0 {
+		http.Error(w, "No section found", http.StatusNotFound)
+		return
+	}
+	survey.Sections = slices.Delete(survey.Sections, i, i+1)
+	for j, q := range survey.Questions {
+		if q.SectionId == sectionId {
+			survey.Questions[j].SectionId = bson.ObjectID{}
+		}
+	}
+	if _, ok := saveSections(w, survey); ok {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// load the survey of the request, let change apply the section input to it and store the result.
+// change returns the index of the changed section, or why the request cannot be applied
+func changeSections(w http.ResponseWriter, r *http.Request, change func(survey *Survey, input SectionInput) (int, string)) {
+	id, _ := bson.ObjectIDFromHex(mux.Vars(r)["survey_id"])
+	var input SectionInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if input.Position < 0 {
+		http.Error(w, "position should be a page number from 1", http.StatusBadRequest)
+		return
+	}
+	survey, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+	i, msg := change(&survey, input)
+	if msg != "" {
+		http.Error(w, msg, http.StatusNotFound)
+		return
+	}
+	section := survey.Sections[i]
+	for _, questionId := range input.QuestionIds {
+		j := slices.IndexFunc(survey.Questions, func(q Question) bool { return q.Id == questionId })
+		if j < 0 {
+			writeValidationErrors(w, []ValidationError{{"question_ids", fmt.Sprintf("question %s is not part of the survey", questionId.Hex())}})
+			return
+		}
+		survey.Questions[j].SectionId = section.Id
+	}
+	updated, ok := saveSections(w, survey)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// store the sections and questions of a survey read before, unless it has changed since
+func saveSections(w http.ResponseWriter, survey Survey) (Survey, bool) {
+	if errs := validateSections(survey); len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return survey, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": survey.Id, "version": survey.Version}
+	if survey.Version == 0 {
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+	update := bson.M{
+		"$set": bson.M{"sections": survey.Sections, "questions": survey.Questions, "updated_at": time.Now()},
+		"$inc": bson.M{"version": 1},
+	}
+	updated, err := updateSurveyWithHistory(ctx, filter, update)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, "Survey has been modified by someone else, please reload it and try again", http.StatusConflict)
+		return survey, false
+	}
+	if err != nil {
+		panic(err)
+	}
+	return updated, true
+}
+
+// one page of the respondent view of a survey, so long surveys can be delivered page by page
+func getSurveyPage(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get survey page")
+	page, ok := pageNumber(w, r)
+	if !ok {
+		return
+	}
+	survey, ok := findSurveyByToken(w, mux.Vars(r)["token"])
+	if !ok {
+		return
+	}
+
+	// the page's questions keep the respondent's order
+	query := r.URL.Query()
+	view := survey.publicFor(query.Get("session")).localize(survey, query.Get("lang"))
+	byId := make(map[bson.ObjectID]Question, len(survey.Questions))
+	for _, q := range survey.Questions {
+		byId[q.Id] = q
+	}
+	ordered := make([]Question, 0, len(view.Questions))
+	for _, pq := range view.Questions {
+		ordered = append(ordered, byId[pq.Id])
+	}
+	pages := survey.pages(ordered)
+	if page > len(pages) {
+		http.Error(w, fmt.Sprintf("the survey has %d pages", len(pages)), http.StatusNotFound)
+		return
+	}
+
+	result := PublicPage{Page: page, PageCount: len(pages), Session: view.Session, Language: view.Language, Questions: []PublicQuestion{}}
+	if section := pages[page-1].Section; section != nil {
+		// the section as localized in the view
+		i := slices.IndexFunc(view.Sections, func(s Section) bool { return s.Id == section.Id })
+		result.Title, result.Description = view.Sections[i].Title, view.Sections[i].Description
+	}
+	onPage := make(map[bson.ObjectID]bool)
+	for _, q := range pages[page-1].Questions {
+		onPage[q.Id] = true
+	}
+	for _, pq := range view.Questions {
+		if onPage[pq.Id] {
+			result.Questions = append(result.Questions, pq)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// check the answers given up to a page before moving on: every answer must be valid and the required
+// questions of the page and the pages before must be answered. nothing is stored, the answers of every
+// page are submitted together once the last page is complete
+func submitPage(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("submit page")
+	page, ok := pageNumber(w, r)
+	if !ok {
+		return
+	}
+	id, err := bson.ObjectIDFromHex(mux.Vars(r)["survey_id"])
+	if err != nil {
+		http.Error(w, "Invalid Survey Id", http.StatusBadRequest)
+		return
+	}
+	survey, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+	if !isAcceptingResponses(w, survey) {
+		return
+	}
+	var submission SubmissionInput
+	if err := json.NewDecoder(r.Body).Decode(&submission); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	pages := survey.pages(survey.Questions)
+	if page > len(pages) {
+		http.Error(w, fmt.Sprintf("the survey has %d pages", len(pages)), http.StatusNotFound)
+		return
+	}
+
+	scope := make(map[bson.ObjectID]bool)
+	for _, p := range pages[:page] {
+		for _, q := range p.Questions {
+			scope[q.Id] = true
+		}
+	}
+	if errs := validateResponsesFor(survey.Questions, submission.Responses, scope); len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	// pages whose questions are all hidden by the answers so far are skipped
+	result := PageResult{Page: page}
+	visible := visibleQuestions(survey.Questions, submission.Responses)
+	for next := page + 1; next <= len(pages) && result.NextPage == 0; next++ {
+		questions := pages[next-1].Questions
+		if len(questions) == 0 || slices.ContainsFunc(questions, func(q Question) bool { return visible[q.Id] }) {
+			result.NextPage = next
+		}
+	}
+	result.Complete = result.NextPage == 0
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// respondent sessions last long enough to link the submissions of a respondent over several surveys
+const respondentSessionTTL = 90 * 24 * time.Hour
+
+type RespondentSession struct {
+	SessionToken string `json:"session_token"`
+	RespondentId string `json:"respondent_id"` // stored with the responses submitted with the token
+	ExpiresIn    int64  `json:"expires_in"`    // seconds until the token expires
+}
+
+// start an anonymous respondent session. the token is a JWT of type "respondent" whose subject is a
+// random respondent id, respondents stay pseudonymous as nothing else is known about them
+func createSession(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("create session")
+	now := time.Now()
+	respondentId := rand.Text()
+	token, err := signJWT(Claims{respondentId, "respondent", now.Unix(), now.Add(respondentSessionTTL).Unix()})
+	if err != nil {
+		panic(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(RespondentSession{token, respondentId, int64(respondentSessionTTL.Seconds())})
+}
+
+// respondent id of the session token in the X-Respondent-Session header of a request, "" without one.
+// writes a 401 when the token is invalid, or missing while config.RequireRespondentSession is set
+func respondentSession(w http.ResponseWriter, r *http.Request) (string, bool) {
+	token := r.Header.Get("X-Respondent-Session")
+	if token == "" {
+		if config.RequireRespondentSession {
+			http.Error(w, "Unauthorized, a respondent session is required, start one with POST /sessions", http.StatusUnauthorized)
+			return "", false
+		}
+		return "", true
+	}
+	claims, err := parseJWT(token, "respondent")
+	if err != nil {
+		http.Error(w, "Unauthorized, "+err.Error(), http.StatusUnauthorized)
+		return "", false
+	}
+	return claims.Subject, true
+}
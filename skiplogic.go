@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// condition on the answer to an earlier question, a question is shown when all its conditions hold
+type DisplayCondition struct {
+	QuestionId bson.ObjectID `json:"question_id" bson:"question_id"`
+	Operator   string        `json:"operator" bson:"operator"` // equals or not_equals
+	Value      string        `json:"value" bson:"value"`
+}
+
+// operators of display conditions. a Checkbox answer equals every option it picked,
+// an unanswered question equals nothing
+var displayOperators = []string{"equals", "not_equals"}
+
+func (c DisplayCondition) holds(answers []string) bool {
+	equals := slices.Contains(answers, c.Value)
+	if c.Operator == "not_equals" {
+		return !equals
+	}
+	return equals
+}
+
+// display rules must reference other questions of the survey by id, with a known operator and,
+// for choice questions, one of their options. rules must not depend on each other in a cycle
+func validateDisplayRules(questions []Question) []ValidationError {
+	var errs []ValidationError
+	byId := make(map[bson.ObjectID]Question, len(questions))
+	for _, q := range questions {
+		if !q.Id.IsZero() {
+			byId[q.Id] = q
+		}
+	}
+	for i, q := range questions {
+		for j, c := range q.ShowIf {
+			field := fmt.Sprintf("questions[%d].show_if[%d]", i, j)
+			ref, ok := byId[c.QuestionId]
+			switch {
+			case !ok:
+				errs = append(errs, ValidationError{field + ".question_id", fmt.Sprintf("question %s is not part of the survey", c.QuestionId.Hex())})
+				continue
+			case c.QuestionId == q.Id:
+				errs = append(errs, ValidationError{field + ".question_id", "a question can not depend on itself"})
+				continue
+			case ref.QuestionType == "Matrix" || ref.QuestionType == "Ranking" || ref.QuestionType == "File Upload":
+				errs = append(errs, ValidationError{field + ".question_id", fmt.Sprintf("questions can not depend on %s questions", ref.QuestionType)})
+				continue
+			}
+			if !slices.Contains(displayOperators, c.Operator) {
+				errs = append(errs, ValidationError{field + ".operator", fmt.Sprintf("operator should be one of %v", displayOperators)})
+			}
+			if options := ref.options(); options != nil && !slices.Contains(options, c.Value) {
+				errs = append(errs, ValidationError{field + ".value", fmt.Sprintf("%q is not an option of question %q", c.Value, ref.QuestionTitle)})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	// depth-first search for a question reached again while its own conditions are being followed
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[bson.ObjectID]int, len(questions))
+	var inCycle func(id bson.ObjectID) bool
+	inCycle = func(id bson.ObjectID) bool {
+		switch state[id] {
+		case visiting:
+			return true
+		case done:
+			return false
+		}
+		state[id] = visiting
+		for _, c := range byId[id].ShowIf {
+			if inCycle(c.QuestionId) {
+				return true
+			}
+		}
+		state[id] = done
+		return false
+	}
+	for i, q := range questions {
+		if len(q.ShowIf) > 0 && state[q.Id] == unvisited && inCycle(q.Id) {
+			errs = append(errs, ValidationError{fmt.Sprintf("questions[%d].show_if", i), fmt.Sprintf("the display rules of question %q depend on each other in a cycle", q.QuestionTitle)})
+			break
+		}
+	}
+	return errs
+}
+
+// questions shown to a respondent giving the answers in inputs. a question is hidden when one of its
+// conditions does not hold, or depends on a hidden question
+func visibleQuestions(questions []Question, inputs []ResponseInput) map[bson.ObjectID]bool {
+	byId := make(map[bson.ObjectID]Question, len(questions))
+	for _, q := range questions {
+		byId[q.Id] = q
+	}
+	// answers as the texts conditions compare with, invalid answers are reported elsewhere
+	answers := make(map[bson.ObjectID][]string)
+	for _, input := range inputs {
+		q, ok := byId[input.QuestionId]
+		if !ok || q.QuestionType == "Matrix" {
+			continue
+		}
+		value, text, err := responseValue(q, input)
+		if err != nil {
+			continue
+		}
+		if options, ok := value.([]string); ok {
+			answers[q.Id] = append(answers[q.Id], options...)
+		} else {
+			answers[q.Id] = append(answers[q.Id], text)
+		}
+	}
+
+	visible := make(map[bson.ObjectID]bool, len(questions))
+	var isVisible func(q Question) bool
+	isVisible = func(q Question) bool {
+		if shown, ok := visible[q.Id]; ok {
+			return shown
+		}
+		// rules are acyclic, checked when the survey is saved
+		shown := true
+		for _, c := range q.ShowIf {
+			ref, ok := byId[c.QuestionId]
+			if !ok || !isVisible(ref) || !c.holds(answers[c.QuestionId]) {
+				shown = false
+				break
+			}
+		}
+		visible[q.Id] = shown
+		return shown
+	}
+	for _, q := range questions {
+		isVisible(q)
+	}
+	return visible
+}
+
+// point the display rules of questions at new question ids, for surveys whose questions got fresh ids
+func remapDisplayRules(questions []Question, newIds map[bson.ObjectID]bson.ObjectID) {
+	for i := range questions {
+		rules := slices.Clone(questions[i].ShowIf)
+		for j, c := range rules {
+			if id, ok := newIds[c.QuestionId]; ok {
+				rules[j].QuestionId = id
+			}
+		}
+		questions[i].ShowIf = rules
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// a comment is sent this often while no response comes in, so proxies do not close idle streams
+const streamHeartbeat = 15 * time.Second
+
+// push the responses submitted to a survey to the client as server-sent events while it stays connected.
+// every event carries the resume token of the change stream as its id, so a reconnecting client sending
+// it back as Last-Event-ID misses nothing
+func streamNewResponses(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("stream responses")
+	id, _ := bson.ObjectIDFromHex(mux.Vars(r)["survey_id"])
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// answers held for review stay out, like in the other results
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{
+		"operationType":           "insert",
+		"fullDocument.survey_id":  id,
+		"fullDocument.moderation": bson.M{"$nin": bson.A{ModerationPending, ModerationRejected}},
+	}}}}
+	csOpt := options.ChangeStream()
+	if lastId := r.Header.Get("Last-Event-ID"); lastId != "" {
+		csOpt.SetResumeAfter(bson.M{"_data": lastId})
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	stream, err := responsesCollection.Watch(ctx, pipeline, csOpt)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "live responses need MongoDB to run as a replica set", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	// the change stream is read in its own goroutine, so heartbeats go out while it waits
+	type change struct {
+		FullDocument Response `bson:"fullDocument"`
+	}
+	events := make(chan []byte)
+	go func() {
+		defer close(events)
+		defer stream.Close(context.Background())
+		for stream.Next(ctx) {
+			var c change
+			if err := stream.Decode(&c); err != nil {
+				log.Println(err)
+				continue
+			}
+			data, err := json.Marshal(c.FullDocument)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			var token struct {
+				Data string `bson:"_data"`
+			}
+			bson.Unmarshal(stream.ResumeToken(), &token)
+			select {
+			case events <- fmt.Appendf(nil, "id: %s\nevent: response\ndata: %s\n\n", token.Data, data):
+			case <-ctx.Done():
+				return
+			}
+		}
+		if err := stream.Err(); err != nil && ctx.Err() == nil {
+			log.Println(err)
+		}
+	}()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if _, err := w.Write(event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type SubmissionAnswer struct {
+	QuestionId   bson.ObjectID `json:"question_id"`
+	RowId        bson.ObjectID `json:"row_id,omitzero"` // Matrix questions only
+	ResponseText string        `json:"response_text"`
+}
+
+// all answers of one respondent to a survey
+type Submission struct {
+	UserId          bson.ObjectID      `json:"user_id"`
+	RespondentEmail string             `json:"respondent_email,omitempty"` // identified surveys only
+	SubmittedAt     time.Time          `json:"submitted_at"`
+	Answers         []SubmissionAnswer `json:"answers"` // in the order of the survey's questions
+}
+
+// get the responses of a survey grouped into one submission per respondent
+func getSubmissions(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get submissions")
+	id, _ := bson.ObjectIDFromHex(mux.Vars(r)["survey_id"])
+	survey, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+	filter, err := exportFilter(r, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), streamTimeout)
+	defer cancel()
+
+	// questions removed from the survey come last, like in the exports
+	columns, err := exportColumns(ctx, survey)
+	if err != nil {
+		panic(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+
+	w.Write([]byte("["))
+	count := 0
+	err = forEachRespondent(ctx, filter, func(row respondentRow) bool {
+		submission := Submission{
+			UserId:          row.UserId,
+			RespondentEmail: row.RespondentEmail,
+			SubmittedAt:     row.SubmittedAt,
+			Answers:         []SubmissionAnswer{},
+		}
+		for _, c := range columns {
+			if text, ok := row.Answers[c.key()]; ok {
+				submission.Answers = append(submission.Answers, SubmissionAnswer{c.QuestionId, c.RowId, text})
+			}
+		}
+		if count > 0 {
+			w.Write([]byte(","))
+		}
+		if err := encoder.Encode(submission); err != nil {
+			// the client has gone away, nothing more can be sent
+			log.Println(err)
+			return false
+		}
+		count++
+		if flusher != nil && count%streamFlushSize == 0 {
+			flusher.Flush()
+		}
+		return true
+	})
+	if err != nil {
+		log.Println(err)
+	}
+	w.Write([]byte("]"))
+}
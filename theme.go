@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+)
+
+// look of a survey for white-labeled frontends, every field is optional
+type Theme struct {
+	PrimaryColor    string `json:"primary_color,omitempty" bson:"primary_color,omitempty"`       // buttons and highlights, like #1a73e8
+	BackgroundColor string `json:"background_color,omitempty" bson:"background_color,omitempty"` // page background
+	TextColor       string `json:"text_color,omitempty" bson:"text_color,omitempty"`             // question titles and answers
+	LogoURL         string `json:"logo_url,omitempty" bson:"logo_url,omitempty"`                 // http or https image shown above the survey
+	Font            string `json:"font,omitempty" bson:"font,omitempty"`                         // font family name, like Open Sans
+	CustomCSS       bool   `json:"custom_css,omitempty" bson:"custom_css,omitempty"`             // the frontend applies its own stylesheet for the survey
+}
+
+// colors are hex codes like #fff or #1a73e8
+var colorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// font family names, without quotes or other characters that could escape a CSS declaration
+var fontPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 -]{0,63}$`)
+
+// colors, logo and font of a theme must be usable by frontends as they are
+func validateTheme(theme *Theme) []ValidationError {
+	if theme == nil {
+		return nil
+	}
+	var errs []ValidationError
+	colors := []struct{ field, value string }{
+		{"primary_color", theme.PrimaryColor},
+		{"background_color", theme.BackgroundColor},
+		{"text_color", theme.TextColor},
+	}
+	for _, c := range colors {
+		if c.value != "" && !colorPattern.MatchString(c.value) {
+			errs = append(errs, ValidationError{"theme." + c.field, fmt.Sprintf("%s should be a hex color like #1a73e8", c.field)})
+		}
+	}
+	if theme.LogoURL != "" {
+		u, err := url.Parse(theme.LogoURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, ValidationError{"theme.logo_url", "logo_url should be an http or https URL"})
+		}
+	}
+	if theme.Font != "" && !fontPattern.MatchString(theme.Font) {
+		errs = append(errs, ValidationError{"theme.font", "font should be a font family name of at most 64 letters, digits, spaces and hyphens"})
+	}
+	return errs
+}
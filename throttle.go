@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// submissions made to a survey in one minute, counted for surveys with max_submissions_per_minute
+type SubmissionWindow struct {
+	Id       bson.ObjectID `bson:"_id"`
+	SurveyId bson.ObjectID `bson:"survey_id"`
+	Window   time.Time     `bson:"window"` // start of the minute
+	Count    int           `bson:"count"`
+}
+
+var submissionWindowsCollection *mongo.Collection
+
+// highest max_submissions_per_minute a survey can set
+const maxSubmissionsPerMinute = 10000
+
+// windows are removed once they can no longer be counted in
+const submissionWindowTTL = 2 * time.Minute
+
+// count a submission to a survey limiting its submissions per minute, writing a 429 when the limit of
+// the current minute is reached. the count is taken with one atomic update, so concurrent submissions
+// of all server instances share it. it is called once every other check has passed, so rejected
+// submissions do not count
+func throttleSubmission(ctx context.Context, w http.ResponseWriter, survey Survey) bool {
+	if survey.MaxSubmissionsPerMinute == nil || *survey.MaxSubmissionsPerMinute == 0 {
+		return true
+	}
+	now := time.Now().UTC()
+	window := now.Truncate(time.Minute)
+	filter := bson.M{"survey_id": survey.Id, "window": window, "count": bson.M{"$lt": *survey.MaxSubmissionsPerMinute}}
+	update := bson.M{"$inc": bson.M{"count": 1}, "$setOnInsert": bson.M{"_id": bson.NewObjectID()}}
+	_, err := submissionWindowsCollection.UpdateOne(ctx, filter, update, options.UpdateOne().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// the window is full, or a concurrent submission opened it first
+		var res *mongo.UpdateResult
+		if res, err = submissionWindowsCollection.UpdateOne(ctx, filter, update); err == nil && res.MatchedCount == 0 {
+			retry := window.Add(time.Minute).Sub(now)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+			http.Error(w, fmt.Sprintf("the survey accepts at most %d submissions per minute, please try again shortly", *survey.MaxSubmissionsPerMinute), http.StatusTooManyRequests)
+			return false
+		}
+	}
+	if err != nil {
+		panic(err)
+	}
+	return true
+}
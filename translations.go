@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// texts of a survey in another language, texts left empty fall back to the default language
+type Translation struct {
+	Title           string                `json:"title,omitempty" bson:"title,omitempty"`
+	WelcomeMessage  string                `json:"welcome_message,omitempty" bson:"welcome_message,omitempty"`
+	ThankYouMessage string                `json:"thank_you_message,omitempty" bson:"thank_you_message,omitempty"`
+	Sections        []SectionTranslation  `json:"sections,omitempty" bson:"sections,omitempty"`
+	Questions       []QuestionTranslation `json:"questions,omitempty" bson:"questions,omitempty"`
+}
+
+type SectionTranslation struct {
+	SectionId   bson.ObjectID `json:"section_id" bson:"section_id"`
+	Title       string        `json:"title,omitempty" bson:"title,omitempty"`
+	Description string        `json:"description,omitempty" bson:"description,omitempty"`
+}
+
+type QuestionTranslation struct {
+	QuestionId    bson.ObjectID `json:"question_id" bson:"question_id"`
+	QuestionTitle string        `json:"question_title,omitempty" bson:"question_title,omitempty"`
+	Answers       []string      `json:"answers,omitempty" bson:"answers,omitempty"` // labels of the answers, in the same order
+	Rows          []string      `json:"rows,omitempty" bson:"rows,omitempty"`       // Matrix only: titles of the rows, in the same order
+}
+
+// language codes like en, fr or pt-BR
+var languagePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// the translation of a survey for lang, trying the base language of regional codes like fr-CA.
+// returns the language found, "" when the default language applies
+func (s Survey) translation(lang string) (Translation, string) {
+	for lang != "" {
+		if t, ok := s.Translations[lang]; ok && lang != s.Language {
+			return t, lang
+		}
+		i := strings.LastIndex(lang, "-")
+		if i < 0 {
+			break
+		}
+		lang = lang[:i]
+	}
+	return Translation{}, ""
+}
+
+// translations must name sections and questions of the survey and translate every answer and row
+func validateTranslation(survey Survey, t Translation) []ValidationError {
+	var errs []ValidationError
+	for i, st := range t.Sections {
+		if !slices.ContainsFunc(survey.Sections, func(s Section) bool { return s.Id == st.SectionId }) {
+			errs = append(errs, ValidationError{fmt.Sprintf("sections[%d].section_id", i), fmt.Sprintf("section %s is not part of the survey", st.SectionId.Hex())})
+		}
+	}
+	questions := make(map[bson.ObjectID]Question, len(survey.Questions))
+	for _, q := range survey.Questions {
+		questions[q.Id] = q
+	}
+	for i, qt := range t.Questions {
+		field := fmt.Sprintf("questions[%d]", i)
+		q, ok := questions[qt.QuestionId]
+		if !ok {
+			errs = append(errs, ValidationError{field + ".question_id", fmt.Sprintf("question %s is not part of the survey", qt.QuestionId.Hex())})
+			continue
+		}
+		if len(qt.Answers) > 0 && len(qt.Answers) != len(q.Answers) {
+			errs = append(errs, ValidationError{field + ".answers", fmt.Sprintf("question %q has %d answers, every one of them should be translated in order", q.QuestionTitle, len(q.Answers))})
+		}
+		if len(qt.Rows) > 0 && len(qt.Rows) != len(q.Rows) {
+			errs = append(errs, ValidationError{field + ".rows", fmt.Sprintf("question %q has %d rows, every one of them should be translated in order", q.QuestionTitle, len(q.Rows))})
+		}
+	}
+	return errs
+}
+
+// the respondent view of survey s in lang. answers keep their values, which submissions use, and get
+// translated labels in answer_labels. translations of questions whose answers or rows changed since
+// are left out
+func (p PublicSurvey) localize(s Survey, lang string) PublicSurvey {
+	t, found := s.translation(lang)
+	p.Language = s.Language
+	if found == "" {
+		return p
+	}
+	p.Language = found
+	if t.Title != "" {
+		p.Title = t.Title
+	}
+	if t.WelcomeMessage != "" && p.WelcomeMessage != "" {
+		p.WelcomeMessage = t.WelcomeMessage
+	}
+	if t.ThankYouMessage != "" && p.ThankYouMessage != "" {
+		p.ThankYouMessage = t.ThankYouMessage
+	}
+
+	sections := make([]Section, len(p.Sections))
+	copy(sections, p.Sections)
+	for _, st := range t.Sections {
+		for i := range sections {
+			if sections[i].Id != st.SectionId {
+				continue
+			}
+			if st.Title != "" {
+				sections[i].Title = st.Title
+			}
+			if st.Description != "" {
+				sections[i].Description = st.Description
+			}
+		}
+	}
+	p.Sections = sections
+
+	byId := make(map[bson.ObjectID]Question, len(s.Questions))
+	for _, q := range s.Questions {
+		byId[q.Id] = q
+	}
+	translated := make(map[bson.ObjectID]QuestionTranslation, len(t.Questions))
+	for _, qt := range t.Questions {
+		translated[qt.QuestionId] = qt
+	}
+	questions := make([]PublicQuestion, len(p.Questions))
+	for i, pq := range p.Questions {
+		qt, ok := translated[pq.Id]
+		if !ok {
+			questions[i] = pq
+			continue
+		}
+		q := byId[pq.Id]
+		if qt.QuestionTitle != "" {
+			pq.QuestionTitle = qt.QuestionTitle
+		}
+		if len(qt.Answers) > 0 && len(qt.Answers) == len(q.Answers) {
+			// labels follow the answers in the order they are listed, which may be shuffled
+			labels := make(map[string]string, len(q.Answers))
+			for j, answer := range q.Answers {
+				labels[answer] = qt.Answers[j]
+			}
+			pq.AnswerLabels = make([]string, len(pq.Answers))
+			for j, answer := range pq.Answers {
+				pq.AnswerLabels[j] = labels[answer]
+			}
+		}
+		if len(qt.Rows) > 0 && len(qt.Rows) == len(q.Rows) {
+			rows := make([]MatrixRow, len(q.Rows))
+			for j, row := range q.Rows {
+				rows[j] = MatrixRow{Id: row.Id, Title: qt.Rows[j]}
+			}
+			pq.Rows = rows
+		}
+		questions[i] = pq
+	}
+	p.Questions = questions
+	return p
+}
+
+// point the translations of a survey at new section and question ids, for surveys that got fresh ids
+func remapTranslations(translations map[string]Translation, sectionIds, questionIds map[bson.ObjectID]bson.ObjectID) map[string]Translation {
+	if translations == nil {
+		return nil
+	}
+	remapped := make(map[string]Translation, len(translations))
+	for lang, t := range translations {
+		sections := make([]SectionTranslation, len(t.Sections))
+		for i, st := range t.Sections {
+			st.SectionId = sectionIds[st.SectionId]
+			sections[i] = st
+		}
+		questions := make([]QuestionTranslation, len(t.Questions))
+		for i, qt := range t.Questions {
+			qt.QuestionId = questionIds[qt.QuestionId]
+			questions[i] = qt
+		}
+		t.Sections, t.Questions = sections, questions
+		remapped[lang] = t
+	}
+	return remapped
+}
+
+// add or replace the translation of a survey into a language
+func setTranslation(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("set translation")
+	queries := mux.Vars(r)
+	id, _ := bson.ObjectIDFromHex(queries["survey_id"])
+	lang := queries["lang"]
+	if !languagePattern.MatchString(lang) {
+		http.Error(w, "Invalid language, use a language code like fr or pt-BR", http.StatusBadRequest)
+		return
+	}
+	var translation Translation
+	if err := json.NewDecoder(r.Body).Decode(&translation); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	survey, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+	if lang == survey.Language {
+		http.Error(w, lang+" is the default language of the survey, its texts are edited on the survey", http.StatusBadRequest)
+		return
+	}
+	if errs := validateTranslation(survey, translation); len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+	changeTranslations(w, id, bson.M{"$set": bson.M{"translations." + lang: translation, "updated_at": time.Now()}})
+}
+
+// remove the translation of a survey into a language
+func deleteTranslation(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("delete translation")
+	queries := mux.Vars(r)
+	id, _ := bson.ObjectIDFromHex(queries["survey_id"])
+	lang := queries["lang"]
+	if !languagePattern.MatchString(lang) {
+		http.Error(w, "Invalid language, use a language code like fr or pt-BR", http.StatusBadRequest)
+		return
+	}
+	update := bson.M{"$unset": bson.M{"translations." + lang: ""}, "$set": bson.M{"updated_at": time.Now()}}
+	changeTranslations(w, id, update, "translations."+lang)
+}
+
+// apply update to the translations of a survey, only when the survey has every field in required
+func changeTranslations(w http.ResponseWriter, id bson.ObjectID, update bson.M, required ...string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": id, "deleted_at": nil}
+	for _, field := range required {
+		filter[field] = bson.M{"$exists": true}
+	}
+	update["$inc"] = bson.M{"version": 1}
+	survey, err := updateSurveyWithHistory(ctx, filter, update)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, "No translation found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(survey)
+}
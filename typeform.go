@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// form definition as returned by the Typeform Create API (GET /forms/{form_id}), only the fields the importer reads
+type TypeformForm struct {
+	Title  string          `json:"title"`
+	Fields []TypeformField `json:"fields"`
+	// screens shown before the first and after the last field
+	WelcomeScreens []struct {
+		Title string `json:"title"`
+	} `json:"welcome_screens"`
+	ThankyouScreens []struct {
+		Title      string `json:"title"`
+		Properties struct {
+			RedirectURL string `json:"redirect_url"`
+		} `json:"properties"`
+	} `json:"thankyou_screens"`
+	Logic []struct {
+		Ref string `json:"ref"`
+	} `json:"logic"`
+}
+
+type TypeformField struct {
+	Title      string `json:"title"`
+	Type       string `json:"type"`
+	Properties struct {
+		Choices []struct {
+			Label string `json:"label"`
+		} `json:"choices"`
+		AllowMultipleSelection bool `json:"allow_multiple_selection"`
+		AllowOtherChoice       bool `json:"allow_other_choice"`
+		Randomize              bool `json:"randomize"`
+		Steps                  int  `json:"steps"`
+		StartAtOne             bool `json:"start_at_one"`
+		Labels                 struct {
+			Left  string `json:"left"`
+			Right string `json:"right"`
+		} `json:"labels"`
+		Fields []TypeformField `json:"fields"` // fields of a question group
+	} `json:"properties"`
+	Validations struct {
+		Required bool     `json:"required"`
+		MinValue *float64 `json:"min_value"`
+		MaxValue *float64 `json:"max_value"`
+	} `json:"validations"`
+}
+
+// map a Typeform form onto a survey, fields and features without an equivalent are reported as skipped
+func (f TypeformForm) survey() (Survey, []SkippedFormItem) {
+	survey := Survey{Title: f.Title, Questions: []Question{}}
+	skipped := []SkippedFormItem{}
+	var add func(fields []TypeformField)
+	add = func(fields []TypeformField) {
+		for _, field := range fields {
+			switch field.Type {
+			case "group":
+				add(field.Properties.Fields)
+				continue
+			case "statement":
+				// text shown between questions, nothing to answer
+				continue
+			}
+			q, reason := field.question()
+			if reason != "" {
+				skipped = append(skipped, SkippedFormItem{field.Title, reason})
+				continue
+			}
+			survey.Questions = append(survey.Questions, q)
+		}
+	}
+	add(f.Fields)
+	// surveys have a single welcome and thank you screen
+	if len(f.WelcomeScreens) > 0 && f.WelcomeScreens[0].Title != "" {
+		survey.WelcomeMessage = &f.WelcomeScreens[0].Title
+	}
+	if len(f.ThankyouScreens) > 0 {
+		screen := f.ThankyouScreens[0]
+		if screen.Title != "" {
+			survey.ThankYouMessage = &screen.Title
+		}
+		if screen.Properties.RedirectURL != "" {
+			survey.CompletionRedirectURL = &screen.Properties.RedirectURL
+		}
+	}
+	// surveys show every question, so jumps cannot be kept
+	for _, logic := range f.Logic {
+		skipped = append(skipped, SkippedFormItem{"logic of " + logic.Ref, "logic jumps are not supported, every question is shown"})
+	}
+	return survey, skipped
+}
+
+// map a single Typeform field, returns the reason when it cannot be mapped
+func (field TypeformField) question() (Question, string) {
+	props := field.Properties
+	q := Question{QuestionTitle: field.Title}
+	switch field.Type {
+	case "multiple_choice", "dropdown", "picture_choice":
+		q.QuestionType = "Multiple Choice"
+		if props.AllowMultipleSelection {
+			q.QuestionType = "Checkbox"
+		}
+		for _, choice := range props.Choices {
+			q.Answers = append(q.Answers, choice.Label)
+		}
+		q.ShuffleAnswers = props.Randomize
+		if props.AllowOtherChoice {
+			q.Answers = append(q.Answers, "Other")
+			if q.QuestionType == "Multiple Choice" {
+				q.OtherOption = "Other"
+			} else if props.Randomize {
+				q.PinnedAnswers = []string{"Other"}
+			}
+		}
+	case "yes_no":
+		q.QuestionType = "Multiple Choice"
+		q.Answers = []string{"Yes", "No"}
+	case "legal":
+		q.QuestionType = "Multiple Choice"
+		q.Answers = []string{"I accept", "I don't accept"}
+	case "short_text", "long_text", "email", "phone_number", "website":
+		q.QuestionType = "Textbox"
+	case "number":
+		q.QuestionType = "Number"
+		q.MinValue, q.MaxValue = field.Validations.MinValue, field.Validations.MaxValue
+	case "date":
+		q.QuestionType = "Date"
+	case "opinion_scale":
+		steps := props.Steps
+		if steps == 0 {
+			steps = 11
+		}
+		low := 0
+		if props.StartAtOne {
+			low = 1
+		}
+		q = scaleQuestion(field.Title, low, low+steps-1, props.Labels.Left, props.Labels.Right)
+	case "ranking":
+		q.QuestionType = "Ranking"
+		for _, choice := range props.Choices {
+			q.Answers = append(q.Answers, choice.Label)
+		}
+		q.ShuffleAnswers = props.Randomize
+	case "nps":
+		q.QuestionType = "NPS"
+	case "rating":
+		steps := props.Steps
+		if steps == 0 {
+			steps = 5
+		}
+		q.QuestionType = "Rating"
+		q.ScaleMin, q.ScaleMax = 1, steps
+	default:
+		return q, fmt.Sprintf("%s fields are not supported", field.Type)
+	}
+	q.Required = field.Validations.Required
+	return q, ""
+}
+
+// create a new draft from a Typeform form definition
+func importTypeform(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("import typeform")
+	var form TypeformForm
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	survey, skipped := form.survey()
+	storeImportedForm(w, r, survey, skipped)
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// size limits of uploaded files, questions can lower the default or raise it up to maxUploadSize
+const (
+	defaultMaxFileSize = 10 << 20
+	maxUploadSize      = 50 << 20
+	uploadTimeout      = 2 * time.Minute
+)
+
+// uploads that no submitted or saved answer refers to are removed after unreferencedUploadTTL
+const (
+	unreferencedUploadTTL = 24 * time.Hour
+	uploadCleanupInterval = time.Hour
+)
+
+// GridFS bucket holding the files uploaded to File Upload questions
+var uploadsBucket *mongo.GridFSBucket
+
+// stored with every uploaded file, links it to the question it answers and to the respondent who
+// uploaded it, only their submission can use it
+type UploadMetadata struct {
+	SurveyId     bson.ObjectID `bson:"survey_id"`
+	QuestionId   bson.ObjectID `bson:"question_id"`
+	ContentType  string        `bson:"content_type"`
+	RespondentId string        `bson:"respondent_id,omitempty"` // respondent session of the uploader
+	PartialId    bson.ObjectID `bson:"partial_id,omitempty"`    // saved answers the file was uploaded for
+	Referenced   bool          `bson:"referenced,omitempty"`    // set by the cleanup once a submitted response uses the file
+}
+
+type UploadedFile struct {
+	FileId      bson.ObjectID `json:"file_id"`
+	Filename    string        `json:"filename"`
+	ContentType string        `json:"content_type"`
+	Size        int64         `json:"size"`
+}
+
+// largest file accepted by a File Upload question
+func (q Question) fileSizeLimit() int64 {
+	if q.MaxFileSize > 0 {
+		return q.MaxFileSize
+	}
+	return defaultMaxFileSize
+}
+
+// whether a File Upload question accepts files of contentType. allowed types are
+// MIME types like "application/pdf" or whole families like "image/*", no types accepts any file
+func (q Question) acceptsType(contentType string) bool {
+	if len(q.AllowedTypes) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(q.AllowedTypes, func(allowed string) bool {
+		if family, ok := strings.CutSuffix(allowed, "/*"); ok {
+			return strings.HasPrefix(contentType, family+"/")
+		}
+		return strings.EqualFold(allowed, contentType)
+	})
+}
+
+// upload a file answering a File Upload question, the returned file_id is then submitted as the answer
+func uploadFile(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("upload file")
+	queries := mux.Vars(r)
+	id, err := bson.ObjectIDFromHex(queries["survey_id"])
+	if err != nil {
+		http.Error(w, "Invalid Survey Id", http.StatusBadRequest)
+		return
+	}
+	questionId, err := bson.ObjectIDFromHex(queries["question_id"])
+	if err != nil {
+		http.Error(w, "Invalid Question Id", http.StatusBadRequest)
+		return
+	}
+	survey, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+	if !isAcceptingResponses(w, survey) {
+		return
+	}
+	i := slices.IndexFunc(survey.Questions, func(q Question) bool { return q.Id == questionId })
+	if i < 0 {
+		http.Error(w, "No question found", http.StatusNotFound)
+		return
+	}
+	q := survey.Questions[i]
+	if q.QuestionType != "File Upload" {
+		http.Error(w, "files can only be uploaded to File Upload questions", http.StatusBadRequest)
+		return
+	}
+
+	// the file belongs to the respondent session or the saved answers it is uploaded with
+	metadata := UploadMetadata{SurveyId: id, QuestionId: questionId}
+	if metadata.RespondentId, ok = respondentSession(w, r); !ok {
+		return
+	}
+	if token := r.URL.Query().Get("resume_token"); token != "" {
+		partial, ok := findPartialResponse(w, id, token)
+		if !ok {
+			return
+		}
+		metadata.PartialId = partial.Id
+	}
+	if metadata.RespondentId == "" && metadata.PartialId.IsZero() {
+		http.Error(w, "Unauthorized, files are uploaded with a respondent session (X-Respondent-Session) or the resume_token of saved answers", http.StatusUnauthorized)
+		return
+	}
+
+	// the multipart envelope adds a little to the file itself
+	limit := q.fileSizeLimit()
+	r.Body = http.MaxBytesReader(w, r.Body, limit+1<<20)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "the file should be sent as multipart/form-data", http.StatusBadRequest)
+		return
+	}
+	var part io.Reader
+	filename := ""
+	for {
+		p, err := reader.NextPart()
+		if err != nil {
+			http.Error(w, "the form has no file field", http.StatusBadRequest)
+			return
+		}
+		if p.FormName() == "file" {
+			part, filename = p, p.FileName()
+			break
+		}
+	}
+	if filename == "" {
+		filename = "upload"
+	}
+
+	// the type is sniffed from the content, the type claimed by the client is not trusted
+	head := make([]byte, 512)
+	n, err := io.ReadFull(part, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		http.Error(w, "the file could not be read", http.StatusBadRequest)
+		return
+	}
+	head = head[:n]
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if !q.acceptsType(contentType) {
+		http.Error(w, fmt.Sprintf("%s files are not accepted, allowed types are %s", contentType, strings.Join(q.AllowedTypes, ", ")), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), uploadTimeout)
+	defer cancel()
+
+	metadata.ContentType = contentType
+	content := &countingReader{r: io.LimitReader(io.MultiReader(bytes.NewReader(head), part), limit+1)}
+	fileId, err := uploadsBucket.UploadFromStream(ctx, filename, content, options.GridFSUpload().SetMetadata(metadata))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) || content.n > limit {
+		if !fileId.IsZero() {
+			if err := uploadsBucket.Delete(ctx, fileId); err != nil && !errors.Is(err, mongo.ErrFileNotFound) {
+				log.Println(err)
+			}
+		}
+		http.Error(w, fmt.Sprintf("the file is larger than %d bytes", limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(UploadedFile{FileId: fileId, Filename: filename, ContentType: contentType, Size: content.n})
+}
+
+// reader counting the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// problems of the File Upload answers of a submission, every file must have been uploaded for the question it
+// answers, by the respondent session of the submission or for the saved answers submitted as userId
+func checkUploads(ctx context.Context, survey Survey, inputs []ResponseInput, respondentId string, userId bson.ObjectID) ([]ValidationError, error) {
+	owners := bson.A{bson.M{"metadata.partial_id": userId}}
+	if respondentId != "" {
+		owners = append(owners, bson.M{"metadata.respondent_id": respondentId})
+	}
+	questions := make(map[bson.ObjectID]Question, len(survey.Questions))
+	for _, q := range survey.Questions {
+		questions[q.Id] = q
+	}
+	errs := []ValidationError{}
+	for i, input := range inputs {
+		q := questions[input.QuestionId]
+		if q.QuestionType != "File Upload" {
+			continue
+		}
+		fileId, _, _ := responseValue(q, input) // validated before
+		count, err := uploadsBucket.GetFilesCollection().CountDocuments(ctx, bson.M{
+			"_id":                  fileId,
+			"metadata.survey_id":   survey.Id,
+			"metadata.question_id": q.Id,
+			"$or":                  owners,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			errs = append(errs, ValidationError{fmt.Sprintf("responses[%d].response_text", i), fmt.Sprintf("file %v was not uploaded for question %q", fileId, q.QuestionTitle)})
+		}
+	}
+	return errs, nil
+}
+
+// remove the uploads older than unreferencedUploadTTL that neither a response nor saved answers use.
+// files used by a response are marked as referenced and kept from then on
+func cleanupUploads() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	cursor, err := uploadsBucket.GetFilesCollection().Find(ctx, bson.M{
+		"uploadDate":          bson.M{"$lt": time.Now().Add(-unreferencedUploadTTL)},
+		"metadata.referenced": bson.M{"$ne": true},
+	})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	removed := 0
+	for cursor.Next(ctx) {
+		var file struct {
+			Id       bson.ObjectID  `bson:"_id"`
+			Metadata UploadMetadata `bson:"metadata"`
+		}
+		if err := cursor.Decode(&file); err != nil {
+			log.Println(err)
+			continue
+		}
+		used, err := responsesCollection.CountDocuments(ctx, bson.M{"survey_id": file.Metadata.SurveyId, "question_id": file.Metadata.QuestionId, "value": file.Id}, options.Count().SetLimit(1))
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		if used > 0 {
+			if _, err := uploadsBucket.GetFilesCollection().UpdateOne(ctx, bson.M{"_id": file.Id}, bson.M{"$set": bson.M{"metadata.referenced": true}}); err != nil {
+				log.Println(err)
+			}
+			continue
+		}
+		// saved answers keep their files until they are submitted or expire
+		saved, err := partialResponsesCollection.CountDocuments(ctx, bson.M{
+			"survey_id": file.Metadata.SurveyId,
+			"$or":       bson.A{bson.M{"responses.response_text": file.Id.Hex()}, bson.M{"responses.value": file.Id.Hex()}},
+		}, options.Count().SetLimit(1))
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		if saved > 0 {
+			continue
+		}
+		if err := uploadsBucket.Delete(ctx, file.Id); err != nil && !errors.Is(err, mongo.ErrFileNotFound) {
+			log.Println(err)
+			continue
+		}
+		removed++
+	}
+	if err := cursor.Err(); err != nil {
+		log.Println(err)
+	}
+	if removed > 0 {
+		log.Printf("removed %d unused uploads", removed)
+	}
+}
+
+// remove unused uploads every interval until the process exits
+func startUploadCleanup(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			cleanupUploads()
+		}
+	}()
+}
+
+// download a file uploaded to a File Upload question of a survey
+func downloadFile(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("download file")
+	queries := mux.Vars(r)
+	id, _ := bson.ObjectIDFromHex(queries["survey_id"])
+	fileId, err := bson.ObjectIDFromHex(queries["file_id"])
+	if err != nil {
+		http.Error(w, "Invalid File Id", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), uploadTimeout)
+	defer cancel()
+
+	stream, err := uploadsBucket.OpenDownloadStream(ctx, fileId)
+	if errors.Is(err, mongo.ErrFileNotFound) {
+		http.Error(w, "No file found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+	defer stream.Close()
+
+	file := stream.GetFile()
+	var metadata UploadMetadata
+	if err := bson.Unmarshal(file.Metadata, &metadata); err != nil || metadata.SurveyId != id {
+		// files of other surveys are not revealed
+		http.Error(w, "No file found", http.StatusNotFound)
+		return
+	}
+	contentType := metadata.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", fmt.Sprint(file.Length))
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": file.Name})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := io.Copy(w, stream); err != nil {
+		// the client has gone away, nothing more can be sent
+		log.Println(err)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// upload a text file to the first question of a survey, with the given respondent session and resume token
+func upload(t *testing.T, survey Survey, session, resumeToken string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "notes.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("some notes"))
+	form.Close()
+
+	target := "/responses/" + survey.Id.Hex() + "/questions/" + survey.Questions[0].Id.Hex() + "/files"
+	if resumeToken != "" {
+		target += "?resume_token=" + resumeToken
+	}
+	r := httptest.NewRequest("POST", target, &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	if session != "" {
+		r.Header.Set("X-Respondent-Session", session)
+	}
+	r = mux.SetURLVars(r, map[string]string{"survey_id": survey.Id.Hex(), "question_id": survey.Questions[0].Id.Hex()})
+	w := httptest.NewRecorder()
+	uploadFile(w, r)
+	return w
+}
+
+func respondentToken(t *testing.T) string {
+	t.Helper()
+	w := serve(createSession, "POST", "/sessions", nil, nil)
+	return decodeBody[RespondentSession](t, w).SessionToken
+}
+
+func TestUploadsBelongToTheirRespondent(t *testing.T) {
+	ctx := testDB(t)
+	keepConfig(t)
+	config.JWTSecret = []byte("test secret")
+	survey := insertSurvey(t, ctx, Survey{Title: "Receipts", Questions: []Question{{QuestionTitle: "Receipt", QuestionType: "File Upload"}}})
+	submit := func(session, fileId string) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(map[string]any{"responses": []map[string]any{{"question_id": survey.Questions[0].Id, "response_text": fileId}}})
+		r := httptest.NewRequest("POST", "/responses/"+survey.Id.Hex(), bytes.NewReader(data))
+		r.Header.Set("X-Respondent-Session", session)
+		r = mux.SetURLVars(r, map[string]string{"survey_id": survey.Id.Hex()})
+		w := httptest.NewRecorder()
+		submitResponse(w, r)
+		return w
+	}
+
+	if w := upload(t, survey, "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("upload without a session: status %d, want 401", w.Code)
+	}
+	if w := upload(t, survey, "", "unknown"); w.Code != http.StatusNotFound {
+		t.Errorf("upload with an unknown resume token: status %d, want 404", w.Code)
+	}
+
+	owner, other := respondentToken(t), respondentToken(t)
+	w := upload(t, survey, owner, "")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("upload with a session: status %d: %s", w.Code, w.Body)
+	}
+	file := decodeBody[UploadedFile](t, w)
+
+	if w := submit(other, file.FileId.Hex()); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("file submitted by another respondent: status %d, want 422", w.Code)
+	}
+	if w := submit(owner, file.FileId.Hex()); w.Code != http.StatusCreated {
+		t.Errorf("file submitted by its uploader: status %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestCleanupUploads(t *testing.T) {
+	ctx := testDB(t)
+	surveyId, questionId := bson.NewObjectID(), bson.NewObjectID()
+	store := func(age time.Duration) bson.ObjectID {
+		t.Helper()
+		metadata := UploadMetadata{SurveyId: surveyId, QuestionId: questionId, ContentType: "text/plain", RespondentId: "respondent"}
+		id, err := uploadsBucket.UploadFromStream(ctx, "notes.txt", strings.NewReader("some notes"), options.GridFSUpload().SetMetadata(metadata))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := uploadsBucket.GetFilesCollection().UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"uploadDate": time.Now().Add(-age)}}); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	recent := store(time.Hour)
+	unused := store(2 * unreferencedUploadTTL)
+	submitted := store(2 * unreferencedUploadTTL)
+	saved := store(2 * unreferencedUploadTTL)
+
+	response := answer(surveyId, bson.NewObjectID(), questionId, submitted.Hex())
+	response.Value = submitted
+	insertResponses(t, ctx, response)
+	partial := PartialResponse{Id: bson.NewObjectID(), SurveyId: surveyId, ResumeToken: "token", Responses: []ResponseInput{{QuestionId: questionId, ResponseText: saved.Hex()}}}
+	if _, err := partialResponsesCollection.InsertOne(ctx, partial); err != nil {
+		t.Fatal(err)
+	}
+
+	cleanupUploads()
+
+	exists := func(id bson.ObjectID) bool {
+		count, err := uploadsBucket.GetFilesCollection().CountDocuments(context.Background(), bson.M{"_id": id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return count > 0
+	}
+	for name, id := range map[string]bson.ObjectID{"recent": recent, "submitted": submitted, "saved": saved} {
+		if !exists(id) {
+			t.Errorf("the %s file was removed", name)
+		}
+	}
+	if exists(unused) {
+		t.Error("the unused file was kept")
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// device classes of respondents
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceUnknown = "unknown"
+)
+
+// browser families, tokens of browsers built on another come before the one they are built on, as
+// their user agents also name it, e.g. Edge names Chrome and Safari
+var browserTokens = []struct{ token, browser string }{
+	{"Edg/", "Edge"},
+	{"EdgA/", "Edge"},
+	{"EdgiOS/", "Edge"},
+	{"OPR/", "Opera"},
+	{"Opera", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"FxiOS/", "Firefox"},
+	{"Firefox/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+	{"MSIE ", "Internet Explorer"},
+	{"Trident/", "Internet Explorer"},
+}
+
+// device class and browser family of a user agent, unknown when they can not be told
+func parseUserAgent(ua string) (string, string) {
+	if ua == "" {
+		return DeviceUnknown, "unknown"
+	}
+	lower := strings.ToLower(ua)
+	device := DeviceDesktop
+	switch {
+	case strings.Contains(lower, "bot") || strings.Contains(lower, "spider") || strings.Contains(lower, "crawl") ||
+		strings.HasPrefix(lower, "curl/") || strings.HasPrefix(lower, "python-") || strings.HasPrefix(lower, "go-http-client"):
+		device = DeviceBot
+	case strings.Contains(lower, "ipad") || strings.Contains(lower, "tablet") ||
+		(strings.Contains(lower, "android") && !strings.Contains(lower, "mobile")):
+		device = DeviceTablet
+	case strings.Contains(lower, "mobi") || strings.Contains(lower, "iphone") || strings.Contains(lower, "ipod"):
+		device = DeviceMobile
+	case !strings.HasPrefix(ua, "Mozilla/"):
+		device = DeviceUnknown
+	}
+	browser := "other"
+	for _, b := range browserTokens {
+		if strings.Contains(ua, b.token) {
+			browser = b.browser
+			break
+		}
+	}
+	return device, browser
+}
+
+// submissions of a survey from one device class
+type DeviceCount struct {
+	Device   string         `json:"device"`
+	Count    int            `json:"count"`
+	Browsers []BrowserCount `json:"browsers"`
+}
+
+type BrowserCount struct {
+	Browser string `json:"browser" bson:"browser"`
+	Count   int    `json:"count" bson:"count"`
+}
+
+// get the number of submissions per device class and browser of a survey
+func getDeviceBreakdown(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get device breakdown")
+	id, _ := bson.ObjectIDFromHex(mux.Vars(r)["survey_id"])
+	filter, err := exportFilter(r, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// responses submitted before devices were recorded are not counted
+	filter["device"] = bson.M{"$exists": true}
+
+	ctx, cancel := context.WithTimeout(context.Background(), streamTimeout)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{
+			"_id":     "$user_id",
+			"device":  bson.M{"$first": "$device"},
+			"browser": bson.M{"$first": "$browser"},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"device": "$device", "browser": "$browser"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      "$_id.device",
+			"count":    bson.M{"$sum": "$count"},
+			"browsers": bson.M{"$push": bson.M{"browser": "$_id.browser", "count": "$count"}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+	}
+	cursor, err := responsesCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		panic(err)
+	}
+	defer cursor.Close(ctx)
+	var groups []struct {
+		Device   string         `bson:"_id"`
+		Count    int            `bson:"count"`
+		Browsers []BrowserCount `bson:"browsers"`
+	}
+	if err = cursor.All(ctx, &groups); err != nil {
+		panic(err)
+	}
+
+	devices := make([]DeviceCount, 0, len(groups))
+	for _, g := range groups {
+		slices.SortFunc(g.Browsers, func(a, b BrowserCount) int { return b.Count - a.Count })
+		devices = append(devices, DeviceCount{g.Device, g.Count, g.Browsers})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(devices)
+}
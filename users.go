@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// survey author account
+type User struct {
+	Id            bson.ObjectID `json:"id" bson:"_id"`
+	Username      string        `json:"username" bson:"username"`
+	Email         string        `json:"email,omitempty" bson:"email,omitempty"`                   // where notifications of their surveys go, once verified
+	EmailVerified bool          `json:"email_verified,omitempty" bson:"email_verified,omitempty"` // the author proved they own the email, see verifyEmail
+	PasswordHash  string        `json:"-" bson:"password_hash,omitempty"`                         // unset for accounts created through Google login
+	GoogleId      string        `json:"-" bson:"google_id,omitempty"`
+	CreatedAt     time.Time     `json:"created_at" bson:"created_at"`
+}
+
+var usersCollection *mongo.Collection
+
+const passwordIterations = 600000
+
+// hash a password as "pbkdf2-sha256$<iterations>$<salt>$<key>"
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordIterations, 32)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", passwordIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func checkPassword(hash string, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(expected))
+	return err == nil && subtle.ConstantTimeCompare(key, expected) == 1
+}
+
+// id of the authenticated user, ok is false for the configured admin who is not scoped to an owner
+func currentUserId(r *http.Request) (bson.ObjectID, bool) {
+	id, err := bson.ObjectIDFromHex(authClaims(r).Subject)
+	return id, err == nil
+}
+
+// register a survey author
+func register(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("register")
+	var input struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Email    string `json:"email"` // optional
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	errs := []ValidationError{}
+	username := strings.ToLower(strings.TrimSpace(input.Username))
+	if username == "" {
+		errs = append(errs, ValidationError{"username", "Username is required"})
+	}
+	if username == strings.ToLower(config.AdminUsername) {
+		errs = append(errs, ValidationError{"username", "Username is reserved"})
+	}
+	email := strings.TrimSpace(input.Email)
+	if address, err := mail.ParseAddress(email); email != "" && (err != nil || address.Address != email) {
+		errs = append(errs, ValidationError{"email", "Email should be an address like name@example.com"})
+	}
+	if len(input.Password) < 8 {
+		errs = append(errs, ValidationError{"password", "Password should have at least 8 characters"})
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	hash, err := hashPassword(input.Password)
+	if err != nil {
+		panic(err)
+	}
+	user := User{
+		Id:           bson.NewObjectID(),
+		Username:     username,
+		Email:        email,
+		PasswordHash: hash,
+		CreatedAt:    time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = usersCollection.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		http.Error(w, "Username is already taken", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+	sendEmailVerification(user)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
+
+// email verification tokens stay valid this long
+const emailVerificationTTL = 48 * time.Hour
+
+// email a token proving the author owns their email, notifications are only sent to verified emails.
+// the token is bound to the address, so it can not verify another one
+func sendEmailVerification(user User) {
+	if user.Email == "" || !smtpEnabled() {
+		return
+	}
+	now := time.Now()
+	token, err := signJWT(Claims{user.Id.Hex() + " " + user.Email, "verify-email", now.Unix(), now.Add(emailVerificationTTL).Unix()})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	queueEmail(email{user.Email, "Verify your email",
+		fmt.Sprintf("Hello %s,\n\nconfirm this is your email to receive the notifications of your surveys, with the code below (valid for %d hours):\n\n%s\n",
+			user.Username, int(emailVerificationTTL.Hours()), token)})
+}
+
+// mark the email of an author verified with the token they were emailed
+func verifyEmail(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("verify email")
+	var input struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	claims, err := parseJWT(input.Token, "verify-email")
+	if err != nil {
+		http.Error(w, "Invalid verification token, "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	hexId, address, _ := strings.Cut(claims.Subject, " ")
+	id, err := bson.ObjectIDFromHex(hexId)
+	if err != nil {
+		http.Error(w, "Invalid verification token", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := usersCollection.UpdateOne(ctx, bson.M{"_id": id, "email": address}, bson.M{"$set": bson.M{"email_verified": true}})
+	if err != nil {
+		panic(err)
+	}
+	if res.MatchedCount == 0 {
+		http.Error(w, "No author found with this email", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "email verified"})
+}
+
+// email the authenticated author a new verification token
+func resendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("resend email verification")
+	id, ok := currentUserId(r)
+	if !ok {
+		http.Error(w, "the admin has no email to verify", http.StatusBadRequest)
+		return
+	}
+	if !smtpEnabled() {
+		http.Error(w, "no SMTP server is configured, emails can not be sent", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var user User
+	err := usersCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "No author found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+	switch {
+	case user.Email == "":
+		http.Error(w, "the author has no email to verify", http.StatusBadRequest)
+		return
+	case user.EmailVerified:
+		http.Error(w, "the email is already verified", http.StatusConflict)
+		return
+	}
+	sendEmailVerification(user)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "verification email sent"})
+}
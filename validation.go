@@ -0,0 +1,721 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// most points a rating scale can have, enough for 0 to 10
+const maxRatingPoints = 11
+
+// one problem found while validating a request body
+type ValidationError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// reply with every validation problem at once
+func writeValidationErrors(w http.ResponseWriter, errs []ValidationError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(errs)
+}
+
+// size guard keeping survey documents far below the 16MB document limit, returns the problem or ""
+func checkSurveyLimits(survey Survey) string {
+	if len(survey.Questions) > config.MaxQuestions {
+		return fmt.Sprintf("a survey can have at most %d questions, got %d", config.MaxQuestions, len(survey.Questions))
+	}
+	for i, q := range survey.Questions {
+		if len(q.Answers) > config.MaxAnswers {
+			return fmt.Sprintf("question %d can have at most %d answers, got %d", i+1, config.MaxAnswers, len(q.Answers))
+		}
+	}
+	return ""
+}
+
+// collect every problem of a survey, partial is set for updates where an empty title means unchanged
+func validateSurvey(survey Survey, partial bool) []ValidationError {
+	return validateSurveyFor(survey, partial, nil)
+}
+
+// validate an update like validateSurvey, stored are the questions as they are saved. rules added after a
+// question was created, like the odd number of Likert points, only apply once the question is changed
+func validateSurveyFor(survey Survey, partial bool, stored []Question) []ValidationError {
+	errs := []ValidationError{}
+	if !partial && survey.Title == "" {
+		errs = append(errs, ValidationError{"title", "Title is required, please make sure the title field is filled"})
+	}
+	if !partial && config.RequireQuestionsOnCreate && len(survey.Questions) == 0 {
+		errs = append(errs, ValidationError{"questions", "a survey should have at least 1 question"})
+	}
+	if survey.ExpiresAt != nil && !survey.ExpiresAt.After(time.Now()) {
+		errs = append(errs, ValidationError{"expires_at", "expires_at should be in the future"})
+	}
+	if survey.MaxResponses != nil && *survey.MaxResponses < 0 {
+		errs = append(errs, ValidationError{"max_responses", "max_responses should not be negative"})
+	}
+	if survey.EditWindowMinutes != nil && (*survey.EditWindowMinutes < 0 || *survey.EditWindowMinutes > maxEditWindowMinutes) {
+		errs = append(errs, ValidationError{"edit_window_minutes", fmt.Sprintf("edit_window_minutes should be from 0 to %d", maxEditWindowMinutes)})
+	}
+	if survey.requiresCaptcha() && !captchaEnabled() {
+		errs = append(errs, ValidationError{"require_captcha", "no captcha provider is configured, set CAPTCHA_PROVIDER and CAPTCHA_SECRET first"})
+	}
+	if survey.MaxSubmissionsPerMinute != nil && (*survey.MaxSubmissionsPerMinute < 0 || *survey.MaxSubmissionsPerMinute > maxSubmissionsPerMinute) {
+		errs = append(errs, ValidationError{"max_submissions_per_minute", fmt.Sprintf("max_submissions_per_minute should be from 0 to %d", maxSubmissionsPerMinute)})
+	}
+	errs = append(errs, validateBotDetection(survey.BotDetection)...)
+	errs = append(errs, validateNotifications(survey.Notifications)...)
+	errs = append(errs, validateScreens(survey)...)
+	errs = append(errs, validateTheme(survey.Theme)...)
+	if survey.Language != "" && !languagePattern.MatchString(survey.Language) {
+		errs = append(errs, ValidationError{"language", "language should be a language code like en or pt-BR"})
+	}
+	// translations are managed through their own endpoints once the survey exists
+	if !partial {
+		for _, lang := range slices.Sorted(maps.Keys(survey.Translations)) {
+			t := survey.Translations[lang]
+			if !languagePattern.MatchString(lang) {
+				errs = append(errs, ValidationError{"translations", fmt.Sprintf("%q is not a language code like fr or pt-BR", lang)})
+				continue
+			}
+			for _, e := range validateTranslation(survey, t) {
+				errs = append(errs, ValidationError{"translations." + lang + "." + e.Field, e.Message})
+			}
+		}
+	}
+	// ids are generated for questions without one, supplied ids must not collide
+	seenIds := make(map[bson.ObjectID]bool, len(survey.Questions))
+	for i, q := range survey.Questions {
+		field := fmt.Sprintf("questions[%d]", i)
+		if !q.Id.IsZero() {
+			if seenIds[q.Id] {
+				errs = append(errs, ValidationError{field + ".id", fmt.Sprintf("Duplicate question id %s", q.Id.Hex())})
+			}
+			seenIds[q.Id] = true
+		}
+		if q.QuestionTitle == "" {
+			errs = append(errs, ValidationError{field + ".question_title", "Question title is required"})
+		}
+		if q.QuestionType == "" {
+			errs = append(errs, ValidationError{field + ".question_type", "Question type is required"})
+		}
+		var storedQuestion *Question
+		if j := slices.IndexFunc(stored, func(s Question) bool { return !q.Id.IsZero() && s.Id == q.Id }); j >= 0 {
+			storedQuestion = &stored[j]
+		}
+		errs = append(errs, validateQuestionType(field, q, storedQuestion)...)
+		if q.QuestionType == "Likert Scale" {
+			errs = append(errs, validateLikertScale(field, q)...)
+		}
+		errs = append(errs, validateSelections(field, q)...)
+		errs = append(errs, validateRatingScale(field, q)...)
+		errs = append(errs, validateMatrixRows(field, q)...)
+		errs = append(errs, validateDateRange(field, q)...)
+		errs = append(errs, validateNumberRange(field, q)...)
+		errs = append(errs, validateFileLimits(field, q)...)
+		errs = append(errs, validateOtherOption(field, q)...)
+		errs = append(errs, validateAnswerShuffle(field, q)...)
+		errs = append(errs, validatePiping(field, i, survey.Questions)...)
+		errs = append(errs, validateAnswerOptions(field+".answers", q.Answers)...)
+	}
+	errs = append(errs, validateDisplayRules(survey.Questions)...)
+	errs = append(errs, validateSections(survey)...)
+	return errs
+}
+
+// longest welcome or thank you message
+const maxMessageLength = 10000
+
+// welcome and thank you messages are limited in length, respondents can only be redirected to web pages
+func validateScreens(survey Survey) []ValidationError {
+	var errs []ValidationError
+	if survey.WelcomeMessage != nil && utf8.RuneCountInString(*survey.WelcomeMessage) > maxMessageLength {
+		errs = append(errs, ValidationError{"welcome_message", fmt.Sprintf("welcome_message should be at most %d characters", maxMessageLength)})
+	}
+	if survey.ThankYouMessage != nil && utf8.RuneCountInString(*survey.ThankYouMessage) > maxMessageLength {
+		errs = append(errs, ValidationError{"thank_you_message", fmt.Sprintf("thank_you_message should be at most %d characters", maxMessageLength)})
+	}
+	if survey.CompletionRedirectURL != nil && *survey.CompletionRedirectURL != "" {
+		u, err := url.Parse(*survey.CompletionRedirectURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, ValidationError{"completion_redirect_url", "completion_redirect_url should be an http or https URL like https://example.com/thanks"})
+		}
+	}
+	return errs
+}
+
+// reject empty options and options repeated with different case or spacing, they would break tallies
+func validateAnswerOptions(field string, a []string) []ValidationError {
+	var errs []ValidationError
+	seen := make(map[string]bool, len(a))
+	for i, answer := range a {
+		key := strings.ToLower(strings.TrimSpace(answer))
+		if key == "" {
+			errs = append(errs, ValidationError{fmt.Sprintf("%s[%d]", field, i), "Answer option must not be empty"})
+			continue
+		}
+		if seen[key] {
+			errs = append(errs, ValidationError{fmt.Sprintf("%s[%d]", field, i), fmt.Sprintf("Duplicate answer option %q", answer)})
+		}
+		seen[key] = true
+	}
+	return errs
+}
+
+// ratings are whole numbers between scale_min and scale_max, only Rating questions have a scale.
+// NPS questions always rate from 0 to 10
+func validateRatingScale(field string, q Question) []ValidationError {
+	if q.QuestionType == "NPS" {
+		if q.ScaleMin != 0 || q.ScaleMax != 0 {
+			return []ValidationError{{field, "NPS Questions always rate from 0 to 10, scale_min and scale_max should be left out"}}
+		}
+		return nil
+	}
+	if q.QuestionType != "Rating" {
+		if q.ScaleMin != 0 || q.ScaleMax != 0 {
+			return []ValidationError{{field, "only Rating Questions have scale_min and scale_max"}}
+		}
+		return nil
+	}
+	var errs []ValidationError
+	if q.ScaleMin < 0 {
+		errs = append(errs, ValidationError{field + ".scale_min", "scale_min should not be negative"})
+	}
+	if q.ScaleMax != 0 && (q.ScaleMax <= q.ScaleMin || q.ScaleMax-q.ScaleMin > maxRatingPoints-1) {
+		errs = append(errs, ValidationError{field + ".scale_max", fmt.Sprintf("scale_max should be above scale_min, with at most %d points on the scale", maxRatingPoints)})
+	}
+	if q.ScaleMax == 0 && q.ScaleMin != 0 {
+		errs = append(errs, ValidationError{field + ".scale_max", "scale_max is required when scale_min is set"})
+	}
+	return errs
+}
+
+// rows only belong to Matrix questions, which need at least one, titled uniquely
+func validateMatrixRows(field string, q Question) []ValidationError {
+	if q.QuestionType != "Matrix" {
+		if len(q.Rows) > 0 {
+			return []ValidationError{{field + ".rows", "only Matrix Questions have rows"}}
+		}
+		return nil
+	}
+	if len(q.Rows) == 0 {
+		return []ValidationError{{field + ".rows", "Matrix Question should have at least 1 row"}}
+	}
+	var errs []ValidationError
+	seenTitles := make(map[string]bool, len(q.Rows))
+	seenIds := make(map[bson.ObjectID]bool, len(q.Rows))
+	for i, row := range q.Rows {
+		rowField := fmt.Sprintf("%s.rows[%d]", field, i)
+		key := strings.ToLower(strings.TrimSpace(row.Title))
+		if key == "" {
+			errs = append(errs, ValidationError{rowField + ".title", "Row title is required"})
+		} else if seenTitles[key] {
+			errs = append(errs, ValidationError{rowField + ".title", fmt.Sprintf("Duplicate row %q", row.Title)})
+		}
+		seenTitles[key] = true
+		if !row.Id.IsZero() {
+			if seenIds[row.Id] {
+				errs = append(errs, ValidationError{rowField + ".id", fmt.Sprintf("Duplicate row id %s", row.Id.Hex())})
+			}
+			seenIds[row.Id] = true
+		}
+	}
+	return errs
+}
+
+// min_date and max_date only apply to Date questions and must be dates in order
+func validateDateRange(field string, q Question) []ValidationError {
+	if q.QuestionType != "Date" {
+		if q.MinDate != "" || q.MaxDate != "" {
+			return []ValidationError{{field, "only Date Questions have min_date and max_date"}}
+		}
+		return nil
+	}
+	var errs []ValidationError
+	valid := true
+	for _, bound := range []struct{ name, value string }{{"min_date", q.MinDate}, {"max_date", q.MaxDate}} {
+		if bound.value == "" {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, bound.value); err != nil {
+			errs = append(errs, ValidationError{field + "." + bound.name, bound.name + " should be a date like 2006-01-02"})
+			valid = false
+		}
+	}
+	if valid && q.MinDate != "" && q.MaxDate != "" && q.MaxDate < q.MinDate {
+		errs = append(errs, ValidationError{field + ".max_date", "max_date should not be before min_date"})
+	}
+	return errs
+}
+
+// min_value, max_value and step only apply to Number questions, the range must hold at least one number
+func validateNumberRange(field string, q Question) []ValidationError {
+	if q.QuestionType != "Number" {
+		if q.MinValue != nil || q.MaxValue != nil || q.Step != 0 {
+			return []ValidationError{{field, "only Number Questions have min_value, max_value and step"}}
+		}
+		return nil
+	}
+	var errs []ValidationError
+	if q.MinValue != nil && q.MaxValue != nil && *q.MaxValue < *q.MinValue {
+		errs = append(errs, ValidationError{field + ".max_value", "max_value should not be less than min_value"})
+	}
+	if q.Step < 0 {
+		errs = append(errs, ValidationError{field + ".step", "step should be positive, or 0 for any number"})
+	}
+	return errs
+}
+
+// max_file_size and allowed_types only apply to File Upload questions
+func validateFileLimits(field string, q Question) []ValidationError {
+	if q.QuestionType != "File Upload" {
+		if q.MaxFileSize != 0 || len(q.AllowedTypes) > 0 {
+			return []ValidationError{{field, "only File Upload Questions have max_file_size and allowed_types"}}
+		}
+		return nil
+	}
+	var errs []ValidationError
+	if q.MaxFileSize < 0 || q.MaxFileSize > maxUploadSize {
+		errs = append(errs, ValidationError{field + ".max_file_size", fmt.Sprintf("max_file_size should be between 1 and %d bytes, or 0 for the default", maxUploadSize)})
+	}
+	for i, t := range q.AllowedTypes {
+		family, subtype, ok := strings.Cut(t, "/")
+		if !ok || family == "" || subtype == "" || strings.ContainsAny(t, " ;,") {
+			errs = append(errs, ValidationError{fmt.Sprintf("%s.allowed_types[%d]", field, i), fmt.Sprintf("%q is not a MIME type like application/pdf or image/*", t)})
+		}
+	}
+	return errs
+}
+
+// the other option of a Multiple Choice question must be one of its answers
+func validateOtherOption(field string, q Question) []ValidationError {
+	if q.OtherOption == "" {
+		return nil
+	}
+	if q.QuestionType != "Multiple Choice" {
+		return []ValidationError{{field + ".other_option", "only Multiple Choice Questions have an other_option"}}
+	}
+	if !slices.Contains(q.Answers, q.OtherOption) {
+		return []ValidationError{{field + ".other_option", fmt.Sprintf("other_option %q should be one of the answers", q.OtherOption)}}
+	}
+	return nil
+}
+
+// only choice questions shuffle their answers, pinned answers must be answers of the question
+func validateAnswerShuffle(field string, q Question) []ValidationError {
+	if q.ShuffleAnswers && !q.canShuffleAnswers() {
+		return []ValidationError{{field + ".shuffle_answers", "only Multiple Choice, Checkbox and Ranking Questions can shuffle their answers"}}
+	}
+	if len(q.PinnedAnswers) > 0 && !q.ShuffleAnswers {
+		return []ValidationError{{field + ".pinned_answers", "pinned_answers only apply with shuffle_answers"}}
+	}
+	var errs []ValidationError
+	for i, answer := range q.PinnedAnswers {
+		if !slices.Contains(q.Answers, answer) {
+			errs = append(errs, ValidationError{fmt.Sprintf("%s.pinned_answers[%d]", field, i), fmt.Sprintf("pinned answer %q should be one of the answers", answer)})
+		} else if slices.Index(q.PinnedAnswers, answer) < i {
+			errs = append(errs, ValidationError{fmt.Sprintf("%s.pinned_answers[%d]", field, i), fmt.Sprintf("answer %q is pinned twice", answer)})
+		}
+	}
+	return errs
+}
+
+// selection limits only apply to Checkbox questions and must be reachable with the question's answers
+func validateSelections(field string, q Question) []ValidationError {
+	if q.QuestionType != "Checkbox" {
+		if q.MinSelections != 0 || q.MaxSelections != 0 {
+			return []ValidationError{{field, "only Checkbox Questions have min_selections and max_selections"}}
+		}
+		return nil
+	}
+	var errs []ValidationError
+	if q.MinSelections < 0 || q.MinSelections > len(q.Answers) {
+		errs = append(errs, ValidationError{field + ".min_selections", fmt.Sprintf("min_selections should be between 0 and the number of answers (%d)", len(q.Answers))})
+	}
+	if q.MaxSelections < 0 || q.MaxSelections > len(q.Answers) {
+		errs = append(errs, ValidationError{field + ".max_selections", fmt.Sprintf("max_selections should be between 0 and the number of answers (%d)", len(q.Answers))})
+	} else if q.MaxSelections > 0 && q.MaxSelections < q.MinSelections {
+		errs = append(errs, ValidationError{field + ".max_selections", "max_selections should not be less than min_selections"})
+	}
+	return errs
+}
+
+// collect every problem of the answers of one submission to a survey with the given questions
+func validateResponses(surveyQuestions []Question, inputs []ResponseInput) []ValidationError {
+	return validateResponsesFor(surveyQuestions, inputs, nil)
+}
+
+// validate answers like validateResponses, only requiring the questions in scope, e.g. the pages
+// answered so far. a nil scope requires every question
+func validateResponsesFor(surveyQuestions []Question, inputs []ResponseInput, scope map[bson.ObjectID]bool) []ValidationError {
+	errs := []ValidationError{}
+	questions := make(map[bson.ObjectID]Question, len(surveyQuestions))
+	for _, q := range surveyQuestions {
+		questions[q.Id] = q
+	}
+	answered := make(map[answerKey]bool, len(inputs))
+	visible := visibleQuestions(surveyQuestions, inputs)
+	for i, input := range inputs {
+		field := fmt.Sprintf("responses[%d]", i)
+		if input.QuestionId.IsZero() {
+			errs = append(errs, ValidationError{field + ".question_id", "question_id is required"})
+			continue
+		}
+		q, ok := questions[input.QuestionId]
+		if !ok {
+			errs = append(errs, ValidationError{field + ".question_id", "question " + input.QuestionId.Hex() + " is not part of the survey"})
+			continue
+		}
+		if !visible[q.Id] {
+			errs = append(errs, ValidationError{field + ".question_id", fmt.Sprintf("question %q is hidden by its display rules and must not be answered", q.QuestionTitle)})
+			continue
+		}
+		if input.ResponseText == "" && input.Value == nil {
+			errs = append(errs, ValidationError{field + ".response_text", "response_text or value is required"})
+			continue
+		}
+		key := answerKey{q.Id, input.RowId}
+		if msg := validateResponseShape(q, input, answered[key]); msg != "" {
+			errs = append(errs, ValidationError{field + ".response_text", msg})
+			continue
+		}
+		answered[key] = true
+	}
+	for i, q := range surveyQuestions {
+		// hidden questions can not be answered, even required ones
+		if !q.Required || !visible[q.Id] || (scope != nil && !scope[q.Id]) {
+			continue
+		}
+		if q.QuestionType != "Matrix" {
+			if !answered[answerKey{QuestionId: q.Id}] {
+				errs = append(errs, ValidationError{fmt.Sprintf("questions[%d]", i), fmt.Sprintf("question %q (%s) is required", q.QuestionTitle, q.Id.Hex())})
+			}
+			continue
+		}
+		// every row of a required Matrix question must be answered
+		for j, row := range q.Rows {
+			if !answered[answerKey{q.Id, row.Id}] {
+				errs = append(errs, ValidationError{fmt.Sprintf("questions[%d].rows[%d]", i, j), fmt.Sprintf("row %q (%s) of question %q is required", row.Title, row.Id.Hex(), q.QuestionTitle)})
+			}
+		}
+	}
+	return errs
+}
+
+// check a submitted answer has the shape its question type accepts, returns the problem or ""
+func validateResponseShape(q Question, input ResponseInput, alreadyAnswered bool) string {
+	if alreadyAnswered {
+		switch q.QuestionType {
+		case "Matrix":
+			return fmt.Sprintf("row %q of question %q is answered more than once", q.rowTitle(input.RowId), q.QuestionTitle)
+		case "Multiple Choice", "Likert Scale", "Rating", "NPS":
+			return fmt.Sprintf("question %q accepts only one answer", q.QuestionTitle)
+		default:
+			return fmt.Sprintf("question %q is answered more than once", q.QuestionTitle)
+		}
+	}
+	if _, _, err := responseValue(q, input); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// typed value and text of a submitted answer, taken from value or, without one, from response_text:
+//   - Multiple Choice: the chosen option (string), other_text specifies the question's other_option and only it
+//   - Matrix: the option chosen for the row given by row_id (string), every row is a response of its own
+//   - Likert Scale: the score of the chosen option (number), the option or its score can be submitted
+//   - Rating and NPS: the rating (number), submitted as number or text
+//   - Checkbox: the chosen options (string array) in the order of the question, a single option can be submitted as text
+//   - Ranking: every option (string array) from first to last, submitted as array or as text separated by ";"
+//   - Date: the date or time (time), submitted as 2006-01-02 or RFC3339, within min_date and max_date
+//   - Number: the number (number), submitted as number or text, within min_value and max_value and on a step
+//   - File Upload: the id of the uploaded file (ObjectID), submitted as text
+//   - Time: the time of day (string, 15:04 or 15:04:05), submitted as 15:04 or 15:04:05
+//   - Textbox and other types: the text (non-empty string)
+//
+// the text is what aggregations group by, for choices it is always the option itself
+func responseValue(q Question, input ResponseInput) (any, string, error) {
+	raw := input.Value
+	if raw == nil {
+		raw = input.ResponseText
+	}
+	if q.QuestionType != "Matrix" && !input.RowId.IsZero() {
+		return nil, "", fmt.Errorf("question %q has no rows, row_id should be left out", q.QuestionTitle)
+	}
+	otherText := strings.TrimSpace(input.OtherText)
+	if q.OtherOption == "" && otherText != "" {
+		return nil, "", fmt.Errorf("question %q has no other option, other_text should be left out", q.QuestionTitle)
+	}
+	switch q.QuestionType {
+	case "Matrix":
+		if input.RowId.IsZero() {
+			return nil, "", fmt.Errorf("question %q is a Matrix question, row_id is required", q.QuestionTitle)
+		}
+		if q.rowTitle(input.RowId) == "" {
+			return nil, "", fmt.Errorf("row %s is not a row of question %q", input.RowId.Hex(), q.QuestionTitle)
+		}
+		if s, ok := raw.(string); ok && slices.Contains(q.Answers, s) {
+			return s, s, nil
+		}
+		return nil, "", fmt.Errorf("%s is not an option of question %q", jsonValue(raw), q.QuestionTitle)
+	case "Multiple Choice":
+		if s, ok := raw.(string); ok && slices.Contains(q.Answers, s) {
+			if s == q.OtherOption && otherText == "" {
+				return nil, "", fmt.Errorf("question %q asks to specify %q in other_text", q.QuestionTitle, s)
+			}
+			if s != q.OtherOption && otherText != "" {
+				return nil, "", fmt.Errorf("other_text of question %q is only for %q", q.QuestionTitle, q.OtherOption)
+			}
+			return s, s, nil
+		}
+		return nil, "", fmt.Errorf("%s is not an option of question %q", jsonValue(raw), q.QuestionTitle)
+	case "Likert Scale":
+		scores := q.likertScores()
+		switch v := raw.(type) {
+		case string:
+			if i := slices.Index(q.Answers, v); i >= 0 {
+				return scores[i], v, nil
+			}
+		case float64:
+			if i := slices.Index(scores, v); i >= 0 {
+				return v, q.Answers[i], nil
+			}
+		}
+		return nil, "", fmt.Errorf("%s is not an option of question %q", jsonValue(raw), q.QuestionTitle)
+	case "Checkbox":
+		return checkboxValue(q, raw)
+	case "Ranking":
+		return rankingValue(q, raw)
+	case "Rating", "NPS":
+		return ratingValue(q, raw)
+	case "Date":
+		return dateValue(q, raw)
+	case "Number":
+		return numberValue(q, raw)
+	case "File Upload":
+		if s, ok := raw.(string); ok {
+			if fileId, err := bson.ObjectIDFromHex(s); err == nil {
+				return fileId, s, nil
+			}
+		}
+		return nil, "", fmt.Errorf("question %q expects the file_id of an uploaded file, got %s", q.QuestionTitle, jsonValue(raw))
+	case "Time":
+		if s, ok := raw.(string); ok {
+			for _, layout := range []string{"15:04", time.TimeOnly} {
+				if t, err := time.Parse(layout, s); err == nil {
+					// seconds are only kept when given, both forms sort the same as text
+					return t.Format(layout), t.Format(layout), nil
+				}
+			}
+		}
+		return nil, "", fmt.Errorf("question %q expects a time of day (15:04 or 15:04:05), got %s", q.QuestionTitle, jsonValue(raw))
+	default:
+		if s, ok := raw.(string); ok && s != "" {
+			return s, s, nil
+		}
+		return nil, "", fmt.Errorf("question %q expects text, got %s", q.QuestionTitle, jsonValue(raw))
+	}
+}
+
+// chosen options of a Checkbox question, checked against its selection limits
+func checkboxValue(q Question, raw any) (any, string, error) {
+	var chosen []any
+	switch v := raw.(type) {
+	case []any:
+		chosen = v
+	case string:
+		chosen = []any{v}
+	default:
+		return nil, "", fmt.Errorf("question %q expects an array of options, got %s", q.QuestionTitle, jsonValue(raw))
+	}
+	picked := make(map[string]bool, len(chosen))
+	for _, c := range chosen {
+		s, ok := c.(string)
+		if !ok || !slices.Contains(q.Answers, s) {
+			return nil, "", fmt.Errorf("%s is not an option of question %q", jsonValue(c), q.QuestionTitle)
+		}
+		if picked[s] {
+			return nil, "", fmt.Errorf("%q is chosen more than once for question %q", s, q.QuestionTitle)
+		}
+		picked[s] = true
+	}
+	least, most := max(q.MinSelections, 1), q.MaxSelections
+	if most == 0 {
+		most = len(q.Answers)
+	}
+	if len(picked) < least || len(picked) > most {
+		if least == most {
+			return nil, "", fmt.Errorf("question %q expects %d options, got %d", q.QuestionTitle, least, len(picked))
+		}
+		return nil, "", fmt.Errorf("question %q expects %d to %d options, got %d", q.QuestionTitle, least, most, len(picked))
+	}
+	options := []string{}
+	for _, answer := range q.Answers {
+		if picked[answer] {
+			options = append(options, answer)
+		}
+	}
+	return options, strings.Join(options, "; "), nil
+}
+
+// order given to the options of a Ranking question, which must rank every option exactly once
+func rankingValue(q Question, raw any) (any, string, error) {
+	var ranked []any
+	switch v := raw.(type) {
+	case []any:
+		ranked = v
+	case string:
+		for _, s := range strings.Split(v, ";") {
+			ranked = append(ranked, strings.TrimSpace(s))
+		}
+	default:
+		return nil, "", fmt.Errorf("question %q expects an array of its options in ranked order, got %s", q.QuestionTitle, jsonValue(raw))
+	}
+	order := make([]string, 0, len(ranked))
+	for _, r := range ranked {
+		s, ok := r.(string)
+		if !ok || !slices.Contains(q.Answers, s) {
+			return nil, "", fmt.Errorf("%s is not an option of question %q", jsonValue(r), q.QuestionTitle)
+		}
+		if slices.Contains(order, s) {
+			return nil, "", fmt.Errorf("%q is ranked more than once for question %q", s, q.QuestionTitle)
+		}
+		order = append(order, s)
+	}
+	if len(order) != len(q.Answers) {
+		return nil, "", fmt.Errorf("question %q expects all %d options to be ranked, got %d", q.QuestionTitle, len(q.Answers), len(order))
+	}
+	return order, strings.Join(order, "; "), nil
+}
+
+// date of a Date question, checked against its min_date and max_date. timestamps are compared by their UTC date
+func dateValue(q Question, raw any) (any, string, error) {
+	s, ok := raw.(string)
+	if !ok {
+		return nil, "", fmt.Errorf("question %q expects a date (2006-01-02) or an RFC3339 timestamp, got %s", q.QuestionTitle, jsonValue(raw))
+	}
+	t, isDate, err := parseTimeParam(s)
+	if err != nil {
+		return nil, "", fmt.Errorf("question %q expects a date (2006-01-02) or an RFC3339 timestamp, got %s", q.QuestionTitle, jsonValue(raw))
+	}
+	t = t.UTC()
+	day := t.Format(time.DateOnly)
+	if q.MinDate != "" && day < q.MinDate {
+		return nil, "", fmt.Errorf("question %q accepts dates from %s, got %s", q.QuestionTitle, q.MinDate, day)
+	}
+	if q.MaxDate != "" && day > q.MaxDate {
+		return nil, "", fmt.Errorf("question %q accepts dates until %s, got %s", q.QuestionTitle, q.MaxDate, day)
+	}
+	if isDate {
+		return t, day, nil
+	}
+	return t, t.Format(time.RFC3339), nil
+}
+
+// number answering a Number question, checked against its range and step
+func numberValue(q Question, raw any) (any, string, error) {
+	var n float64
+	switch v := raw.(type) {
+	case float64:
+		n = v
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("question %q expects a number, got %s", q.QuestionTitle, jsonValue(raw))
+		}
+		n = parsed
+	default:
+		return nil, "", fmt.Errorf("question %q expects a number, got %s", q.QuestionTitle, jsonValue(raw))
+	}
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return nil, "", fmt.Errorf("question %q expects a number, got %s", q.QuestionTitle, jsonValue(raw))
+	}
+	if q.MinValue != nil && n < *q.MinValue {
+		return nil, "", fmt.Errorf("question %q accepts numbers from %s, got %s", q.QuestionTitle, formatNumber(*q.MinValue), formatNumber(n))
+	}
+	if q.MaxValue != nil && n > *q.MaxValue {
+		return nil, "", fmt.Errorf("question %q accepts numbers up to %s, got %s", q.QuestionTitle, formatNumber(*q.MaxValue), formatNumber(n))
+	}
+	if q.Step > 0 {
+		base := 0.0
+		if q.MinValue != nil {
+			base = *q.MinValue
+		}
+		// allow for the rounding of decimal steps like 0.1
+		steps := (n - base) / q.Step
+		if math.Abs(steps-math.Round(steps)) > 1e-9 {
+			return nil, "", fmt.Errorf("question %q accepts numbers in steps of %s from %s, got %s", q.QuestionTitle, formatNumber(q.Step), formatNumber(base), formatNumber(n))
+		}
+	}
+	return n, formatNumber(n), nil
+}
+
+// shortest text of a number, without exponent
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// rating of a Rating question, a whole number of its scale given as number or text
+func ratingValue(q Question, raw any) (any, string, error) {
+	low, high := q.ratingScale()
+	var rating float64
+	switch v := raw.(type) {
+	case float64:
+		rating = v
+	case string:
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			rating = math.NaN()
+		} else {
+			rating = float64(n)
+		}
+	default:
+		rating = math.NaN()
+	}
+	if rating != math.Trunc(rating) || rating < float64(low) || rating > float64(high) {
+		return nil, "", fmt.Errorf("question %q expects a whole number from %d to %d, got %s", q.QuestionTitle, low, high, jsonValue(raw))
+	}
+	return rating, strconv.Itoa(int(rating)), nil
+}
+
+// v as it appeared in the request, for error messages
+func jsonValue(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// scores of a Likert scale are optional but must match the answers, the odd number of points is checked with the question type.
+// a numeric answer is mapped back to the option with its score, so scores must be distinct and in order
+func validateLikertScale(field string, q Question) []ValidationError {
+	var errs []ValidationError
+	if len(q.Scores) > 0 && len(q.Scores) != len(q.Answers) {
+		errs = append(errs, ValidationError{field + ".scores", "Likert Scale Question should have one score per answer"})
+	}
+	sorted := slices.Clone(q.Scores)
+	slices.Sort(sorted)
+	if len(slices.Compact(sorted)) != len(q.Scores) {
+		errs = append(errs, ValidationError{field + ".scores", "Likert Scale scores must be unique"})
+		return errs
+	}
+	increasing := slices.Equal(q.Scores, sorted)
+	slices.Reverse(sorted)
+	if !increasing && !slices.Equal(q.Scores, sorted) {
+		errs = append(errs, ValidationError{field + ".scores", "Likert Scale scores must increase or decrease from one answer to the next"})
+	}
+	return errs
+}
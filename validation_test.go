@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// fields of the validation errors, in order
+func errorFields(errs []ValidationError) []string {
+	fields := []string{}
+	for _, err := range errs {
+		fields = append(fields, err.Field)
+	}
+	return fields
+}
+
+func hasError(errs []ValidationError, field string) bool {
+	for _, err := range errs {
+		if err.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRequireQuestionsOnCreate(t *testing.T) {
+	keepConfig(t)
+	survey := Survey{Title: "No questions"}
+
+	config.RequireQuestionsOnCreate = false
+	if errs := validateSurvey(survey, false); hasError(errs, "questions") {
+		t.Errorf("questions are required with the rule off: %v", errs)
+	}
+
+	config.RequireQuestionsOnCreate = true
+	if errs := validateSurvey(survey, false); !hasError(errs, "questions") {
+		t.Errorf("a survey without questions was accepted with the rule on: %v", errorFields(errs))
+	}
+	// updates leaving out questions keep the ones stored
+	if errs := validateSurvey(survey, true); hasError(errs, "questions") {
+		t.Errorf("an update without questions was rejected: %v", errs)
+	}
+}
+
+func TestCreateSurveyReportsEveryError(t *testing.T) {
+	draft := map[string]any{"questions": []map[string]any{{"question_type": "Textbox"}}}
+	w := serve(createSurvey, "POST", "/surveys", draft, nil)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status %d, want 422: %s", w.Code, w.Body)
+	}
+	errs := decodeBody[[]ValidationError](t, w)
+	if !hasError(errs, "title") || !hasError(errs, "questions[0].question_title") {
+		t.Errorf("errors = %v, want both the survey and the question title", errorFields(errs))
+	}
+}
+
+func TestSurveyLimits(t *testing.T) {
+	keepConfig(t)
+	config.MaxQuestions, config.MaxAnswers = 3, 2
+	draft := func(questions, answers int) map[string]any {
+		qs := []map[string]any{}
+		for i := range questions {
+			options := []string{}
+			for j := range answers {
+				options = append(options, fmt.Sprintf("Option %d", j+1))
+			}
+			qs = append(qs, map[string]any{"question_title": fmt.Sprintf("Question %d", i+1), "question_type": "Multiple Choice", "answers": options})
+		}
+		return map[string]any{"title": "Limits", "questions": qs}
+	}
+	id := bson.NewObjectID().Hex()
+
+	for _, tc := range []struct {
+		name               string
+		questions, answers int
+		want               int
+	}{
+		{"at both caps", 3, 2, http.StatusOK},
+		{"one question over", 4, 2, http.StatusBadRequest},
+		{"one answer over", 3, 3, http.StatusBadRequest},
+	} {
+		if w := serve(createSurvey, "POST", "/surveys?validate=true", draft(tc.questions, tc.answers), nil); w.Code != tc.want {
+			t.Errorf("create %s: status %d, want %d: %s", tc.name, w.Code, tc.want, w.Body)
+		}
+		if tc.want == http.StatusBadRequest {
+			if w := serve(updateSurvey, "PUT", "/surveys/"+id, draft(tc.questions, tc.answers), map[string]string{"survey_id": id}); w.Code != tc.want {
+				t.Errorf("update %s: status %d, want %d", tc.name, w.Code, tc.want)
+			}
+		}
+	}
+}
+
+func TestValidateResponseShapes(t *testing.T) {
+	low, high := 0.0, 10.0
+	questions := []Question{
+		{QuestionTitle: "Role", QuestionType: "Multiple Choice", Answers: []string{"Dev", "Ops"}},
+		{QuestionTitle: "Tools", QuestionType: "Checkbox", Answers: []string{"Go", "Rust", "Zig"}},
+		{QuestionTitle: "Agree", QuestionType: "Likert Scale", Answers: []string{"No", "Maybe", "Yes"}},
+		{QuestionTitle: "Stars", QuestionType: "Rating"},
+		{QuestionTitle: "Order", QuestionType: "Ranking", Answers: []string{"A", "B"}},
+		{QuestionTitle: "Age", QuestionType: "Number", MinValue: &low, MaxValue: &high},
+		{QuestionTitle: "Comments", QuestionType: "Textbox"},
+	}
+	for i := range questions {
+		questions[i].Id = bson.NewObjectID()
+	}
+	role, tools, agree, stars, order, age, comments := questions[0].Id, questions[1].Id, questions[2].Id, questions[3].Id, questions[4].Id, questions[5].Id, questions[6].Id
+
+	for _, tc := range []struct {
+		name   string
+		inputs []ResponseInput
+		valid  bool
+	}{
+		{"one option", []ResponseInput{{QuestionId: role, ResponseText: "Dev"}}, true},
+		{"unknown option", []ResponseInput{{QuestionId: role, ResponseText: "Design"}}, false},
+		{"two options of a single choice", []ResponseInput{{QuestionId: role, ResponseText: "Dev"}, {QuestionId: role, ResponseText: "Ops"}}, false},
+		{"options array of a single choice", []ResponseInput{{QuestionId: role, Value: []any{"Dev", "Ops"}}}, false},
+		{"several checkbox options", []ResponseInput{{QuestionId: tools, Value: []any{"Go", "Zig"}}}, true},
+		{"unknown checkbox option", []ResponseInput{{QuestionId: tools, Value: []any{"Go", "C"}}}, false},
+		{"likert option", []ResponseInput{{QuestionId: agree, ResponseText: "Maybe"}}, true},
+		{"free text to likert", []ResponseInput{{QuestionId: agree, ResponseText: "Sort of"}}, false},
+		{"rating in scale", []ResponseInput{{QuestionId: stars, Value: 4.0}}, true},
+		{"rating off scale", []ResponseInput{{QuestionId: stars, Value: 6.0}}, false},
+		{"full ranking", []ResponseInput{{QuestionId: order, Value: []any{"B", "A"}}}, true},
+		{"partial ranking", []ResponseInput{{QuestionId: order, Value: []any{"B"}}}, false},
+		{"number in range", []ResponseInput{{QuestionId: age, Value: 7.0}}, true},
+		{"number out of range", []ResponseInput{{QuestionId: age, Value: 11.0}}, false},
+		{"text to a number", []ResponseInput{{QuestionId: age, ResponseText: "seven"}}, false},
+		{"free text", []ResponseInput{{QuestionId: comments, ResponseText: "Anything goes"}}, true},
+		{"number to a text question", []ResponseInput{{QuestionId: comments, Value: 5.0}}, false},
+		{"no text", []ResponseInput{{QuestionId: comments}}, false},
+	} {
+		errs := validateResponses(questions, tc.inputs)
+		if tc.valid && len(errs) > 0 {
+			t.Errorf("%s: rejected: %v", tc.name, errs)
+		}
+		if !tc.valid && len(errs) == 0 {
+			t.Errorf("%s: accepted", tc.name)
+		}
+	}
+}
+
+func TestRejectDuplicateAndEmptyOptions(t *testing.T) {
+	choice := func(answers ...string) Survey {
+		return Survey{Title: "Options", Questions: []Question{{QuestionTitle: "Role", QuestionType: "Multiple Choice", Answers: answers}}}
+	}
+
+	errs := validateSurvey(choice("Yes", " yes ", "No"), false)
+	if !hasError(errs, "questions[0].answers[1]") {
+		t.Errorf("a duplicate option differing in case and spacing was accepted: %v", errorFields(errs))
+	}
+	for _, err := range errs {
+		if err.Field == "questions[0].answers[1]" && !strings.Contains(err.Message, `" yes "`) {
+			t.Errorf("message %q does not name the duplicate", err.Message)
+		}
+	}
+	if errs := validateSurvey(choice("Yes", "", "No"), false); !hasError(errs, "questions[0].answers[1]") {
+		t.Errorf("an empty option was accepted: %v", errorFields(errs))
+	}
+	if errs := validateSurvey(choice("Yes", "  ", "No"), false); !hasError(errs, "questions[0].answers[1]") {
+		t.Errorf("a blank option was accepted: %v", errorFields(errs))
+	}
+	if errs := validateSurvey(choice("Yes", "No"), false); len(errs) > 0 {
+		t.Errorf("distinct options were rejected: %v", errs)
+	}
+
+}
+
+func TestRejectDuplicateQuestionIds(t *testing.T) {
+	id := bson.NewObjectID()
+	survey := Survey{Title: "Ids", Questions: []Question{
+		{Id: id, QuestionTitle: "Name", QuestionType: "Textbox"},
+		{Id: bson.NewObjectID(), QuestionTitle: "Role", QuestionType: "Textbox"},
+		{Id: id, QuestionTitle: "Team", QuestionType: "Textbox"},
+	}}
+	errs := validateSurvey(survey, false)
+	if !hasError(errs, "questions[2].id") || hasError(errs, "questions[0].id") {
+		t.Errorf("errors = %v, want the repeated id of the third question", errorFields(errs))
+	}
+
+	survey.Questions[2].Id = bson.NewObjectID()
+	if errs := validateSurvey(survey, false); len(errs) > 0 {
+		t.Errorf("distinct ids were rejected: %v", errs)
+	}
+}
+
+func TestOddLikertRuleOnlyForChangedScales(t *testing.T) {
+	even := Question{Id: bson.NewObjectID(), QuestionTitle: "Agree", QuestionType: "Likert Scale",
+		Answers: []string{"Strongly disagree", "Disagree", "Agree", "Strongly agree"}}
+	survey := Survey{Title: "Likert", Questions: []Question{even}}
+
+	if errs := validateSurvey(survey, false); !hasError(errs, "questions[0].answers") {
+		t.Errorf("a new even Likert scale was accepted: %v", errorFields(errs))
+	}
+	// surveys saved before the rule can still be updated
+	stored := []Question{even}
+	if errs := validateSurveyFor(survey, true, stored); len(errs) > 0 {
+		t.Errorf("an unchanged even Likert scale was rejected: %v", errs)
+	}
+	survey.Questions[0].QuestionTitle = "Do you agree?"
+	if errs := validateSurveyFor(survey, true, stored); len(errs) > 0 {
+		t.Errorf("renaming an even Likert question was rejected: %v", errs)
+	}
+	changed := survey
+	changed.Questions = []Question{even}
+	changed.Questions[0].Answers = []string{"No", "Rather not", "Rather", "Yes"}
+	if errs := validateSurveyFor(changed, true, stored); !hasError(errs, "questions[0].answers") {
+		t.Errorf("a changed even Likert scale was accepted: %v", errorFields(errs))
+	}
+	added := Survey{Questions: []Question{even, {Id: bson.NewObjectID(), QuestionTitle: "More", QuestionType: "Likert Scale", Answers: []string{"A", "B", "C", "D"}}}}
+	if errs := validateSurveyFor(added, true, stored); !hasError(errs, "questions[1].answers") || hasError(errs, "questions[0].answers") {
+		t.Errorf("errors = %v, want only the added even Likert scale", errorFields(errs))
+	}
+}
+
+func TestLikertScoresMustBeUniqueAndOrdered(t *testing.T) {
+	for _, c := range []struct {
+		scores []float64
+		valid  bool
+	}{
+		{nil, true},
+		{[]float64{1, 2, 3}, true},
+		{[]float64{2, 0, -2}, true},
+		{[]float64{1, 1, 2}, false},
+		{[]float64{1, 2, 1}, false},
+		{[]float64{1, 3, 2}, false},
+	} {
+		q := Question{QuestionTitle: "Agree", QuestionType: "Likert Scale", Answers: []string{"No", "Maybe", "Yes"}, Scores: c.scores}
+		errs := validateSurvey(Survey{Title: "Likert", Questions: []Question{q}}, false)
+		if hasError(errs, "questions[0].scores") == c.valid {
+			t.Errorf("scores %v: errors %v, want valid %t", c.scores, errorFields(errs), c.valid)
+		}
+	}
+}
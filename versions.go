@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// a survey as it was before it was replaced by the next version, see surveySnapshot
+type SurveyVersion struct {
+	Survey     `bson:",inline"` // the id is the one of the version, the version the one it had
+	SurveyId   bson.ObjectID    `json:"survey_id" bson:"survey_id"`
+	ReplacedAt time.Time        `json:"replaced_at" bson:"replaced_at"` // zero for the current version
+	Complete   bool             `json:"-" bson:"complete,omitempty"`    // unset on versions stored before whole surveys were, those only have a title, questions and sections
+}
+
+// fields kept by the survey itself rather than by its versions, a rollback leaves them alone
+var surveyBookkeeping = []string{"_id", "owner_id", "token", "created_at", "updated_at", "version", "status", "response_count", "deleted_at", "summary_sent_at"}
+
+// the version a survey is replaced with, without its bookkeeping
+func surveySnapshot(s Survey) SurveyVersion {
+	surveyId := s.Id
+	s.Id = bson.NewObjectID()
+	s.OwnerId = bson.ObjectID{}
+	s.Token = ""
+	s.CreatedAt, s.UpdatedAt = time.Time{}, time.Time{}
+	s.Status = ""
+	s.ResponseCount = 0
+	s.DeletedAt, s.SummarySentAt = nil, nil
+	return SurveyVersion{Survey: s, SurveyId: surveyId, ReplacedAt: time.Now(), Complete: true}
+}
+
+// the fields of a survey a rollback restores
+func surveyContent(s Survey) (bson.M, error) {
+	data, err := bson.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	var content bson.M
+	if err := bson.Unmarshal(data, &content); err != nil {
+		return nil, err
+	}
+	for _, key := range surveyBookkeeping {
+		delete(content, key)
+	}
+	return content, nil
+}
+
+type TitleChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type QuestionChange struct {
+	Id   bson.ObjectID `json:"id"`
+	From Question      `json:"from"`
+	To   Question      `json:"to"`
+}
+
+// changes between two versions of a survey, questions are matched by id
+type VersionDiff struct {
+	From    int              `json:"from"`
+	To      int              `json:"to"`
+	Title   *TitleChange     `json:"title,omitempty"` // left out when the title did not change
+	Added   []Question       `json:"added"`
+	Removed []Question       `json:"removed"`
+	Changed []QuestionChange `json:"changed"`
+}
+
+var surveyVersionsCollection *mongo.Collection
+
+// apply update to the survey matching filter and keep what it replaced in survey_versions,
+// returns the updated survey or mongo.ErrNoDocuments when nothing matched
+func updateSurveyWithHistory(ctx context.Context, filter bson.M, update bson.M) (Survey, error) {
+	var updated Survey
+	err := withTransaction(ctx, func(ctx context.Context) error {
+		var previous Survey
+		fOpt := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+		if err := surveysCollection.FindOneAndUpdate(ctx, filter, update, fOpt).Decode(&previous); err != nil {
+			return err
+		}
+		if _, err := surveyVersionsCollection.InsertOne(ctx, surveySnapshot(previous)); err != nil {
+			return err
+		}
+		return surveysCollection.FindOne(ctx, bson.M{"_id": previous.Id}).Decode(&updated)
+	})
+	if err == nil {
+		publishEvent(updated.Id, EventSurveyUpdated, updated)
+	}
+	return updated, err
+}
+
+// version of a survey, the current one comes from the survey itself
+func findSurveyVersion(ctx context.Context, surveyId bson.ObjectID, version int) (SurveyVersion, error) {
+	var current Survey
+	if err := surveysCollection.FindOne(ctx, bson.M{"_id": surveyId}).Decode(&current); err != nil {
+		return SurveyVersion{}, err
+	}
+	if current.Version == version {
+		return SurveyVersion{Survey: current, SurveyId: current.Id, Complete: true}, nil
+	}
+	var v SurveyVersion
+	err := surveyVersionsCollection.FindOne(ctx, bson.M{"survey_id": surveyId, "version": version}).Decode(&v)
+	return v, err
+}
+
+func questionEqual(a, b Question) bool {
+	return a.QuestionTitle == b.QuestionTitle &&
+		a.QuestionType == b.QuestionType &&
+		slices.Equal(a.Answers, b.Answers) &&
+		slices.Equal(a.Scores, b.Scores) &&
+		a.Required == b.Required &&
+		a.MinSelections == b.MinSelections &&
+		a.MaxSelections == b.MaxSelections &&
+		a.ScaleMin == b.ScaleMin &&
+		a.ScaleMax == b.ScaleMax &&
+		slices.Equal(a.Rows, b.Rows) &&
+		a.MinDate == b.MinDate &&
+		a.MaxDate == b.MaxDate &&
+		equalFloatPtr(a.MinValue, b.MinValue) &&
+		equalFloatPtr(a.MaxValue, b.MaxValue) &&
+		a.Step == b.Step &&
+		a.MaxFileSize == b.MaxFileSize &&
+		slices.Equal(a.AllowedTypes, b.AllowedTypes) &&
+		a.OtherOption == b.OtherOption &&
+		slices.Equal(a.ShowIf, b.ShowIf) &&
+		a.ShuffleAnswers == b.ShuffleAnswers &&
+		slices.Equal(a.PinnedAnswers, b.PinnedAnswers) &&
+		a.SectionId == b.SectionId
+}
+
+func equalFloatPtr(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func diffVersions(from, to SurveyVersion) VersionDiff {
+	diff := VersionDiff{
+		From:    from.Version,
+		To:      to.Version,
+		Added:   []Question{},
+		Removed: []Question{},
+		Changed: []QuestionChange{},
+	}
+	if from.Title != to.Title {
+		diff.Title = &TitleChange{From: from.Title, To: to.Title}
+	}
+	before := make(map[bson.ObjectID]Question, len(from.Questions))
+	for _, q := range from.Questions {
+		before[q.Id] = q
+	}
+	for _, q := range to.Questions {
+		old, ok := before[q.Id]
+		if !ok {
+			diff.Added = append(diff.Added, q)
+			continue
+		}
+		delete(before, q.Id)
+		if !questionEqual(old, q) {
+			diff.Changed = append(diff.Changed, QuestionChange{Id: q.Id, From: old, To: q})
+		}
+	}
+	for _, q := range from.Questions {
+		if _, ok := before[q.Id]; ok {
+			diff.Removed = append(diff.Removed, q)
+		}
+	}
+	return diff
+}
+
+// list the previous versions of a survey, newest first
+func getSurveyVersions(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get survey versions")
+	id, _ := bson.ObjectIDFromHex(mux.Vars(r)["survey_id"])
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	fOpt := options.Find().SetSort(bson.D{{Key: "version", Value: -1}})
+	cursor, err := surveyVersionsCollection.Find(ctx, bson.M{"survey_id": id}, fOpt)
+	if err != nil {
+		panic(err)
+	}
+	defer cursor.Close(ctx)
+	versions := []SurveyVersion{}
+	if err = cursor.All(ctx, &versions); err != nil {
+		log.Panic(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+// diff two versions of a survey given by the from and to query parameters
+func diffSurveyVersions(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("diff survey versions")
+	id, _ := bson.ObjectIDFromHex(mux.Vars(r)["survey_id"])
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil {
+		http.Error(w, "Invalid from version", http.StatusBadRequest)
+		return
+	}
+	to, err := strconv.Atoi(r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, "Invalid to version", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	versions := make([]SurveyVersion, 2)
+	for i, version := range []int{from, to} {
+		versions[i], err = findSurveyVersion(ctx, id, version)
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, fmt.Sprintf("No version %d found", version), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diffVersions(versions[0], versions[1]))
+}
+
+// restore a previous version, the rollback is a new version itself
+func rollbackSurvey(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("rollback survey")
+	queries := mux.Vars(r)
+	id, _ := bson.ObjectIDFromHex(queries["survey_id"])
+	version, err := strconv.Atoi(queries["version"])
+	if err != nil {
+		http.Error(w, "Invalid version", http.StatusBadRequest)
+		return
+	}
+
+	// the version the client has read, without one the version current when the rollback starts
+	var input struct {
+		Version *int `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var current Survey
+	err = surveysCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&current)
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "No survey found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+	expected := current.Version
+	if input.Version != nil {
+		expected = *input.Version
+	}
+	target, err := findSurveyVersion(ctx, id, version)
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, fmt.Sprintf("No version %d found", version), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	restore := bson.M{"title": target.Title, "questions": target.Questions, "sections": target.Sections}
+	unset := bson.M{}
+	if target.Complete {
+		if restore, err = surveyContent(target.Survey); err != nil {
+			panic(err)
+		}
+		// settings set since that version are removed again
+		present, err := surveyContent(current)
+		if err != nil {
+			panic(err)
+		}
+		for key := range present {
+			if _, ok := restore[key]; !ok {
+				unset[key] = ""
+			}
+		}
+	}
+	restore["updated_at"] = time.Now()
+	update := bson.M{"$set": restore, "$inc": bson.M{"version": 1}}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	// the same optimistic check as updates, a rollback must not clobber an edit it has not seen
+	filter := bson.M{"_id": id, "version": expected}
+	if expected == 0 {
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+	survey, err := updateSurveyWithHistory(ctx, filter, update)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, "Survey has been modified by someone else, please reload it and try again", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Failed to roll back survey", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(survey)
+}
@@ -0,0 +1,535 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	mathrand "math/rand/v2"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// events webhooks can subscribe to
+const (
+	EventResponseSubmitted = "response.submitted"
+	EventSurveyClosed      = "survey.closed"
+)
+
+var webhookEvents = []string{EventResponseSubmitted, EventSurveyClosed}
+
+// URL of a survey that is POSTed the events it subscribes to
+type Webhook struct {
+	Id        bson.ObjectID `json:"id" bson:"_id"`
+	SurveyId  bson.ObjectID `json:"survey_id" bson:"survey_id"`
+	URL       string        `json:"url" bson:"url"`
+	Events    []string      `json:"events" bson:"events"`
+	Secret    string        `json:"secret,omitempty" bson:"secret"` // key of the X-Webhook-Signature of deliveries, only returned when the webhook is created
+	CreatedAt time.Time     `json:"created_at" bson:"created_at"`
+}
+
+// body POSTed to webhooks
+type WebhookPayload struct {
+	Id        bson.ObjectID `json:"id"` // id of the event, the same for every webhook it is delivered to
+	Event     string        `json:"event"`
+	SurveyId  bson.ObjectID `json:"survey_id"`
+	CreatedAt time.Time     `json:"created_at"`
+	Data      any           `json:"data"`
+}
+
+// data of response.submitted events
+type SubmissionEvent struct {
+	UserId    bson.ObjectID `json:"user_id"`
+	Responses []any         `json:"responses"`
+}
+
+// data of survey.closed events
+type SurveyClosedEvent struct {
+	Title         string    `json:"title"`
+	ResponseCount int       `json:"response_count"`
+	ClosedAt      time.Time `json:"closed_at"`
+}
+
+var webhooksCollection *mongo.Collection
+
+// webhooks a survey can have at most
+const maxWebhooks = 10
+
+// delivery states of an event to one webhook
+const (
+	DeliveryPending   = "pending"   // waiting for its first attempt or a retry
+	DeliveryDelivered = "delivered" // the webhook answered with a 2xx status
+	DeliveryFailed    = "failed"    // every attempt failed, only redelivered on request
+)
+
+// an event to deliver to one webhook, kept so failed deliveries are retried and can be inspected
+type WebhookDelivery struct {
+	Id            bson.ObjectID   `json:"id" bson:"_id"`
+	WebhookId     bson.ObjectID   `json:"webhook_id" bson:"webhook_id"`
+	SurveyId      bson.ObjectID   `json:"survey_id" bson:"survey_id"`
+	EventId       bson.ObjectID   `json:"event_id" bson:"event_id"` // id of the WebhookPayload
+	Event         string          `json:"event" bson:"event"`
+	Payload       json.RawMessage `json:"payload" bson:"payload"` // body POSTed to the webhook
+	Status        string          `json:"status" bson:"status"`
+	Attempts      int             `json:"attempts" bson:"attempts"`
+	LastError     string          `json:"last_error,omitempty" bson:"last_error,omitempty"`           // why the last attempt failed
+	NextAttemptAt *time.Time      `json:"next_attempt_at,omitempty" bson:"next_attempt_at,omitempty"` // pending deliveries only
+	DeliveredAt   *time.Time      `json:"delivered_at,omitempty" bson:"delivered_at,omitempty"`
+	CreatedAt     time.Time       `json:"created_at" bson:"created_at"`
+}
+
+var webhookDeliveriesCollection *mongo.Collection
+
+// deliveries waiting for a worker, deliveries not fitting are picked up by the retry scheduler
+const webhookQueueSize = 1000
+
+var webhookQueue = make(chan WebhookDelivery, webhookQueueSize)
+
+// webhook URLs are given by survey editors, so requests only go to public addresses, checked once the
+// host is resolved so a name pointing inside the network is caught too. redirects are not followed, the
+// redirect response fails the delivery, and no proxy is used
+var webhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 5 * time.Second, Control: publicAddressOnly}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConnsPerHost: 2,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+var errPrivateAddress = errors.New("the webhook URL does not resolve to a public address")
+
+// dialer control refusing loopback, private, link-local, multicast and unspecified addresses
+func publicAddressOnly(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return errPrivateAddress
+	}
+	addr := addrPort.Addr().Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return errPrivateAddress
+	}
+	return nil
+}
+
+// a delivery taken by a worker is left to it this long before the retry scheduler takes it again,
+// longer than an attempt can take
+const webhookLease = 2 * time.Minute
+
+// wait before the first retry, doubled for every further one: 30s, 1m, 2m, 4m...
+const webhookRetryBase = 30 * time.Second
+
+// deliveries are kept this long, whatever their status
+const webhookDeliveryTTL = 30 * 24 * time.Hour
+
+// how often pending deliveries due for a retry are queued
+const webhookRetryInterval = 15 * time.Second
+
+// deliver queued events with n workers, and queue the deliveries due for a retry, until the process exits
+func startWebhookWorkers(n int) {
+	for range n {
+		go func() {
+			for d := range webhookQueue {
+				attemptDelivery(d)
+			}
+		}()
+	}
+	go func() {
+		ticker := time.NewTicker(webhookRetryInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			queueDueDeliveries()
+		}
+	}()
+}
+
+// hex encoded HMAC-SHA256 of body, sent as X-Webhook-Signature so consumers can check deliveries came from us
+func webhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func deliverWebhook(webhook Webhook, d WebhookDelivery) error {
+	req, err := http.NewRequest("POST", webhook.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", d.Event)
+	req.Header.Set("X-Webhook-Delivery", d.Id.Hex())
+	req.Header.Set("X-Webhook-Signature", webhookSignature(webhook.Secret, d.Payload))
+	res, err := webhookClient.Do(req)
+	if err != nil {
+		// the deliveries are shown to editors, network details stay in the log
+		log.Printf("webhook %s: %v", webhook.Id.Hex(), err)
+		switch {
+		case errors.Is(err, errPrivateAddress):
+			return errPrivateAddress
+		case errors.Is(err, context.DeadlineExceeded) || os.IsTimeout(err):
+			return errors.New("the webhook did not answer in time")
+		default:
+			return errors.New("the webhook could not be reached")
+		}
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", webhook.URL, res.Status)
+	}
+	return nil
+}
+
+// wait before retrying a delivery that failed attempts times, with up to 10% jitter so deliveries failing
+// together do not all retry at once
+func webhookBackoff(attempts int) time.Duration {
+	wait := webhookRetryBase << min(attempts-1, 16)
+	return wait + time.Duration(mathrand.Int64N(int64(wait/10)+1))
+}
+
+// make one attempt at a delivery and record its outcome, scheduling a retry while attempts are left
+func attemptDelivery(d WebhookDelivery) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var webhook Webhook
+	err := webhooksCollection.FindOne(ctx, bson.M{"_id": d.WebhookId}).Decode(&webhook)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		err = errors.New("the webhook was removed")
+		d.Attempts = config.WebhookMaxAttempts
+	} else if err != nil {
+		log.Println(err)
+		return // the lease runs out and the delivery is taken again
+	} else {
+		err = deliverWebhook(webhook, d)
+		d.Attempts++
+	}
+
+	now := time.Now()
+	set, unset := bson.M{"attempts": d.Attempts}, bson.M{}
+	switch {
+	case err == nil:
+		set["status"], set["delivered_at"] = DeliveryDelivered, now
+		unset["next_attempt_at"], unset["last_error"] = "", ""
+	case d.Attempts < config.WebhookMaxAttempts:
+		set["status"], set["last_error"], set["next_attempt_at"] = DeliveryPending, err.Error(), now.Add(webhookBackoff(d.Attempts))
+	default:
+		log.Printf("webhook %s: delivering %s failed %d times, giving up: %v", d.WebhookId.Hex(), d.Event, d.Attempts, err)
+		set["status"], set["last_error"] = DeliveryFailed, err.Error()
+		unset["next_attempt_at"] = ""
+	}
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	if _, err := webhookDeliveriesCollection.UpdateOne(ctx, bson.M{"_id": d.Id}, update); err != nil {
+		log.Println(err)
+	}
+}
+
+// take the pending deliveries due for an attempt and queue them, leaving them to the next run when the
+// queue is full
+func queueDueDeliveries() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for len(webhookQueue) < cap(webhookQueue) {
+		now := time.Now()
+		var d WebhookDelivery
+		err := webhookDeliveriesCollection.FindOneAndUpdate(ctx,
+			bson.M{"status": DeliveryPending, "next_attempt_at": bson.M{"$lte": now}},
+			bson.M{"$set": bson.M{"next_attempt_at": now.Add(webhookLease)}},
+			options.FindOneAndUpdate().SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}),
+		).Decode(&d)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return
+		}
+		if err != nil {
+			log.Println("queueing webhook deliveries failed:", err)
+			return
+		}
+		queueDelivery(d)
+	}
+}
+
+// hand a delivery to the workers, a delivery not fitting the queue is taken again once its lease runs out
+func queueDelivery(d WebhookDelivery) {
+	select {
+	case webhookQueue <- d:
+	default:
+		log.Printf("webhook %s: queue is full, %s is retried later", d.WebhookId.Hex(), d.Event)
+	}
+}
+
+// record an event of a survey for every webhook subscribed to it and queue the deliveries, without
+// waiting for them
+func notifyWebhooks(ctx context.Context, surveyId bson.ObjectID, event string, data any) {
+	cursor, err := webhooksCollection.Find(ctx, bson.M{"survey_id": surveyId, "events": event})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	var webhooks []Webhook
+	if err = cursor.All(ctx, &webhooks); err != nil {
+		log.Println(err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+	now := time.Now()
+	payload := WebhookPayload{bson.NewObjectID(), event, surveyId, now, data}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	lease := now.Add(webhookLease)
+	deliveries := make([]WebhookDelivery, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		deliveries = append(deliveries, WebhookDelivery{
+			Id:            bson.NewObjectID(),
+			WebhookId:     webhook.Id,
+			SurveyId:      surveyId,
+			EventId:       payload.Id,
+			Event:         event,
+			Payload:       body,
+			Status:        DeliveryPending,
+			NextAttemptAt: &lease,
+			CreatedAt:     now,
+		})
+	}
+	if _, err = webhookDeliveriesCollection.InsertMany(ctx, deliveries); err != nil {
+		log.Println(err)
+		return
+	}
+	for _, d := range deliveries {
+		queueDelivery(d)
+	}
+}
+
+// register a URL to be POSTed events of a survey
+func createWebhook(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("create webhook")
+	id, _ := bson.ObjectIDFromHex(mux.Vars(r)["survey_id"])
+	var input struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	var errs []ValidationError
+	if u, err := url.Parse(input.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, ValidationError{"url", "url should be an http or https URL"})
+	}
+	if len(input.Events) == 0 {
+		input.Events = webhookEvents
+	}
+	for i, event := range input.Events {
+		if !slices.Contains(webhookEvents, event) {
+			errs = append(errs, ValidationError{fmt.Sprintf("events[%d]", i), fmt.Sprintf("Unknown event %q, expected response.submitted or survey.closed", event)})
+		}
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := webhooksCollection.CountDocuments(ctx, bson.M{"survey_id": id})
+	if err != nil {
+		panic(err)
+	}
+	if count >= maxWebhooks {
+		http.Error(w, fmt.Sprintf("a survey can have at most %d webhooks", maxWebhooks), http.StatusConflict)
+		return
+	}
+
+	webhook := Webhook{
+		Id:        bson.NewObjectID(),
+		SurveyId:  id,
+		URL:       input.URL,
+		Events:    slices.Compact(slices.Sorted(slices.Values(input.Events))),
+		Secret:    rand.Text(),
+		CreatedAt: time.Now(),
+	}
+	if _, err = webhooksCollection.InsertOne(ctx, webhook); err != nil {
+		panic(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(webhook)
+}
+
+// list the webhooks of a survey, without their secrets
+func getWebhooks(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get webhooks")
+	id, _ := bson.ObjectIDFromHex(mux.Vars(r)["survey_id"])
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := webhooksCollection.Find(ctx, bson.M{"survey_id": id},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}).SetProjection(bson.M{"secret": 0}))
+	if err != nil {
+		panic(err)
+	}
+	webhooks := []Webhook{}
+	if err = cursor.All(ctx, &webhooks); err != nil {
+		panic(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhooks)
+}
+
+// remove a webhook, its pending deliveries fail
+func deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("delete webhook")
+	queries := mux.Vars(r)
+	id, _ := bson.ObjectIDFromHex(queries["survey_id"])
+	webhookId, err := bson.ObjectIDFromHex(queries["webhook_id"])
+	if err != nil {
+		http.Error(w, "Invalid Webhook Id", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := webhooksCollection.DeleteOne(ctx, bson.M{"_id": webhookId, "survey_id": id})
+	if err != nil {
+		panic(err)
+	}
+	if res.DeletedCount == 0 {
+		http.Error(w, "No webhook found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "webhook deleted"})
+}
+
+// deliveries listed at most
+const maxDeliveryLimit = 500
+
+// list the deliveries of a webhook, newest first, optionally only those with one status
+func getWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get webhook deliveries")
+	queries := mux.Vars(r)
+	id, _ := bson.ObjectIDFromHex(queries["survey_id"])
+	webhookId, err := bson.ObjectIDFromHex(queries["webhook_id"])
+	if err != nil {
+		http.Error(w, "Invalid Webhook Id", http.StatusBadRequest)
+		return
+	}
+	filter := bson.M{"survey_id": id, "webhook_id": webhookId}
+	switch status := r.URL.Query().Get("status"); status {
+	case "":
+	case DeliveryPending, DeliveryDelivered, DeliveryFailed:
+		filter["status"] = status
+	default:
+		http.Error(w, "Invalid status, expected pending, delivered or failed", http.StatusBadRequest)
+		return
+	}
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 {
+		limit = 50
+	}
+	limit = min(limit, maxDeliveryLimit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	fOpt := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(int64(limit))
+	cursor, err := webhookDeliveriesCollection.Find(ctx, filter, fOpt)
+	if err != nil {
+		panic(err)
+	}
+	deliveries := []WebhookDelivery{}
+	if err = cursor.All(ctx, &deliveries); err != nil {
+		panic(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// deliver a failed delivery again, with a fresh set of attempts
+func redeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("redeliver webhook")
+	queries := mux.Vars(r)
+	id, _ := bson.ObjectIDFromHex(queries["survey_id"])
+	webhookId, err := bson.ObjectIDFromHex(queries["webhook_id"])
+	if err != nil {
+		http.Error(w, "Invalid Webhook Id", http.StatusBadRequest)
+		return
+	}
+	deliveryId, err := bson.ObjectIDFromHex(queries["delivery_id"])
+	if err != nil {
+		http.Error(w, "Invalid Delivery Id", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// only failed deliveries, a pending one is still being retried
+	filter := bson.M{"_id": deliveryId, "survey_id": id, "webhook_id": webhookId}
+	lease := time.Now().Add(webhookLease)
+	var d WebhookDelivery
+	err = webhookDeliveriesCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": deliveryId, "survey_id": id, "webhook_id": webhookId, "status": DeliveryFailed},
+		bson.M{"$set": bson.M{"status": DeliveryPending, "attempts": 0, "next_attempt_at": lease}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&d)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		count, err := webhookDeliveriesCollection.CountDocuments(ctx, filter)
+		if err != nil {
+			panic(err)
+		}
+		if count == 0 {
+			http.Error(w, "No delivery found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "only failed deliveries can be redelivered", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+	queueDelivery(d)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(d)
+}
+
+// a closed survey, for the survey.closed event
+func surveyClosedEvent(s Survey) SurveyClosedEvent {
+	return SurveyClosedEvent{s.Title, s.ResponseCount, s.UpdatedAt}
+}
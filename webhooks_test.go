@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPublicAddressOnly(t *testing.T) {
+	tests := map[string]bool{
+		"93.184.215.14:443":     true,
+		"[2606:4700::1111]:443": true,
+		"127.0.0.1:80":          false,
+		"10.1.2.3:80":           false,
+		"172.16.0.1:80":         false,
+		"192.168.1.1:80":        false,
+		"169.254.169.254:80":    false,
+		"0.0.0.0:80":            false,
+		"[::1]:80":              false,
+		"[fe80::1]:80":          false,
+		"[fd00::1]:80":          false,
+		"[::ffff:127.0.0.1]:80": false,
+		"[::]:80":               false,
+		"224.0.0.1:80":          false,
+	}
+	for address, public := range tests {
+		if err := publicAddressOnly("tcp", address, nil); (err == nil) != public {
+			t.Errorf("%s: error %v, want public %v", address, err, public)
+		}
+	}
+}
+
+func TestWebhookToLocalServerFails(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+	defer server.Close()
+
+	err := deliverWebhook(Webhook{URL: server.URL, Secret: "secret"}, WebhookDelivery{Event: EventResponseSubmitted, Payload: []byte("{}")})
+	if !errors.Is(err, errPrivateAddress) {
+		t.Errorf("error = %v, want %v", err, errPrivateAddress)
+	}
+	if called {
+		t.Error("the local server was called")
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// number of terms returned by default and at most
+const (
+	defaultWordLimit = 50
+	maxWordLimit     = 500
+)
+
+// common English words carrying no meaning on their own
+var stopwords = wordSet(`a about above after again against all am an and any are as at be because been
+	before being below between both but by can could did do does doing down during each few for from further had
+	has have having he her here hers herself him himself his how i if in into is it its itself just me more most
+	my myself no nor not now of off on once only or other our ours ourselves out over own same she should so
+	some such than that the their theirs them themselves then there these they this those through to too under
+	until up very was we were what when where which while who whom why will with would you your yours yourself
+	yourselves also get got im ive dont didnt isnt cant wont thats theres really much many`)
+
+func wordSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
+type TermCount struct {
+	Term  string `json:"term"`
+	Count int    `json:"count"`
+}
+
+// lowercase words of s without punctuation, stopwords and single characters
+func tokenize(s string) []string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '\''
+	})
+	terms := words[:0]
+	for _, w := range words {
+		w = strings.ReplaceAll(strings.Trim(w, "'"), "'", "")
+		if len([]rune(w)) < 2 || stopwords[w] {
+			continue
+		}
+		terms = append(terms, w)
+	}
+	return terms
+}
+
+// get the most frequent terms of the text answers to a question, for word clouds
+func getQuestionWords(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("get question words")
+	queries := mux.Vars(r)
+	id, _ := bson.ObjectIDFromHex(queries["survey_id"])
+	questionId, err := bson.ObjectIDFromHex(queries["question_id"])
+	if err != nil {
+		http.Error(w, "Invalid Question Id", http.StatusBadRequest)
+		return
+	}
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 {
+		limit = defaultWordLimit
+	}
+	limit = min(limit, maxWordLimit)
+
+	survey, ok := findSurveyById(w, id)
+	if !ok {
+		return
+	}
+	i := slices.IndexFunc(survey.Questions, func(q Question) bool { return q.Id == questionId })
+	if i < 0 {
+		http.Error(w, "No question found", http.StatusNotFound)
+		return
+	}
+	if survey.Questions[i].QuestionType != "Textbox" {
+		http.Error(w, "word frequencies are only available for Textbox questions", http.StatusBadRequest)
+		return
+	}
+	filter, err := exportFilter(r, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter["question_id"] = questionId
+
+	ctx, cancel := context.WithTimeout(context.Background(), streamTimeout)
+	defer cancel()
+
+	cursor, err := responsesCollection.Find(ctx, filter, options.Find().SetProjection(bson.M{"response_text": 1}))
+	if err != nil {
+		panic(err)
+	}
+	defer cursor.Close(ctx)
+	counts := make(map[string]int)
+	for cursor.Next(ctx) {
+		var response Response
+		if err := cursor.Decode(&response); err != nil {
+			panic(err)
+		}
+		for _, term := range tokenize(response.ResponseText) {
+			counts[term]++
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		panic(err)
+	}
+
+	terms := make([]TermCount, 0, len(counts))
+	for term, count := range counts {
+		terms = append(terms, TermCount{term, count})
+	}
+	slices.SortFunc(terms, func(a, b TermCount) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Term, b.Term)
+	})
+	if len(terms) > limit {
+		terms = terms[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(terms)
+}